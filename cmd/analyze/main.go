@@ -0,0 +1,50 @@
+// Command analyze reports the likely encoding, block size and mode of a Ciphertext.
+//
+// With -lines, every line of the input is treated as a separate candidate Ciphertext
+// (as in challenge 8), and the candidates are printed most-likely-ECB first.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
+)
+
+func main() {
+	lines := flag.Bool("lines", false, "analyze each line of the input as a separate Ciphertext")
+	top := flag.Int("top", 0, "with -lines, only print this many reports (0 for all)")
+	flag.Parse()
+
+	if *lines {
+		if flag.NArg() != 1 {
+			log.Fatal("usage: analyze -lines <file>")
+		}
+		reports, err := pals.AnalyzeCiphertextFile(flag.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		for i, r := range reports {
+			if *top > 0 && i >= *top {
+				break
+			}
+			fmt.Printf("line %d:\n%s\n", r.Line, r)
+		}
+		return
+	}
+
+	var input []byte
+	var err error
+	if flag.NArg() == 0 {
+		input, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		input, err = ioutil.ReadFile(flag.Arg(0))
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(pals.AnalyzeCiphertext(input))
+}
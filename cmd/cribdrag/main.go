@@ -0,0 +1,254 @@
+// Command cribdrag is an interactive crib-dragger for Ciphertexts that share a Keystream.
+//
+// It loads one Ciphertext per line (raw, hex or base64), or a session saved earlier with -session.
+// With -encrypt, the lines are taken as Plaintexts and encrypted under a random CTR Key with a fixed nonce,
+// which turns challenge 19 into something to practice on.
+//
+// Commands:
+//
+//	show                     print every Ciphertext decrypted under the known Keystream
+//	drag <row> <crib>        try the crib at every offset of a row, best placements first
+//	                         (trailing spaces are part of the crib)
+//	lock <row> <offset> <text>
+//	                         fix the Keystream so that text appears at offset of a row
+//	unlock <offset> <length> forget Keystream bytes
+//	auto [confidence]        fill unknown Keystream bytes from statistics
+//	save <file>, load <file>
+//	quit
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
+	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiRed    = "\x1b[31m"
+	ansiDim    = "\x1b[2m"
+)
+
+type tool struct {
+	s     *pals.CribSession
+	color bool
+	top   int
+}
+
+func main() {
+	session := flag.String("session", "", "load a saved session instead of a Ciphertext file")
+	encrypt := flag.Bool("encrypt", false, "treat the input lines as Plaintexts and encrypt them under a fixed-nonce CTR Key")
+	color := flag.Bool("color", true, "highlight output with ANSI colors")
+	top := flag.Int("top", 5, "how many placements drag prints")
+	flag.Parse()
+
+	t := tool{color: *color, top: *top}
+	var err error
+	switch {
+	case *session != "":
+		t.s, err = pals.LoadCribSession(*session)
+	case flag.NArg() == 1:
+		t.s, err = loadCiphertexts(flag.Arg(0), *encrypt)
+	default:
+		log.Fatal("usage: cribdrag [-encrypt] <file> | cribdrag -session <file>")
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("loaded %d Ciphertexts, type help for commands\n", len(t.s.Ciphertexts))
+
+	sc := bufio.NewScanner(os.Stdin)
+	for fmt.Print("> "); sc.Scan(); fmt.Print("> ") {
+		// only leading space is trimmed, since trailing space in a crib or locked text counts
+		line := strings.TrimLeft(strings.TrimRight(sc.Text(), "\r"), " \t")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if cmd := strings.TrimSpace(line); cmd == "quit" || cmd == "exit" {
+			return
+		}
+		if err := t.run(line); err != nil {
+			fmt.Println("error:", err)
+		}
+	}
+}
+
+func loadCiphertexts(filename string, encrypt bool) (*pals.CribSession, error) {
+	lines, err := utils.ScanFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	k := utils.GenerateKey()
+	var ciphertexts []pals.Ciphertext
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		_, b := pals.DetectEncoding([]byte(l))
+		if encrypt {
+			b, err = pals.CTR{Plaintext: b}.Encrypt(k)
+			if err != nil {
+				return nil, err
+			}
+		}
+		ciphertexts = append(ciphertexts, b)
+	}
+	return pals.NewCribSession(ciphertexts), nil
+}
+
+func (t *tool) run(line string) error {
+	fields := strings.SplitN(line, " ", 2)
+	var args string
+	if len(fields) == 2 {
+		args = fields[1]
+	}
+	switch fields[0] {
+	case "help":
+		fmt.Println("show | drag <row> <crib> | lock <row> <offset> <text> | unlock <offset> <length> | auto [confidence] | save <file> | load <file> | quit")
+	case "show":
+		t.show()
+	case "drag":
+		row, crib, err := splitInt(args)
+		if err != nil {
+			return err
+		}
+		return t.drag(row, []byte(crib))
+	case "lock":
+		row, rest, err := splitInt(args)
+		if err != nil {
+			return err
+		}
+		offset, text, err := splitInt(rest)
+		if err != nil {
+			return err
+		}
+		if err := t.s.Lock(row, offset, []byte(text)); err != nil {
+			return err
+		}
+		t.show()
+	case "unlock":
+		offset, rest, err := splitInt(args)
+		if err != nil {
+			return err
+		}
+		length, err := strconv.Atoi(strings.TrimSpace(rest))
+		if err != nil {
+			return err
+		}
+		t.s.Unlock(offset, length)
+		t.show()
+	case "auto":
+		confidence := 0.5
+		if args = strings.TrimSpace(args); args != "" {
+			var err error
+			if confidence, err = strconv.ParseFloat(args, 64); err != nil {
+				return err
+			}
+		}
+		n, err := t.s.FillFromStatistics(confidence)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("filled %d Keystream bytes\n", n)
+		t.show()
+	case "save":
+		return t.s.Save(strings.TrimSpace(args))
+	case "load":
+		s, err := pals.LoadCribSession(strings.TrimSpace(args))
+		if err != nil {
+			return err
+		}
+		t.s = s
+		t.show()
+	default:
+		return fmt.Errorf("unknown command %q, type help for commands", fields[0])
+	}
+	return nil
+}
+
+// splitInt splits "<n> <rest>" into n and rest, keeping any spaces inside rest
+func splitInt(args string) (int, string, error) {
+	fields := strings.SplitN(args, " ", 2)
+	n, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, "", fmt.Errorf("expected a number, got %q", fields[0])
+	}
+	if len(fields) == 1 {
+		return n, "", nil
+	}
+	return n, fields[1], nil
+}
+
+func (t *tool) show() {
+	plaintexts, known := t.s.Plaintexts()
+	for i, p := range plaintexts {
+		var b strings.Builder
+		for j, c := range p {
+			if !known[i][j] {
+				b.WriteString(t.paint(ansiDim, "_"))
+				continue
+			}
+			b.WriteString(t.highlightByte(c))
+		}
+		fmt.Printf("%3d  %s\n", i, b.String())
+	}
+}
+
+func (t *tool) drag(row int, crib []byte) error {
+	placements, err := t.s.Drag(row, crib)
+	if err != nil {
+		return err
+	}
+	for n, p := range placements {
+		if n >= t.top {
+			break
+		}
+		fmt.Printf("offset %d: %.0f%% printable, score %.1f\n", p.Offset, 100*p.Printable, p.Score)
+		for i, implied := range p.Implied {
+			if i == row {
+				fmt.Printf("%3d* %s\n", i, t.highlight(crib))
+				continue
+			}
+			if implied != nil {
+				fmt.Printf("%3d  %s\n", i, t.highlight(implied))
+			}
+		}
+	}
+	return nil
+}
+
+// highlight colors letters and spaces green, other printable bytes yellow and the rest red
+func (t *tool) highlight(b []byte) string {
+	var s strings.Builder
+	for _, c := range b {
+		s.WriteString(t.highlightByte(c))
+	}
+	return s.String()
+}
+
+func (t *tool) highlightByte(c byte) string {
+	switch {
+	case c == ' ' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		return t.paint(ansiGreen, string(c))
+	case pals.IsPrintable(c) && c != '\n' && c != '\r' && c != '\t':
+		return t.paint(ansiYellow, string(c))
+	default:
+		return t.paint(ansiRed, "?")
+	}
+}
+
+func (t *tool) paint(color, s string) string {
+	if !t.color {
+		return s
+	}
+	return color + s + ansiReset
+}
@@ -0,0 +1,75 @@
+// Command freqattack guesses the values of a column that was encrypted with AES_ECB under one Key,
+// by matching the frequency of each Ciphertext to a public distribution of the Plaintext values.
+//
+// The public distribution is a CSV of value,weight rows. With -simulate, a column is drawn from the
+// distribution and encrypted under a random Key instead, and the accuracy of the attack is reported.
+package main
+
+import (
+	"crypto/aes"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
+	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
+)
+
+func main() {
+	aux := flag.String("aux", "", "CSV of value,weight rows giving the public distribution of the column")
+	column := flag.String("column", "", "name of the encrypted column")
+	simulate := flag.Int("simulate", 0, "simulate a column of this many rows instead of reading one")
+	top := flag.Int("top", 0, "only print this many guesses (0 for all)")
+	blocksize := flag.Int("blocksize", aes.BlockSize, "block size of the cipher the column was encrypted with")
+	flag.Parse()
+
+	if *aux == "" {
+		log.Fatal("usage: freqattack -aux <distribution.csv> (-column <name> <data.csv> | -simulate <rows>)")
+	}
+	d, err := pals.ReadDistribution(*aux)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *simulate > 0 {
+		rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+		c, truth, err := pals.SimulateColumn(d, *simulate, utils.GenerateKey(), rng)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// SimulateColumn encrypts with AES_ECB, whatever -blocksize says
+		r := pals.FrequencyAttack(c, d, aes.BlockSize)
+		fmt.Println(pals.MeasureColumnAccuracy(r, c, truth))
+		return
+	}
+
+	if *column == "" || flag.NArg() != 1 {
+		log.Fatal("usage: freqattack -aux <distribution.csv> -column <name> <data.csv>")
+	}
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	c, err := pals.ReadEncryptedColumn(f, *column)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for i, g := range pals.FrequencyAttack(c, d, *blocksize).Guesses {
+		if *top > 0 && i >= *top {
+			break
+		}
+		guess := "?"
+		if g.Plaintext != nil {
+			guess = fmt.Sprintf("%q", g.Plaintext)
+		}
+		prefix := g.Ciphertext
+		if len(prefix) > 8 {
+			prefix = prefix[:8]
+		}
+		fmt.Printf("%6d  %x...  %s\n", g.Count, prefix, guess)
+	}
+}
@@ -0,0 +1,99 @@
+// Command trainlm trains a byte n-gram model from sample files, in the format pals embeds and
+// ReadNGramModel reads. The built-in models in pkg/pals/models were made with it, for example:
+//
+//	trainlm -n 4 -prune 2 -prose -collapse -utf8 -o pkg/pals/models/german.4 tutor.de.utf-8
+//
+// README.md lists the command and the sample files for each of them.
+// -collapse turns every run of whitespace into a single space, which suits prose but not source code.
+// -prose drops the lines that are mostly not letters, such as the rules and commands of a tutorial, which
+// would otherwise give a language model its most frequent n-grams.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
+)
+
+func main() {
+	n := flag.Int("n", 4, "n-gram length")
+	prune := flag.Float64("prune", 1, "drop n-grams seen fewer than this many times")
+	prose := flag.Bool("prose", false, "drop lines where less than half of the non-space characters are letters")
+	collapse := flag.Bool("collapse", false, "collapse runs of whitespace into a single space")
+	utf8Flag := flag.Bool("utf8", false, "mark the model as UTF-8 text; fails if a sample is not valid UTF-8")
+	out := flag.String("o", "", "write the model here instead of to stdout")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		log.Fatal("usage: trainlm [-n 4] [-prune 1] [-prose] [-collapse] [-utf8] [-o model] <sample>...")
+	}
+	var corpus []byte
+	for _, name := range flag.Args() {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *utf8Flag && !utf8.Valid(b) {
+			log.Fatalf("%s is not valid UTF-8", name)
+		}
+		if *prose {
+			b = proseLines(b)
+		}
+		if *collapse {
+			b = bytes.Join(bytes.Fields(b), []byte(" "))
+		}
+		corpus = append(append(corpus, b...), ' ')
+	}
+	m, err := pals.TrainNGramModel(corpus, *n)
+	if err != nil {
+		log.Fatal(err)
+	}
+	m.UTF8 = *utf8Flag
+	trained := len(m.Counts)
+	m.Prune(*prune)
+
+	w := bufio.NewWriter(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = bufio.NewWriter(f)
+	}
+	if _, err := m.WriteTo(w); err != nil {
+		log.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "%d-gram model of %d bytes: kept %d of %d n-grams\n", *n, len(corpus), len(m.Counts), trained)
+}
+
+// proseLines keeps the lines of b where letters make up at least half of the characters other than spaces
+func proseLines(b []byte) []byte {
+	var kept [][]byte
+	for _, line := range bytes.Split(b, []byte("\n")) {
+		var letters, other int
+		for _, r := range string(line) {
+			switch {
+			case unicode.IsLetter(r):
+				letters++
+			case !unicode.IsSpace(r):
+				other++
+			}
+		}
+		if letters > 0 && letters >= other {
+			kept = append(kept, line)
+		}
+	}
+	return bytes.Join(kept, []byte("\n"))
+}
@@ -0,0 +1,338 @@
+// Package classical implements pen-and-paper ciphers over the 26 letter alphabet, and solvers for them.
+// Letters keep their case and everything else passes through unchanged, so word breaks and punctuation
+// survive encryption, as they usually did in practice.
+package classical
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
+)
+
+const alphabetSize = 26
+
+// Cipher is a classical cipher with its Key
+type Cipher interface {
+	Encrypt(plain []byte) []byte
+	Decrypt(c []byte) []byte
+}
+
+// LetterIndex returns the position of a letter in the alphabet, and whether it is upper case.
+// ok is false for anything that isn't a letter.
+func LetterIndex(b byte) (i int, upper bool, ok bool) {
+	switch {
+	case b >= 'a' && b <= 'z':
+		return int(b - 'a'), false, true
+	case b >= 'A' && b <= 'Z':
+		return int(b - 'A'), true, true
+	}
+	return 0, false, false
+}
+
+func letter(i int, upper bool) byte {
+	i = Mod(i, alphabetSize)
+	if upper {
+		return byte('A' + i)
+	}
+	return byte('a' + i)
+}
+
+// Mod is a modulo m that is never negative
+func Mod(a, m int) int {
+	a %= m
+	if a < 0 {
+		a += m
+	}
+	return a
+}
+
+// mapLetters replaces every letter with f of its index and its position among the letters
+func mapLetters(text []byte, f func(i, n int) int) []byte {
+	out := make([]byte, len(text))
+	var n int
+	for j, b := range text {
+		i, upper, ok := LetterIndex(b)
+		if !ok {
+			out[j] = b
+			continue
+		}
+		out[j] = letter(f(i, n), upper)
+		n++
+	}
+	return out
+}
+
+// Letters returns the letters of text as alphabet indexes, 0 for A
+func Letters(text []byte) []int {
+	var l []int
+	for _, b := range text {
+		if i, _, ok := LetterIndex(b); ok {
+			l = append(l, i)
+		}
+	}
+	return l
+}
+
+// Caesar shifts every letter Shift places along the alphabet
+type Caesar struct {
+	Shift int
+}
+
+func (c Caesar) Encrypt(plain []byte) []byte {
+	return mapLetters(plain, func(i, _ int) int { return i + c.Shift })
+}
+
+func (c Caesar) Decrypt(e []byte) []byte {
+	return mapLetters(e, func(i, _ int) int { return i - c.Shift })
+}
+
+// Affine maps letter x to A*x + B. A must be coprime to 26 for the cipher to be reversible; an Affine
+// whose A isn't, which NewAffine refuses, passes text through unchanged.
+type Affine struct {
+	A, B int
+}
+
+// NewAffine checks that A has an inverse mod 26
+func NewAffine(a, b int) (Affine, error) {
+	if _, err := modInverse(a, alphabetSize); err != nil {
+		return Affine{}, err
+	}
+	return Affine{A: Mod(a, alphabetSize), B: Mod(b, alphabetSize)}, nil
+}
+
+func (c Affine) Encrypt(plain []byte) []byte {
+	if _, err := modInverse(c.A, alphabetSize); err != nil {
+		return append([]byte{}, plain...)
+	}
+	return mapLetters(plain, func(i, _ int) int { return c.A*i + c.B })
+}
+
+func (c Affine) Decrypt(e []byte) []byte {
+	inv, err := modInverse(c.A, alphabetSize)
+	if err != nil {
+		// an Affine that didn't come from NewAffine; there is no right answer
+		return append([]byte{}, e...)
+	}
+	return mapLetters(e, func(i, _ int) int { return inv * (i - c.B) })
+}
+
+// modInverse returns x such that a*x == 1 mod m
+func modInverse(a, m int) (int, error) {
+	a = Mod(a, m)
+	for x := 1; x < m; x++ {
+		if a*x%m == 1 {
+			return x, nil
+		}
+	}
+	return 0, fmt.Errorf("%d has no inverse mod %d", a, m)
+}
+
+// Vigenere shifts each letter by the next letter of the Key, repeating the Key as needed.
+// Only letters use up the Key. The zero Vigenere has no Key and shifts nothing; NewVigenere makes one.
+type Vigenere struct {
+	// key holds the shifts, 0 for A
+	key []byte
+}
+
+// NewVigenere checks that the Key is made of letters
+func NewVigenere(key string) (Vigenere, error) {
+	shifts, err := keyShifts(key)
+	if err != nil {
+		return Vigenere{}, err
+	}
+	return Vigenere{key: shifts}, nil
+}
+
+// KeyString returns the Key as upper case letters
+func (c Vigenere) KeyString() string {
+	return shiftsString(c.key)
+}
+
+func (c Vigenere) Encrypt(plain []byte) []byte {
+	if len(c.key) == 0 {
+		return append([]byte{}, plain...)
+	}
+	return mapLetters(plain, func(i, n int) int { return i + int(c.key[n%len(c.key)]) })
+}
+
+func (c Vigenere) Decrypt(e []byte) []byte {
+	if len(c.key) == 0 {
+		return append([]byte{}, e...)
+	}
+	return mapLetters(e, func(i, n int) int { return i - int(c.key[n%len(c.key)]) })
+}
+
+// Autokey is Vigenere with a Key that is the Primer followed by the Plaintext itself. The zero Autokey
+// has no Primer and shifts nothing; NewAutokey makes one.
+type Autokey struct {
+	// primer holds the shifts, 0 for A
+	primer []byte
+}
+
+// NewAutokey checks that the Primer is made of letters
+func NewAutokey(primer string) (Autokey, error) {
+	shifts, err := keyShifts(primer)
+	if err != nil {
+		return Autokey{}, err
+	}
+	return Autokey{primer: shifts}, nil
+}
+
+// PrimerString returns the Primer as upper case letters
+func (c Autokey) PrimerString() string {
+	return shiftsString(c.primer)
+}
+
+func (c Autokey) Encrypt(plain []byte) []byte {
+	if len(c.primer) == 0 {
+		return append([]byte{}, plain...)
+	}
+	p := Letters(plain)
+	return mapLetters(plain, func(i, n int) int { return i + c.shift(p, n) })
+}
+
+func (c Autokey) Decrypt(e []byte) []byte {
+	if len(c.primer) == 0 {
+		return append([]byte{}, e...)
+	}
+	var p []int
+	return mapLetters(e, func(i, n int) int {
+		d := Mod(i-c.shift(p, n), alphabetSize)
+		p = append(p, d)
+		return d
+	})
+}
+
+// shift is the Key letter for letter n, given the Plaintext letters before it
+func (c Autokey) shift(plain []int, n int) int {
+	if n < len(c.primer) {
+		return int(c.primer[n])
+	}
+	return plain[n-len(c.primer)]
+}
+
+func keyShifts(key string) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("empty Key")
+	}
+	shifts := make([]byte, len(key))
+	for j := range key {
+		i, _, ok := LetterIndex(key[j])
+		if !ok {
+			return nil, fmt.Errorf("Key %q has a character that is not a letter: %q", key, key[j])
+		}
+		shifts[j] = byte(i)
+	}
+	return shifts, nil
+}
+
+func shiftsString(shifts []byte) string {
+	s := make([]byte, len(shifts))
+	for j, k := range shifts {
+		s[j] = letter(int(k), true)
+	}
+	return string(s)
+}
+
+// Substitution replaces each letter with another, according to a permuted alphabet:
+// the Plaintext letter i becomes Alphabet[i], an index 0-25 rather than a letter. An Alphabet that is not
+// a permutation of 0-25, which NewSubstitution refuses, passes text through unchanged.
+type Substitution struct {
+	Alphabet [alphabetSize]byte
+}
+
+// NewSubstitution takes the cipher alphabet as 26 distinct letters, the Ciphertext letter for a, b, c...
+func NewSubstitution(alphabet string) (Substitution, error) {
+	var s Substitution
+	if len(alphabet) != alphabetSize {
+		return s, fmt.Errorf("cipher alphabet %q must have %d letters", alphabet, alphabetSize)
+	}
+	var seen [alphabetSize]bool
+	for j := range alphabet {
+		i, _, ok := LetterIndex(alphabet[j])
+		if !ok || seen[i] {
+			return s, fmt.Errorf("cipher alphabet %q must be %d distinct letters", alphabet, alphabetSize)
+		}
+		seen[i] = true
+		s.Alphabet[j] = byte(i)
+	}
+	return s, nil
+}
+
+// KeyString returns the cipher alphabet as upper case letters
+func (c Substitution) KeyString() string {
+	return shiftsString(c.Alphabet[:])
+}
+
+func (c Substitution) Encrypt(plain []byte) []byte {
+	if !c.valid() {
+		return append([]byte{}, plain...)
+	}
+	return mapLetters(plain, func(i, _ int) int { return int(c.Alphabet[i]) })
+}
+
+func (c Substitution) Decrypt(e []byte) []byte {
+	if !c.valid() {
+		return append([]byte{}, e...)
+	}
+	var inverse [alphabetSize]int
+	for i, a := range c.Alphabet {
+		inverse[a] = i
+	}
+	return mapLetters(e, func(i, _ int) int { return inverse[i] })
+}
+
+// valid reports whether the Alphabet is a permutation of 0-25
+func (c Substitution) valid() bool {
+	var seen [alphabetSize]bool
+	for _, a := range c.Alphabet {
+		if int(a) >= alphabetSize || seen[a] {
+			return false
+		}
+		seen[a] = true
+	}
+	return true
+}
+
+// IndexOfCoincidence is the chance that two letters drawn from the text are the same, times 26: about 1.73
+// for english and 1 for random letters
+func IndexOfCoincidence(text []byte) float64 {
+	return IndexOfCoincidenceOf(Letters(text))
+}
+
+// IndexOfCoincidenceOf is IndexOfCoincidence of letters already turned into alphabet indexes
+func IndexOfCoincidenceOf(l []int) float64 {
+	if len(l) < 2 {
+		return 0
+	}
+	var counts [alphabetSize]float64
+	for _, i := range l {
+		counts[i]++
+	}
+	var coincidences float64
+	for _, n := range counts {
+		coincidences += n * (n - 1)
+	}
+	return alphabetSize * coincidences / float64(len(l)*(len(l)-1))
+}
+
+// scorer returns s, or pals.EnglishQuadgrams, which the classical solvers default to: they keep word
+// spacing, so runs of letters tell Keys apart where letter frequencies alone often can't
+func scorer(s pals.Scorer) pals.Scorer {
+	if s == nil {
+		return pals.EnglishQuadgrams()
+	}
+	return s
+}
+
+// best returns the index of the lowest score
+func best(scores []float64) int {
+	b := 0
+	for i, s := range scores {
+		if s < scores[b] || math.IsNaN(scores[b]) {
+			b = i
+		}
+	}
+	return b
+}
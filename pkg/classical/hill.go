@@ -0,0 +1,430 @@
+package classical
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
+)
+
+// ErrSingularMatrix is returned for a matrix with no inverse mod 26, which can't be a Hill Key
+var ErrSingularMatrix = errors.New("matrix has no inverse mod 26")
+
+// Hill multiplies each block of n letters, as a column vector, by an n×n Key matrix mod 26. The letters are
+// padded with x to a whole number of blocks, and Decrypt leaves the padding on. With a Key that is empty,
+// not square or has no inverse, which NewHill refuses, the text is left as it is.
+type Hill struct {
+	Key [][]int
+}
+
+// NewHill checks that the Key is square and has an inverse mod 26
+func NewHill(key [][]int) (Hill, error) {
+	k := make([][]int, len(key))
+	for i, row := range key {
+		if len(row) != len(key) {
+			return Hill{}, fmt.Errorf("Hill Key must be square, row %d has %d entries for %d rows", i, len(row), len(key))
+		}
+		k[i] = make([]int, len(row))
+		for j, x := range row {
+			k[i][j] = Mod(x, alphabetSize)
+		}
+	}
+	if len(k) == 0 {
+		return Hill{}, fmt.Errorf("empty Hill Key")
+	}
+	if _, err := InvertMatrix(k); err != nil {
+		return Hill{}, err
+	}
+	return Hill{Key: k}, nil
+}
+
+// NewHillFromString reads the Key matrix row by row from a string of n*n letters, as in "GYBNQKURP"
+func NewHillFromString(key string) (Hill, error) {
+	shifts, err := keyShifts(key)
+	if err != nil {
+		return Hill{}, err
+	}
+	n := int(math.Sqrt(float64(len(shifts))))
+	for n*n < len(shifts) {
+		n++
+	}
+	if n*n != len(shifts) {
+		return Hill{}, fmt.Errorf("Hill Key %q has %d letters, which is not a square", key, len(shifts))
+	}
+	m := make([][]int, n)
+	for i := range m {
+		m[i] = make([]int, n)
+		for j := range m[i] {
+			m[i][j] = int(shifts[i*n+j])
+		}
+	}
+	return NewHill(m)
+}
+
+func (c Hill) Encrypt(plain []byte) []byte {
+	if _, err := InvertMatrix(c.Key); err != nil || len(c.Key) == 0 {
+		// a Hill that didn't come from NewHill, whose Ciphertext could not be decrypted
+		return append([]byte{}, plain...)
+	}
+	if r := len(Letters(plain)) % len(c.Key); r != 0 {
+		pad := byte('x')
+		for i := len(plain) - 1; i >= 0; i-- {
+			if _, upper, ok := LetterIndex(plain[i]); ok {
+				if upper {
+					pad = 'X'
+				}
+				break
+			}
+		}
+		plain = append(append([]byte{}, plain...), bytes.Repeat([]byte{pad}, len(c.Key)-r)...)
+	}
+	return applyMatrix(plain, c.Key)
+}
+
+func (c Hill) Decrypt(e []byte) []byte {
+	inverse, err := InvertMatrix(c.Key)
+	if err != nil || len(c.Key) == 0 {
+		// a Hill that didn't come from NewHill; there is no right answer
+		return append([]byte{}, e...)
+	}
+	return applyMatrix(e, inverse)
+}
+
+// applyMatrix multiplies each whole block of letters by m. Letters after the last whole block are left as they are.
+func applyMatrix(text []byte, m [][]int) []byte {
+	n := len(m)
+	l := Letters(text)
+	out := make([]int, len(l))
+	copy(out, l)
+	for b := 0; b+n <= len(l); b += n {
+		for i, row := range m {
+			var x int
+			for j, k := range row {
+				x += k * l[b+j]
+			}
+			out[b+i] = Mod(x, alphabetSize)
+		}
+	}
+	return mapLetters(text, func(_, n int) int { return out[n] })
+}
+
+// InvertMatrix returns the inverse of a square matrix mod 26. It inverts the matrix mod 2 and mod 13, where
+// every nonzero number has an inverse, and combines the two with the Chinese remainder theorem.
+func InvertMatrix(m [][]int) ([][]int, error) {
+	mod2, err := invertMatrixModPrime(m, 2)
+	if err != nil {
+		return nil, err
+	}
+	mod13, err := invertMatrixModPrime(m, 13)
+	if err != nil {
+		return nil, err
+	}
+	inverse := make([][]int, len(m))
+	for i := range inverse {
+		inverse[i] = make([]int, len(m))
+		for j := range inverse[i] {
+			// 13 is 1 mod 2 and 0 mod 13, and 14 is 0 mod 2 and 1 mod 13
+			inverse[i][j] = Mod(13*mod2[i][j]+14*mod13[i][j], alphabetSize)
+		}
+	}
+	return inverse, nil
+}
+
+// invertMatrixModPrime inverts m mod p by Gauss-Jordan elimination
+func invertMatrixModPrime(m [][]int, p int) ([][]int, error) {
+	n := len(m)
+	a := make([][]int, n)
+	for i, row := range m {
+		if len(row) != n {
+			return nil, fmt.Errorf("matrix must be square, row %d has %d entries for %d rows", i, len(row), n)
+		}
+		a[i] = make([]int, 2*n)
+		for j, x := range row {
+			a[i][j] = Mod(x, p)
+		}
+		a[i][n+i] = 1
+	}
+	for col := 0; col < n; col++ {
+		pivot := -1
+		for r := col; r < n; r++ {
+			if a[r][col] != 0 {
+				pivot = r
+				break
+			}
+		}
+		if pivot < 0 {
+			return nil, fmt.Errorf("%w: it is singular mod %d", ErrSingularMatrix, p)
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		inv, _ := modInverse(a[col][col], p)
+		for j := range a[col] {
+			a[col][j] = a[col][j] * inv % p
+		}
+		for r := range a {
+			if r == col || a[r][col] == 0 {
+				continue
+			}
+			f := a[r][col]
+			for j := range a[r] {
+				a[r][j] = Mod(a[r][j]-f*a[col][j], p)
+			}
+		}
+	}
+	inverse := make([][]int, n)
+	for i := range inverse {
+		inverse[i] = a[i][n:]
+	}
+	return inverse, nil
+}
+
+// RecoverHill solves for an n×n Key from a known Plaintext and its Ciphertext. With C = K P, where the
+// columns of P are n blocks of Plaintext letters and those of C the blocks they encrypt to, K = C P⁻¹,
+// so it needs n blocks that are independent mod 26. The Key found is checked against every block.
+func RecoverHill(plain, c []byte, n int) (Hill, error) {
+	if n < 1 {
+		return Hill{}, fmt.Errorf("Hill Key size must be at least 1, got %d", n)
+	}
+	p, e := Letters(plain), Letters(c)
+	if len(e) < len(p) {
+		p = p[:len(e)]
+	}
+	blocks := len(p) / n
+	if blocks < n {
+		return Hill{}, fmt.Errorf("%d letters of known Plaintext is not enough for a %d×%d Key", len(p), n, n)
+	}
+	// P and C hold blocks as columns
+	column := func(l []int, b, i int) int { return l[b*n+i] }
+	var inverse [][]int
+	chosen := make([]int, n)
+	var choose func(k, from int) bool
+	choose = func(k, from int) bool {
+		if k == n {
+			m := make([][]int, n)
+			for i := range m {
+				m[i] = make([]int, n)
+				for j, b := range chosen {
+					m[i][j] = column(p, b, i)
+				}
+			}
+			var err error
+			inverse, err = InvertMatrix(m)
+			return err == nil
+		}
+		for b := from; b < blocks; b++ {
+			chosen[k] = b
+			if choose(k+1, b+1) {
+				return true
+			}
+		}
+		return false
+	}
+	if !choose(0, 0) {
+		return Hill{}, fmt.Errorf("no %d blocks of the known Plaintext are independent mod 26: %w", n, ErrSingularMatrix)
+	}
+	key := make([][]int, n)
+	for i := range key {
+		key[i] = make([]int, n)
+		for j := range key[i] {
+			var x int
+			for k, b := range chosen {
+				x += column(e, b, i) * inverse[k][j]
+			}
+			key[i][j] = Mod(x, alphabetSize)
+		}
+	}
+	h, err := NewHill(key)
+	if err != nil {
+		return Hill{}, err
+	}
+	got := Letters(applyMatrix(lettersText(p[:blocks*n]), key))
+	for i, x := range got {
+		if x != e[i] {
+			return Hill{}, fmt.Errorf("the known Plaintext and Ciphertext disagree with any %d×%d Key at letter %d", n, n, i)
+		}
+	}
+	return h, nil
+}
+
+// HillOptions configure SolveHill
+type HillOptions struct {
+	// RowScorer rates the letters that one row of the decryption matrix gives, every n-th letter of the
+	// Plaintext. It is pals.LetterFrequencyScorer, as SolveSingleByteXorCipher uses, if nil.
+	RowScorer pals.Scorer
+	// Scorer judges whole Plaintexts, pals.EnglishQuadgrams if nil
+	Scorer pals.Scorer
+	// Candidates is the number of best rows the matrix is built from, defaultHillCandidates if 0
+	Candidates int
+	// Iterations is the number of row changes tried by the hill climb, defaultHillIterations if 0
+	Iterations int
+	// Rand drives the search for rows of large matrices and the hill climb; a fixed seed makes them repeatable
+	Rand *rand.Rand
+}
+
+const (
+	defaultHillCandidates = 12
+	defaultHillIterations = 2000
+	// rows of matrices up to this size are searched exhaustively
+	exhaustiveHillRows = 3
+	// rows of larger matrices are found by this many coordinate climbs from random rows
+	hillRowClimbs = 2000
+)
+
+// hillRow is a candidate row of the decryption matrix with the score of the letters it gives
+type hillRow struct {
+	row   []int
+	score float64
+}
+
+// SolveHill finds an n×n Key from the Ciphertext alone. Each row of the decryption matrix gives every n-th
+// letter of the Plaintext by itself, so the rows whose letters look most like english are found first, as
+// SolveSingleByteXorCipher finds each byte of a repeating Key. The decryption matrix is then hill climbed,
+// swapping in candidate rows and reordering them while the score of the whole Plaintext improves.
+func SolveHill(c []byte, n int, opts HillOptions) (Hill, []byte, error) {
+	if n < 1 {
+		return Hill{}, nil, fmt.Errorf("Hill Key size must be at least 1, got %d", n)
+	}
+	if opts.RowScorer == nil {
+		opts.RowScorer = pals.LetterFrequencyScorer
+	}
+	opts.Scorer = scorer(opts.Scorer)
+	if opts.Candidates == 0 {
+		opts.Candidates = defaultHillCandidates
+	}
+	if opts.Candidates < n {
+		opts.Candidates = n
+	}
+	if opts.Iterations == 0 {
+		opts.Iterations = defaultHillIterations
+	}
+	if opts.Rand == nil {
+		opts.Rand = rand.New(rand.NewSource(1))
+	}
+	l := Letters(c)
+	if len(l) < n*n {
+		return Hill{}, nil, fmt.Errorf("%d letters of Ciphertext is not enough for a %d×%d Key", len(l), n, n)
+	}
+	candidates := hillRowCandidates(l[:len(l)/n*n], n, opts)
+
+	// the decryption matrix is a choice of n distinct candidates, in order
+	chosen := make([]int, n)
+	for i := range chosen {
+		chosen[i] = i
+	}
+	matrix := func(chosen []int) [][]int {
+		m := make([][]int, n)
+		for i, k := range chosen {
+			m[i] = candidates[k].row
+		}
+		return m
+	}
+	score := func(chosen []int) float64 {
+		m := matrix(chosen)
+		if _, err := InvertMatrix(m); err != nil {
+			return math.Inf(1)
+		}
+		return opts.Scorer.Score(applyMatrix(c, m))
+	}
+	bestScore := score(chosen)
+	for i := 0; i < opts.Iterations; i++ {
+		next := append([]int{}, chosen...)
+		a := opts.Rand.Intn(n)
+		if b := opts.Rand.Intn(len(candidates)); b < n {
+			next[a], next[b] = next[b], next[a]
+		} else {
+			used := false
+			for _, k := range next {
+				used = used || k == b
+			}
+			if used {
+				continue
+			}
+			next[a] = b
+		}
+		if s := score(next); s < bestScore {
+			chosen, bestScore = next, s
+		}
+	}
+	if math.IsInf(bestScore, 1) {
+		return Hill{}, nil, fmt.Errorf("no %d of the best %d rows make an invertible matrix: %w", n, len(candidates), ErrSingularMatrix)
+	}
+	key, err := InvertMatrix(matrix(chosen))
+	if err != nil {
+		return Hill{}, nil, err
+	}
+	h := Hill{Key: key}
+	return h, h.Decrypt(c), nil
+}
+
+// hillRowCandidates returns the opts.Candidates rows whose letters opts.RowScorer likes best. Every row is
+// tried for small matrices; for larger ones each climb changes one entry of a random row at a time.
+func hillRowCandidates(l []int, n int, opts HillOptions) []hillRow {
+	blocks := len(l) / n
+	rowLetters := make([]byte, blocks)
+	rowScore := func(row []int) float64 {
+		for b := 0; b < blocks; b++ {
+			var x int
+			for j, k := range row {
+				x += k * l[b*n+j]
+			}
+			rowLetters[b] = letter(x, false)
+		}
+		return opts.RowScorer.Score(rowLetters)
+	}
+	seen := make(map[string]bool)
+	var rows []hillRow
+	add := func(row []int, score float64) {
+		k := fmt.Sprint(row)
+		if seen[k] {
+			return
+		}
+		seen[k] = true
+		rows = append(rows, hillRow{row: append([]int{}, row...), score: score})
+	}
+	row := make([]int, n)
+	if n <= exhaustiveHillRows {
+		var try func(j int)
+		try = func(j int) {
+			if j == n {
+				add(row, rowScore(row))
+				return
+			}
+			for x := 0; x < alphabetSize; x++ {
+				row[j] = x
+				try(j + 1)
+			}
+		}
+		try(0)
+	} else {
+		for climb := 0; climb < hillRowClimbs; climb++ {
+			for j := range row {
+				row[j] = opts.Rand.Intn(alphabetSize)
+			}
+			score := rowScore(row)
+			for improved := true; improved; {
+				improved = false
+				for j := range row {
+					current := row[j]
+					for x := 0; x < alphabetSize; x++ {
+						row[j] = x
+						if s := rowScore(row); s < score {
+							score, current, improved = s, x, true
+						}
+					}
+					row[j] = current
+				}
+			}
+			add(row, score)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].score < rows[j].score
+	})
+	if len(rows) > opts.Candidates {
+		rows = rows[:opts.Candidates]
+	}
+	return rows
+}
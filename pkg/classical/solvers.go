@@ -0,0 +1,278 @@
+package classical
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
+)
+
+// defaultMaxKeylen is the longest Vigenere Key or Autokey Primer the solvers try if no maximum is given
+const defaultMaxKeylen = 20
+
+// Key lengths whose index of coincidence is within this fraction of the best are tried as Vigenere Keys
+const keylenTolerance = 0.1
+
+// the most times refineVigenere goes over the Key
+const vigenereRefinePasses = 3
+
+// english letters, most frequent first, as the solver's first guess at a Substitution
+const englishByFrequency = "etaoinshrdlcumwfgypbvkjxqz"
+
+// SolveCaesar tries every shift and returns the one whose Plaintext s likes best (pals.EnglishQuadgrams if nil)
+func SolveCaesar(c []byte, s pals.Scorer) (Caesar, []byte) {
+	s = scorer(s)
+	scores := make([]float64, alphabetSize)
+	for shift := range scores {
+		scores[shift] = s.Score(Caesar{Shift: shift}.Decrypt(c))
+	}
+	k := Caesar{Shift: best(scores)}
+	return k, k.Decrypt(c)
+}
+
+// SolveAffine tries every reversible Affine Key and returns the one whose Plaintext s likes best
+func SolveAffine(c []byte, s pals.Scorer) (Affine, []byte) {
+	s = scorer(s)
+	var keys []Affine
+	var scores []float64
+	for a := 1; a < alphabetSize; a++ {
+		for b := 0; b < alphabetSize; b++ {
+			k, err := NewAffine(a, b)
+			if err != nil {
+				break
+			}
+			keys = append(keys, k)
+			scores = append(scores, s.Score(k.Decrypt(c)))
+		}
+	}
+	k := keys[best(scores)]
+	return k, k.Decrypt(c)
+}
+
+// VigenereKeylens ranks the possible Key lengths by the mean index of coincidence of the columns of letters
+// they split the Ciphertext into, highest first. Only lengths that leave two letters in every column are ranked.
+func VigenereKeylens(c []byte, maxKeylen int) []int {
+	if maxKeylen <= 0 {
+		maxKeylen = defaultMaxKeylen
+	}
+	l := Letters(c)
+	var lens []int
+	ioc := map[int]float64{}
+	for n := 1; n <= maxKeylen && 2*n <= len(l); n++ {
+		var total float64
+		for _, col := range columns(l, n) {
+			total += IndexOfCoincidenceOf(col)
+		}
+		ioc[n] = total / float64(n)
+		lens = append(lens, n)
+	}
+	sort.SliceStable(lens, func(i, j int) bool {
+		return ioc[lens[i]] > ioc[lens[j]]
+	})
+	return lens
+}
+
+// SolveVigenere finds the Key length from the index of coincidence, solves each column of letters as a
+// Caesar cipher by letter frequency, and of the Key lengths that look about as likely as the best, returns
+// the Key whose Plaintext s likes best. A multiple of the Key length would also fit, so ties go to the shortest.
+func SolveVigenere(c []byte, maxKeylen int, s pals.Scorer) (Vigenere, []byte) {
+	s = scorer(s)
+	lens := VigenereKeylens(c, maxKeylen)
+	if len(lens) == 0 {
+		return Vigenere{key: []byte{0}}, c
+	}
+	l := Letters(c)
+	bestIoC := columnsIoC(l, lens[0])
+	var keys []Vigenere
+	var scores []float64
+	for _, n := range lens {
+		if columnsIoC(l, n) < bestIoC*(1-keylenTolerance) {
+			break
+		}
+		k := Vigenere{key: make([]byte, n)}
+		for j, col := range columns(l, n) {
+			caesar, _ := SolveCaesar(lettersText(col), pals.LetterFrequencyScorer)
+			k.key[j] = byte(caesar.Shift)
+		}
+		refineVigenere(c, k, s)
+		keys = append(keys, k)
+		// a longer Key must do clearly better to be preferred
+		scores = append(scores, s.Score(k.Decrypt(c))*(1+0.001*float64(n)))
+	}
+	k := keys[best(scores)]
+	return k, k.Decrypt(c)
+}
+
+// refineVigenere re-picks each Key letter in turn by the score of the whole Plaintext, which sees the
+// letters around each column, until no letter changes
+func refineVigenere(c []byte, k Vigenere, s pals.Scorer) {
+	for pass := 0; pass < vigenereRefinePasses; pass++ {
+		changed := false
+		for j := range k.key {
+			current := k.key[j]
+			scores := make([]float64, alphabetSize)
+			for shift := range scores {
+				k.key[j] = byte(shift)
+				scores[shift] = s.Score(k.Decrypt(c))
+			}
+			k.key[j] = byte(best(scores))
+			changed = changed || k.key[j] != current
+		}
+		if !changed {
+			return
+		}
+	}
+}
+
+// SolveAutokey tries every Primer length. With a Primer of length n, letter i of the Plaintext depends
+// only on letter i-n and the Ciphertext, so each of the n columns follows from a single Primer letter and
+// can be solved alone by letter frequency. The Primer whose Plaintext s likes best is returned.
+func SolveAutokey(c []byte, maxPrimer int, s pals.Scorer) (Autokey, []byte) {
+	s = scorer(s)
+	if maxPrimer <= 0 {
+		maxPrimer = defaultMaxKeylen
+	}
+	l := Letters(c)
+	var keys []Autokey
+	var scores []float64
+	for n := 1; n <= maxPrimer && n <= len(l); n++ {
+		k := Autokey{primer: make([]byte, n)}
+		for j, col := range columns(l, n) {
+			colScores := make([]float64, alphabetSize)
+			for shift := range colScores {
+				colScores[shift] = pals.LetterFrequencyScorer.Score(lettersText(autokeyColumn(col, shift)))
+			}
+			k.primer[j] = byte(best(colScores))
+		}
+		keys = append(keys, k)
+		scores = append(scores, s.Score(k.Decrypt(c))*(1+0.001*float64(n)))
+	}
+	if len(keys) == 0 {
+		return Autokey{primer: []byte{0}}, c
+	}
+	k := keys[best(scores)]
+	return k, k.Decrypt(c)
+}
+
+// autokeyColumn decrypts one column of an Autokey Ciphertext given the Primer letter that starts it
+func autokeyColumn(col []int, primer int) []int {
+	p := make([]int, len(col))
+	k := primer
+	for i, c := range col {
+		p[i] = Mod(c-k, alphabetSize)
+		k = p[i]
+	}
+	return p
+}
+
+func columns(l []int, n int) [][]int {
+	cols := make([][]int, n)
+	for i, x := range l {
+		cols[i%n] = append(cols[i%n], x)
+	}
+	return cols
+}
+
+func columnsIoC(l []int, n int) float64 {
+	var total float64
+	for _, col := range columns(l, n) {
+		total += IndexOfCoincidenceOf(col)
+	}
+	return total / float64(n)
+}
+
+func lettersText(l []int) []byte {
+	b := make([]byte, len(l))
+	for i, x := range l {
+		b[i] = letter(x, false)
+	}
+	return b
+}
+
+// SubstitutionOptions configure SolveSubstitution
+type SubstitutionOptions struct {
+	// Scorer judges the Plaintexts, pals.EnglishQuadgrams if nil. It should look at runs of letters,
+	// since every Substitution gives the same letter frequencies in some order.
+	Scorer pals.Scorer
+	// Iterations is the number of swaps tried in each restart, defaultAnnealIterations if 0
+	Iterations int
+	// Restarts is the number of rounds of annealing, the first from the frequency guess and each later one
+	// from the best Key so far; defaultAnnealRestarts if 0
+	Restarts int
+	// Temperature is the starting temperature, which falls linearly to 0; defaultAnnealTemperature if 0
+	Temperature float64
+	// Rand drives the search; a fixed seed makes it repeatable
+	Rand *rand.Rand
+}
+
+const (
+	defaultAnnealIterations  = 10000
+	defaultAnnealRestarts    = 3
+	defaultAnnealTemperature = 0.05
+)
+
+// SolveSubstitution finds a Substitution by simulated annealing. It starts by matching the Ciphertext's
+// letter frequencies to english, then swaps pairs of letters, keeping every swap that improves the score
+// and, while the temperature is high, some that don't, to climb out of local optima.
+func SolveSubstitution(c []byte, opts SubstitutionOptions) (Substitution, []byte) {
+	s := scorer(opts.Scorer)
+	iterations := opts.Iterations
+	if iterations == 0 {
+		iterations = defaultAnnealIterations
+	}
+	restarts := opts.Restarts
+	if restarts == 0 {
+		restarts = defaultAnnealRestarts
+	}
+	temperature := opts.Temperature
+	if temperature == 0 {
+		temperature = defaultAnnealTemperature
+	}
+	rng := opts.Rand
+	if rng == nil {
+		rng = rand.New(rand.NewSource(1))
+	}
+
+	start := frequencyGuess(c)
+	bestKey, bestScore := start, s.Score(start.Decrypt(c))
+	for r := 0; r < restarts; r++ {
+		key, score := start, bestScore
+		for i := 0; i < iterations; i++ {
+			t := temperature * (1 - float64(i)/float64(iterations))
+			next := key
+			a, b := rng.Intn(alphabetSize), rng.Intn(alphabetSize)
+			next.Alphabet[a], next.Alphabet[b] = next.Alphabet[b], next.Alphabet[a]
+			nextScore := s.Score(next.Decrypt(c))
+			if d := nextScore - score; d < 0 || (t > 0 && rng.Float64() < math.Exp(-d/t)) {
+				key, score = next, nextScore
+				if score < bestScore {
+					bestKey, bestScore = key, score
+				}
+			}
+		}
+		// later restarts begin from the best so far
+		start = bestKey
+	}
+	return bestKey, bestKey.Decrypt(c)
+}
+
+// frequencyGuess maps the most frequent Ciphertext letter to e, the next to t, and so on
+func frequencyGuess(c []byte) Substitution {
+	var counts [alphabetSize]int
+	for _, i := range Letters(c) {
+		counts[i]++
+	}
+	order := make([]int, alphabetSize)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return counts[order[i]] > counts[order[j]]
+	})
+	var k Substitution
+	for rank, cipherLetter := range order {
+		k.Alphabet[englishByFrequency[rank]-'a'] = byte(cipherLetter)
+	}
+	return k
+}
@@ -0,0 +1,382 @@
+package classical
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
+)
+
+// Transposition ciphers move characters rather than change them, so unlike the ciphers in classical.go
+// they work on every byte of the text: spaces and punctuation are moved along with the letters.
+
+// Columnar writes the text in rows as wide as the Key and reads it out a column at a time, in Order.
+// An Order that is not a permutation of the columns 0 to n-1, such as no Order at all, which NewColumnar
+// never makes, leaves the text as it is.
+type Columnar struct {
+	// Order lists the columns in the order they are read: Order[0] is the column read first
+	Order []int
+	// Pad, if not 0, fills out the last row so that every column is the same length. Decrypt leaves
+	// the padding on the end of the Plaintext.
+	Pad byte
+}
+
+// NewColumnar reads the columns in the alphabetical order of the letters of the Key, left to right where
+// a letter repeats. pad is the filler for the last row, or 0 to leave it short.
+func NewColumnar(key string, pad byte) (Columnar, error) {
+	shifts, err := keyShifts(key)
+	if err != nil {
+		return Columnar{}, err
+	}
+	order := make([]int, len(shifts))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return shifts[order[i]] < shifts[order[j]]
+	})
+	return Columnar{Order: order, Pad: pad}, nil
+}
+
+func (c Columnar) Encrypt(plain []byte) []byte {
+	n := len(c.Order)
+	if !c.valid() {
+		return append([]byte{}, plain...)
+	}
+	if c.Pad != 0 && len(plain)%n != 0 {
+		plain = append(append([]byte{}, plain...), bytes.Repeat([]byte{c.Pad}, n-len(plain)%n)...)
+	}
+	out := make([]byte, 0, len(plain))
+	for _, col := range c.Order {
+		for i := col; i < len(plain); i += n {
+			out = append(out, plain[i])
+		}
+	}
+	return out
+}
+
+// Decrypt works out the length of each column from the length of the Ciphertext, so a padded Ciphertext
+// decrypts the same with or without Pad set
+func (c Columnar) Decrypt(e []byte) []byte {
+	n := len(c.Order)
+	if !c.valid() {
+		return append([]byte{}, e...)
+	}
+	out := make([]byte, len(e))
+	var read int
+	for _, col := range c.Order {
+		for i := col; i < len(e); i += n {
+			out[i] = e[read]
+			read++
+		}
+	}
+	return out
+}
+
+// valid reports whether the Order is a permutation of the columns
+func (c Columnar) valid() bool {
+	if len(c.Order) == 0 {
+		return false
+	}
+	seen := make([]bool, len(c.Order))
+	for _, col := range c.Order {
+		if col < 0 || col >= len(c.Order) || seen[col] {
+			return false
+		}
+		seen[col] = true
+	}
+	return true
+}
+
+// DoubleTransposition encrypts with the First Columnar and then again with the Second
+type DoubleTransposition struct {
+	First, Second Columnar
+}
+
+func (c DoubleTransposition) Encrypt(plain []byte) []byte {
+	return c.Second.Encrypt(c.First.Encrypt(plain))
+}
+
+func (c DoubleTransposition) Decrypt(e []byte) []byte {
+	return c.First.Decrypt(c.Second.Decrypt(e))
+}
+
+// RailFence writes the text in a zigzag down and up the Rails and reads it out a rail at a time
+type RailFence struct {
+	Rails int
+}
+
+// NewRailFence checks that there is more than one rail
+func NewRailFence(rails int) (RailFence, error) {
+	if rails < 2 {
+		return RailFence{}, fmt.Errorf("a rail fence needs at least 2 rails, got %d", rails)
+	}
+	return RailFence{Rails: rails}, nil
+}
+
+// rail is the rail that character i is written on
+func (c RailFence) rail(i int) int {
+	if c.Rails < 2 {
+		return 0
+	}
+	cycle := 2 * (c.Rails - 1)
+	r := i % cycle
+	if r >= c.Rails {
+		r = cycle - r
+	}
+	return r
+}
+
+// positions lists the Plaintext positions in the order they are read off the rails
+func (c RailFence) positions(n int) []int {
+	p := make([]int, n)
+	for i := range p {
+		p[i] = i
+	}
+	sort.SliceStable(p, func(i, j int) bool {
+		return c.rail(p[i]) < c.rail(p[j])
+	})
+	return p
+}
+
+func (c RailFence) Encrypt(plain []byte) []byte {
+	out := make([]byte, len(plain))
+	for j, i := range c.positions(len(plain)) {
+		out[j] = plain[i]
+	}
+	return out
+}
+
+func (c RailFence) Decrypt(e []byte) []byte {
+	out := make([]byte, len(e))
+	for j, i := range c.positions(len(e)) {
+		out[i] = e[j]
+	}
+	return out
+}
+
+// TranspositionOptions configure the transposition solvers
+type TranspositionOptions struct {
+	// Scorer judges the Plaintexts, pals.EnglishQuadgrams if nil. Every transposition has the same
+	// byte frequencies, so it must look at runs of bytes.
+	Scorer pals.Scorer
+	// MaxKeylen is the longest Key tried, defaultMaxTranspositionKeylen if 0
+	MaxKeylen int
+	// Restarts is the number of hill climbs from a random order for each Key length that is too long
+	// to try every order of, defaultClimbRestarts if 0
+	Restarts int
+	// Iterations is the number of changes tried in each hill climb, defaultClimbIterations if 0
+	Iterations int
+	// Rand drives the hill climbs; a fixed seed makes them repeatable
+	Rand *rand.Rand
+}
+
+const (
+	defaultMaxTranspositionKeylen = 10
+	defaultClimbRestarts          = 5
+	defaultClimbIterations        = 2000
+	// Key lengths with at most this many orders between them are searched exhaustively
+	exhaustiveOrders = 5040
+)
+
+func (opts TranspositionOptions) withDefaults() TranspositionOptions {
+	opts.Scorer = scorer(opts.Scorer)
+	if opts.MaxKeylen == 0 {
+		opts.MaxKeylen = defaultMaxTranspositionKeylen
+	}
+	if opts.Restarts == 0 {
+		opts.Restarts = defaultClimbRestarts
+	}
+	if opts.Iterations == 0 {
+		opts.Iterations = defaultClimbIterations
+	}
+	if opts.Rand == nil {
+		opts.Rand = rand.New(rand.NewSource(1))
+	}
+	return opts
+}
+
+// SolveRailFence tries every number of rails up to maxRails, or up to the length of the text if maxRails
+// is 0, and returns the one whose Plaintext s likes best
+func SolveRailFence(c []byte, maxRails int, s pals.Scorer) (RailFence, []byte) {
+	s = scorer(s)
+	if maxRails <= 0 || maxRails > len(c) {
+		maxRails = len(c)
+	}
+	var keys []RailFence
+	var scores []float64
+	for rails := 2; rails <= maxRails; rails++ {
+		k := RailFence{Rails: rails}
+		keys = append(keys, k)
+		scores = append(scores, s.Score(k.Decrypt(c)))
+	}
+	if len(keys) == 0 {
+		return RailFence{Rails: 2}, c
+	}
+	k := keys[best(scores)]
+	return k, k.Decrypt(c)
+}
+
+// SolveColumnar tries every Key length up to opts.MaxKeylen. Short Keys have few enough orders to try
+// them all, and the orders of longer ones are found by hill climbing. Padding does not change how a
+// Ciphertext is read, so the Columnar returned has no Pad.
+func SolveColumnar(c []byte, opts TranspositionOptions) (Columnar, []byte) {
+	opts = opts.withDefaults()
+	var keys []Columnar
+	var scores []float64
+	for n := 2; n <= opts.MaxKeylen && n <= len(c); n++ {
+		orders, score := searchOrders([]int{n}, func(orders [][]int) []byte {
+			return Columnar{Order: orders[0]}.Decrypt(c)
+		}, opts)
+		keys = append(keys, Columnar{Order: orders[0]})
+		scores = append(scores, score)
+	}
+	if len(keys) == 0 {
+		return Columnar{Order: []int{0}}, c
+	}
+	k := keys[best(scores)]
+	return k, k.Decrypt(c)
+}
+
+// SolveDoubleTransposition tries every pair of Key lengths up to opts.MaxKeylen, searching the orders of
+// both Keys together, since neither transposition alone gives a Plaintext that scores better than the others
+func SolveDoubleTransposition(c []byte, opts TranspositionOptions) (DoubleTransposition, []byte) {
+	opts = opts.withDefaults()
+	var keys []DoubleTransposition
+	var scores []float64
+	for n1 := 2; n1 <= opts.MaxKeylen && n1 <= len(c); n1++ {
+		for n2 := 2; n2 <= opts.MaxKeylen && n2 <= len(c); n2++ {
+			orders, score := searchOrders([]int{n1, n2}, func(orders [][]int) []byte {
+				return DoubleTransposition{Columnar{Order: orders[0]}, Columnar{Order: orders[1]}}.Decrypt(c)
+			}, opts)
+			keys = append(keys, DoubleTransposition{Columnar{Order: orders[0]}, Columnar{Order: orders[1]}})
+			scores = append(scores, score)
+		}
+	}
+	if len(keys) == 0 {
+		return DoubleTransposition{Columnar{Order: []int{0}}, Columnar{Order: []int{0}}}, c
+	}
+	k := keys[best(scores)]
+	return k, k.Decrypt(c)
+}
+
+// searchOrders finds the column orders, one of each length, whose decryption the Scorer likes best. Every
+// combination is tried if there are at most exhaustiveOrders of them; otherwise they are hill climbed.
+func searchOrders(lens []int, decrypt func(orders [][]int) []byte, opts TranspositionOptions) ([][]int, float64) {
+	combinations := 1
+	for _, n := range lens {
+		combinations *= factorial(n)
+		if combinations > exhaustiveOrders {
+			return climbOrders(lens, decrypt, opts)
+		}
+	}
+	orders := make([][]int, len(lens))
+	var bestOrders [][]int
+	var bestScore float64
+	var try func(k int)
+	try = func(k int) {
+		if k == len(lens) {
+			if score := opts.Scorer.Score(decrypt(orders)); bestOrders == nil || score < bestScore {
+				bestOrders, bestScore = copyOrders(orders), score
+			}
+			return
+		}
+		permutations(lens[k], func(p []int) {
+			orders[k] = p
+			try(k + 1)
+		})
+	}
+	try(0)
+	return bestOrders, bestScore
+}
+
+// climbOrders hill climbs from random orders, trying a swap of two columns, a move of one column or the
+// reversal of a run of columns in one of the orders at each step and keeping it if the score improves
+func climbOrders(lens []int, decrypt func(orders [][]int) []byte, opts TranspositionOptions) ([][]int, float64) {
+	rng := opts.Rand
+	var bestOrders [][]int
+	var bestScore float64
+	for r := 0; r < opts.Restarts; r++ {
+		orders := make([][]int, len(lens))
+		for k, n := range lens {
+			orders[k] = rng.Perm(n)
+		}
+		score := opts.Scorer.Score(decrypt(orders))
+		for i := 0; i < opts.Iterations; i++ {
+			k := rng.Intn(len(lens))
+			current := orders[k]
+			orders[k] = changeOrder(current, rng)
+			if next := opts.Scorer.Score(decrypt(orders)); next < score {
+				score = next
+				continue
+			}
+			orders[k] = current
+		}
+		if bestOrders == nil || score < bestScore {
+			bestOrders, bestScore = copyOrders(orders), score
+		}
+	}
+	return bestOrders, bestScore
+}
+
+// changeOrder returns a copy of the order with one random change made to it
+func changeOrder(order []int, rng *rand.Rand) []int {
+	next := append([]int{}, order...)
+	i, j := rng.Intn(len(next)), rng.Intn(len(next))
+	if i > j {
+		i, j = j, i
+	}
+	switch rng.Intn(3) {
+	case 0:
+		next[i], next[j] = next[j], next[i]
+	case 1:
+		// move the column at i to j
+		col := next[i]
+		copy(next[i:j], next[i+1:j+1])
+		next[j] = col
+	default:
+		for ; i < j; i, j = i+1, j-1 {
+			next[i], next[j] = next[j], next[i]
+		}
+	}
+	return next
+}
+
+// permutations calls f with every permutation of 0..n-1, reusing the slice between calls
+func permutations(n int, f func(p []int)) {
+	p := make([]int, n)
+	for i := range p {
+		p[i] = i
+	}
+	var permute func(k int)
+	permute = func(k int) {
+		if k == n {
+			f(p)
+			return
+		}
+		for i := k; i < n; i++ {
+			p[k], p[i] = p[i], p[k]
+			permute(k + 1)
+			p[k], p[i] = p[i], p[k]
+		}
+	}
+	permute(0)
+}
+
+func factorial(n int) int {
+	f := 1
+	for i := 2; i <= n; i++ {
+		f *= i
+	}
+	return f
+}
+
+func copyOrders(orders [][]int) [][]int {
+	c := make([][]int, len(orders))
+	for k, o := range orders {
+		c[k] = append([]int{}, o...)
+	}
+	return c
+}
@@ -0,0 +1,301 @@
+package enigma
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/classical"
+)
+
+// CribOffsets lists the offsets, counted in letters, at which the crib could lie in the Ciphertext. Enigma
+// never encrypts a letter to itself, so an offset where any letter of the crib matches the Ciphertext is ruled out.
+func CribOffsets(c, crib []byte) []int {
+	e, p := classical.Letters(c), classical.Letters(crib)
+	var offsets []int
+	for offset := 0; offset+len(p) <= len(e); offset++ {
+		ok := true
+		for i, x := range p {
+			if e[offset+i] == x {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			offsets = append(offsets, offset)
+		}
+	}
+	return offsets
+}
+
+// BombeOptions configure Bombe
+type BombeOptions struct {
+	// Rotors are the rotors tried in every order, I to V if nil
+	Rotors []string
+	// Reflector is B if empty
+	Reflector string
+	// Rings are the ring settings assumed, AAA if not set. Turning a ring turns the wiring with it, so with
+	// the wrong rings the bombe still stops at the positions that match the crib, off by the difference,
+	// as long as no rotor turns over at a different point within the crib.
+	Rings [3]int
+	// Workers is the number of rotor orders run at once, runtime.NumCPU() if 0
+	Workers int
+}
+
+// Stop is a setting the bombe could not rule out: rotors and positions, and the plugboard pairs that
+// follow from the crib if they are right
+type Stop struct {
+	Settings
+	// Plugged is the number of letters whose plugboard partner the crib fixes, including unplugged ones
+	Plugged int
+}
+
+// Bombe tries every order of the rotors at every start position, the crib lying offset letters into the
+// Ciphertext. Like Turing's bombe it guesses the plugboard partner of the letter of the crib with most links,
+// follows what that implies through every crib letter and its Ciphertext letter, and rules the position out
+// if every guess leads to a letter plugged to two others. A menu with few loops gives many stops, each
+// of which needs checking. Rotor orders run in parallel.
+func Bombe(c, crib []byte, offset int, opts BombeOptions) ([]Stop, error) {
+	e, p := classical.Letters(c), classical.Letters(crib)
+	if offset < 0 || offset+len(p) > len(e) {
+		return nil, fmt.Errorf("crib of %d letters at offset %d does not fit in %d letters of Ciphertext", len(p), offset, len(e))
+	}
+	if len(p) == 0 {
+		return nil, fmt.Errorf("empty crib")
+	}
+	for i, x := range p {
+		if e[offset+i] == x {
+			return nil, fmt.Errorf("crib letter %d encrypts to itself, which Enigma can't do", i)
+		}
+	}
+	rotors := opts.Rotors
+	if rotors == nil {
+		rotors = []string{"I", "II", "III", "IV", "V"}
+	}
+	reflector := opts.Reflector
+	if reflector == "" {
+		reflector = "B"
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	orders := rotorOrders(rotors)
+	for _, order := range orders {
+		if _, err := New(Settings{Rotors: order, Reflector: reflector}); err != nil {
+			return nil, err
+		}
+	}
+	menu := newMenu(p, e[offset:offset+len(p)])
+	if menu.loops() == 0 {
+		return nil, fmt.Errorf("the menu of a %d letter crib has no loops, so it can't rule out any position", len(p))
+	}
+
+	jobs := make(chan [3]string)
+	var mu sync.Mutex
+	var stops []Stop
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for order := range jobs {
+				found := menu.run(Settings{Rotors: order, Reflector: reflector, Rings: opts.Rings}, offset)
+				mu.Lock()
+				stops = append(stops, found...)
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, order := range orders {
+		jobs <- order
+	}
+	close(jobs)
+	wg.Wait()
+
+	index := make(map[[3]string]int)
+	for i, order := range orders {
+		index[order] = i
+	}
+	sort.Slice(stops, func(i, j int) bool {
+		a, b := stops[i], stops[j]
+		if index[a.Rotors] != index[b.Rotors] {
+			return index[a.Rotors] < index[b.Rotors]
+		}
+		if a.Positions != b.Positions {
+			return positionIndex(a.Positions) < positionIndex(b.Positions)
+		}
+		return a.Plugboard < b.Plugboard
+	})
+	return stops, nil
+}
+
+// rotorOrders lists every way to put three of the rotors in the machine
+func rotorOrders(rotors []string) [][3]string {
+	var orders [][3]string
+	for _, l := range rotors {
+		for _, m := range rotors {
+			for _, r := range rotors {
+				if l != m && m != r && l != r {
+					orders = append(orders, [3]string{l, m, r})
+				}
+			}
+		}
+	}
+	return orders
+}
+
+func positionIndex(p [3]int) int {
+	return (p[0]*alphabetSize+p[1])*alphabetSize + p[2]
+}
+
+// link says that the letter at crib index i is wired, through the scrambler at that index, to other
+type link struct {
+	i, other int
+}
+
+// menu is the crib drawn as a graph of letters, linked where one encrypts to the other
+type menu struct {
+	links [alphabetSize][]link
+	// test is the letter whose plugboard partner is guessed, the one with most links
+	test int
+	size int
+}
+
+func newMenu(p, e []int) *menu {
+	m := &menu{size: len(p)}
+	for i := range p {
+		m.links[p[i]] = append(m.links[p[i]], link{i, e[i]})
+		m.links[e[i]] = append(m.links[e[i]], link{i, p[i]})
+	}
+	for x := range m.links {
+		if len(m.links[x]) > len(m.links[m.test]) {
+			m.test = x
+		}
+	}
+	return m
+}
+
+// loops is the number of independent loops in the menu. Each loop is a check on a guess, and a menu
+// without one can't rule anything out.
+func (mn *menu) loops() int {
+	var parent [alphabetSize]int
+	for x := range parent {
+		parent[x] = x
+	}
+	var find func(x int) int
+	find = func(x int) int {
+		if parent[x] != x {
+			parent[x] = find(parent[x])
+		}
+		return parent[x]
+	}
+	var loops int
+	for x, links := range mn.links {
+		for _, l := range links {
+			// each link is listed from both ends, so only count it from one
+			if x > l.other {
+				continue
+			}
+			a, b := find(x), find(l.other)
+			if a == b {
+				loops++
+				continue
+			}
+			parent[a] = b
+		}
+	}
+	return loops
+}
+
+// scramblers are the unplugged scramblers at each crib index, each letter worked out on first use
+type scramblers struct {
+	m         *Machine
+	positions [][3]int
+	// wiring holds -1 for letters not yet worked out
+	wiring [][alphabetSize]int
+}
+
+// at passes x through the scrambler at crib index i
+func (sc *scramblers) at(i, x int) int {
+	if sc.wiring[i][x] == -1 {
+		sc.m.positions = sc.positions[i]
+		y := sc.m.scramble(x)
+		sc.wiring[i][x], sc.wiring[i][y] = y, x
+	}
+	return sc.wiring[i][x]
+}
+
+// run tries every start position of one rotor order
+func (mn *menu) run(s Settings, offset int) []Stop {
+	m, err := New(s)
+	if err != nil {
+		return nil
+	}
+	sc := &scramblers{m: m, positions: make([][3]int, mn.size), wiring: make([][alphabetSize]int, mn.size)}
+	var stops []Stop
+	for start := 0; start < alphabetSize*alphabetSize*alphabetSize; start++ {
+		s.Positions = [3]int{start / (alphabetSize * alphabetSize), start / alphabetSize % alphabetSize, start % alphabetSize}
+		m.positions = s.Positions
+		for i := 0; i < offset; i++ {
+			m.step()
+		}
+		for i := range sc.positions {
+			m.step()
+			sc.positions[i] = m.positions
+			for x := range sc.wiring[i] {
+				sc.wiring[i][x] = -1
+			}
+		}
+		for guess := 0; guess < alphabetSize; guess++ {
+			if plugboard, plugged, ok := mn.follow(guess, sc); ok {
+				stop := Stop{Settings: s, Plugged: plugged}
+				stop.Plugboard = formatPlugboard(plugboard)
+				stops = append(stops, stop)
+			}
+		}
+	}
+	return stops
+}
+
+// follow guesses the plugboard partner of the test letter and follows the links from every letter whose
+// partner is known, returning false at the first letter that would be plugged to two others. Letters the
+// crib says nothing about are left unplugged.
+func (mn *menu) follow(guess int, sc *scramblers) ([alphabetSize]int, int, bool) {
+	var plugboard [alphabetSize]int
+	for x := range plugboard {
+		plugboard[x] = -1
+	}
+	var queue []int
+	var plugged int
+	plug := func(a, b int) bool {
+		if plugboard[a] == -1 && plugboard[b] == -1 {
+			plugboard[a], plugboard[b] = b, a
+			queue = append(queue, a)
+			plugged++
+			if a != b {
+				queue = append(queue, b)
+				plugged++
+			}
+			return true
+		}
+		return plugboard[a] == b
+	}
+	plug(mn.test, guess)
+	for len(queue) > 0 {
+		x := queue[0]
+		queue = queue[1:]
+		for _, l := range mn.links[x] {
+			if !plug(l.other, sc.at(l.i, plugboard[x])) {
+				return plugboard, plugged, false
+			}
+		}
+	}
+	for x := range plugboard {
+		if plugboard[x] == -1 {
+			plugboard[x] = x
+		}
+	}
+	return plugboard, plugged, true
+}
@@ -0,0 +1,237 @@
+// Package enigma simulates the three rotor Enigma machine of the German army and air force, and attacks
+// it the way Bletchley Park did: a bombe to find the rotors from a crib, then the plugboard by hand.
+package enigma
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/classical"
+)
+
+const alphabetSize = 26
+
+// Rotor is the wiring of a rotor, the letter each of A to Z is wired to, and the window letters at which
+// it turns over the rotor to its left
+type Rotor struct {
+	Wiring  string
+	Notches string
+}
+
+// Rotors are the rotors of the army, air force and navy machines
+var Rotors = map[string]Rotor{
+	"I":    {"EKMFLGDQVZNTOWYHXUSPAIBRCJ", "Q"},
+	"II":   {"AJDKSIRUXBLHWTMCQGZNPYFVOE", "E"},
+	"III":  {"BDFHJLCPRTXVZNYEIWGAKMUSQO", "V"},
+	"IV":   {"ESOVPZJAYQUIRHXLNFTGKDCMWB", "J"},
+	"V":    {"VZBRGITYUPSDNHLXAWMJQOFECK", "Z"},
+	"VI":   {"JPGVOUMFYQBENHZRDKASXLICTW", "ZM"},
+	"VII":  {"NZJHGRCXMYSWBOUFAIVLPEKQDT", "ZM"},
+	"VIII": {"FKQHTLXOCBJSPDZRAMEWNIUYGV", "ZM"},
+}
+
+// Reflectors are the wirings of the reflectors, which pair the letters up
+var Reflectors = map[string]string{
+	"A": "EJMZALYXVBWFCRQUONTSPIKHGD",
+	"B": "YRUHQSLDPXNGOKMIEBFZCWVJAT",
+	"C": "FVPJIAOYEDRZXWGCTKUQSBNMHL",
+}
+
+// Settings are the key of an Enigma message. Rotors and their settings are listed from left to right,
+// and letters are numbered from 0 for A.
+type Settings struct {
+	Rotors    [3]string
+	Reflector string
+	// Rings are the ring settings, which turn the wiring against the letters on the rim
+	Rings [3]int
+	// Positions are the letters showing in the windows at the start of the message
+	Positions [3]int
+	// Plugboard lists the swapped pairs of letters, as in "AV BS CG"
+	Plugboard string
+}
+
+// ParseLetters reads three window or ring letters, as in "BLA"
+func ParseLetters(s string) ([3]int, error) {
+	var l [3]int
+	if len(s) != 3 {
+		return l, fmt.Errorf("want 3 letters, got %q", s)
+	}
+	for i := range l {
+		x, ok := letterIndex(s[i])
+		if !ok {
+			return l, fmt.Errorf("%q is not a letter in %q", s[i], s)
+		}
+		l[i] = x
+	}
+	return l, nil
+}
+
+// FormatLetters writes three window or ring positions as letters
+func FormatLetters(l [3]int) string {
+	return string([]byte{byte('A' + l[0]), byte('A' + l[1]), byte('A' + l[2])})
+}
+
+func (s Settings) String() string {
+	return fmt.Sprintf("rotors %s reflector %s rings %s positions %s plugboard %q",
+		strings.Join(s.Rotors[:], "-"), s.Reflector, FormatLetters(s.Rings), FormatLetters(s.Positions), s.Plugboard)
+}
+
+type rotor struct {
+	forward, backward [alphabetSize]int
+	notch             [alphabetSize]bool
+	ring              int
+}
+
+// Machine is an Enigma set up with Settings. It steps as it encrypts, so each message needs a new Machine.
+type Machine struct {
+	rotors    [3]rotor
+	positions [3]int
+	reflector [alphabetSize]int
+	plugboard [alphabetSize]int
+}
+
+// New sets up a Machine, checking that the rotors and reflector exist, no rotor is used twice and no
+// letter is plugged twice
+func New(s Settings) (*Machine, error) {
+	m := &Machine{positions: s.Positions}
+	for i, name := range s.Rotors {
+		w, ok := Rotors[name]
+		if !ok {
+			return nil, fmt.Errorf("no rotor %q", name)
+		}
+		for j := 0; j < i; j++ {
+			if s.Rotors[j] == name {
+				return nil, fmt.Errorf("rotor %s is used twice", name)
+			}
+		}
+		r := &m.rotors[i]
+		r.ring = classical.Mod(s.Rings[i], alphabetSize)
+		for x := 0; x < alphabetSize; x++ {
+			y := int(w.Wiring[x] - 'A')
+			r.forward[x] = y
+			r.backward[y] = x
+		}
+		for _, n := range w.Notches {
+			r.notch[n-'A'] = true
+		}
+		m.positions[i] = classical.Mod(m.positions[i], alphabetSize)
+	}
+	reflector, ok := Reflectors[s.Reflector]
+	if !ok {
+		return nil, fmt.Errorf("no reflector %q", s.Reflector)
+	}
+	for x := range m.reflector {
+		m.reflector[x] = int(reflector[x] - 'A')
+	}
+	plugboard, err := parsePlugboard(s.Plugboard)
+	if err != nil {
+		return nil, err
+	}
+	m.plugboard = plugboard
+	return m, nil
+}
+
+// parsePlugboard reads pairs of letters separated by spaces into the swap of each letter
+func parsePlugboard(s string) ([alphabetSize]int, error) {
+	var p [alphabetSize]int
+	for x := range p {
+		p[x] = x
+	}
+	for _, pair := range strings.Fields(s) {
+		if len(pair) != 2 {
+			return p, fmt.Errorf("plugboard pair %q is not two letters", pair)
+		}
+		a, okA := letterIndex(pair[0])
+		b, okB := letterIndex(pair[1])
+		if !okA || !okB || a == b {
+			return p, fmt.Errorf("plugboard pair %q is not two different letters", pair)
+		}
+		if p[a] != a || p[b] != b {
+			return p, fmt.Errorf("plugboard pair %q uses a letter that is already plugged", pair)
+		}
+		p[a], p[b] = b, a
+	}
+	return p, nil
+}
+
+// formatPlugboard writes the swap of each letter as pairs, in alphabetical order
+func formatPlugboard(p [alphabetSize]int) string {
+	var pairs []string
+	for a, b := range p {
+		if a < b {
+			pairs = append(pairs, string([]byte{byte('A' + a), byte('A' + b)}))
+		}
+	}
+	return strings.Join(pairs, " ")
+}
+
+// Positions returns the letters showing in the windows now
+func (m *Machine) Positions() [3]int {
+	return m.positions
+}
+
+// step turns the rotors before a key press. The right rotor always turns; a rotor at its notch turns the
+// one to its left. The middle rotor's pawl also turns the middle rotor itself, so it steps twice in a row
+// when it reaches its notch: the double step.
+func (m *Machine) step() {
+	if m.rotors[1].notch[m.positions[1]] {
+		m.positions[0] = (m.positions[0] + 1) % alphabetSize
+		m.positions[1] = (m.positions[1] + 1) % alphabetSize
+	} else if m.rotors[2].notch[m.positions[2]] {
+		m.positions[1] = (m.positions[1] + 1) % alphabetSize
+	}
+	m.positions[2] = (m.positions[2] + 1) % alphabetSize
+}
+
+// scramble sends a letter through the rotors and reflector and back, without the plugboard or stepping
+func (m *Machine) scramble(x int) int {
+	for i := 2; i >= 0; i-- {
+		x = m.rotors[i].pass(x, m.positions[i], &m.rotors[i].forward)
+	}
+	x = m.reflector[x]
+	for i := 0; i < 3; i++ {
+		x = m.rotors[i].pass(x, m.positions[i], &m.rotors[i].backward)
+	}
+	return x
+}
+
+func (r *rotor) pass(x, position int, wiring *[alphabetSize]int) int {
+	shift := position - r.ring
+	return classical.Mod(wiring[classical.Mod(x+shift, alphabetSize)]-shift, alphabetSize)
+}
+
+// press steps the rotors and encrypts one letter
+func (m *Machine) press(x int) int {
+	m.step()
+	return m.plugboard[m.scramble(m.plugboard[x])]
+}
+
+// Encrypt encrypts the letters of text, keeping their case, and passes everything else through without
+// stepping. Enigma is its own inverse, so a Machine with the same Settings decrypts.
+func (m *Machine) Encrypt(text []byte) []byte {
+	out := make([]byte, len(text))
+	for i, b := range text {
+		x, ok := letterIndex(b)
+		if !ok {
+			out[i] = b
+			continue
+		}
+		out[i] = byte(m.press(x)) + (b - byte(x))
+	}
+	return out
+}
+
+// Encrypt encrypts text on a new Machine with these Settings
+func (s Settings) Encrypt(text []byte) ([]byte, error) {
+	m, err := New(s)
+	if err != nil {
+		return nil, err
+	}
+	return m.Encrypt(text), nil
+}
+
+// letterIndex is classical.LetterIndex without the case
+func letterIndex(b byte) (int, bool) {
+	i, _, ok := classical.LetterIndex(b)
+	return i, ok
+}
@@ -0,0 +1,117 @@
+package enigma
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/classical"
+)
+
+// defaultMaxPairs is the number of plugboard pairs the army used from 1939
+const defaultMaxPairs = 10
+
+// SolvePlugboard finds the plugboard of s, whose rotors and positions must already be right, by hill
+// climbing the index of coincidence of the decryption. Starting from the pairs s already has, such as
+// those of a bombe Stop, each round tries plugging every pair of letters, unplugging them from their
+// partners, and unplugging every pair, in parallel, and makes the change that raises the index most.
+// It stops when nothing helps or maxPairs pairs are plugged (defaultMaxPairs if 0).
+func SolvePlugboard(c []byte, s Settings, maxPairs int) (Settings, []byte, error) {
+	if maxPairs <= 0 {
+		maxPairs = defaultMaxPairs
+	}
+	plugboard, err := parsePlugboard(s.Plugboard)
+	if err != nil {
+		return s, nil, err
+	}
+	m, err := New(s)
+	if err != nil {
+		return s, nil, err
+	}
+	e := classical.Letters(c)
+	// the plugboard is the only thing that changes, so work out the scrambler at every letter once
+	scramblers := make([][alphabetSize]int, len(e))
+	for i := range scramblers {
+		m.step()
+		for x := range scramblers[i] {
+			scramblers[i][x] = m.scramble(x)
+		}
+	}
+	ioc := func(p [alphabetSize]int) float64 {
+		d := make([]int, len(e))
+		for i, x := range e {
+			d[i] = p[scramblers[i][p[x]]]
+		}
+		return classical.IndexOfCoincidenceOf(d)
+	}
+
+	best := ioc(plugboard)
+	for {
+		var changes [][alphabetSize]int
+		for a, b := range plugboard {
+			if a < b {
+				changes = append(changes, unplug(plugboard, a))
+			}
+		}
+		for a := 0; a < alphabetSize; a++ {
+			for b := a + 1; b < alphabetSize; b++ {
+				if plugboard[a] == b {
+					continue
+				}
+				next := unplug(unplug(plugboard, a), b)
+				next[a], next[b] = b, a
+				if countPairs(next) <= maxPairs {
+					changes = append(changes, next)
+				}
+			}
+		}
+		scores := make([]float64, len(changes))
+		parallel(len(changes), func(i int) {
+			scores[i] = ioc(changes[i])
+		})
+		improved := -1
+		for i, score := range scores {
+			if score > best {
+				best, improved = score, i
+			}
+		}
+		if improved < 0 {
+			break
+		}
+		plugboard = changes[improved]
+	}
+	s.Plugboard = formatPlugboard(plugboard)
+	plain, err := s.Encrypt(c)
+	return s, plain, err
+}
+
+// unplug returns a copy of the plugboard with x and its partner unplugged
+func unplug(p [alphabetSize]int, x int) [alphabetSize]int {
+	p[p[x]], p[x] = p[x], x
+	return p
+}
+
+func countPairs(p [alphabetSize]int) int {
+	var n int
+	for a, b := range p {
+		if a < b {
+			n++
+		}
+	}
+	return n
+}
+
+// parallel calls f for every index below n, spread over a goroutine for each CPU
+func parallel(n int, f func(i int)) {
+	workers := runtime.NumCPU()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < n; i += workers {
+				f(i)
+			}
+		}(w)
+	}
+	wg.Wait()
+}
@@ -13,12 +13,25 @@ import (
 
 // modes for encryption
 const (
-	ECB AESMode = 0
-	CBC AESMode = 1
+	ECB    AESMode = 0
+	CBC    AESMode = 1
+	Stream AESMode = 2
 )
 
 type AESMode int
 
+func (m AESMode) String() string {
+	switch m {
+	case ECB:
+		return "ECB"
+	case CBC:
+		return "CBC"
+	case Stream:
+		return "Stream"
+	}
+	return fmt.Sprintf("AESMode(%d)", int(m))
+}
+
 type AES interface {
 	Encrypt(k Key) (Ciphertext, error)
 	Decrypt(k Key) (Plaintext, error)
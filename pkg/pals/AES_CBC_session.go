@@ -0,0 +1,195 @@
+package pals
+
+import (
+	"bytes"
+	"crypto/aes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
+)
+
+// ErrBEASTGuessesExhausted is returned when no guess reproduces the target block
+var ErrBEASTGuessesExhausted = errors.New("no guess matches the target block")
+
+// CBCSession encrypts a stream of records under one Key, using the last Ciphertext block of each record
+// as the IV of the next, as SSL 3.0 and TLS 1.0 do
+type CBCSession struct {
+	Key Key
+	// IV is the IV of the next record
+	IV IV
+
+	mu sync.Mutex
+}
+
+// NewCBCSession starts a session with a random first IV
+func NewCBCSession(k Key) (*CBCSession, error) {
+	iv, err := utils.GenerateRandomBlock()
+	if err != nil {
+		return nil, err
+	}
+	return &CBCSession{Key: k, IV: iv}, nil
+}
+
+// Encrypt encrypts the next record, returning its Ciphertext and the IV it was encrypted under
+func (s *CBCSession) Encrypt(plain Plaintext) (Ciphertext, IV, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cbc := AES_CBC{Plaintext: append([]byte{}, plain...), IV: s.IV}
+	c, err := cbc.Encrypt(s.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	iv := cbc.IV
+	s.IV = append(IV{}, c[len(c)-aes.BlockSize:]...)
+	return c, iv, nil
+}
+
+// RecordFn encrypts a record, returning its Ciphertext and the IV it was encrypted under, as seen on the wire
+type RecordFn func(plain []byte) (Ciphertext, IV, error)
+
+// BEASTOracle is a sender on a CBCSession whose records an attacker can observe and partly choose.
+// Send sends a record made of the attacker's prefix followed by the secret; Inject sends a record of the
+// attacker's choosing on the same session.
+type BEASTOracle struct {
+	Send   RecordFn
+	Inject RecordFn
+}
+
+// Decrypt recovers the secret a byte at a time. The prefix is sized so the next unknown byte ends a block;
+// the attacker, knowing the IV of the next record, injects a first block that encrypts to the same
+// Ciphertext block only if the guess for that byte is right.
+func (o BEASTOracle) Decrypt() (Plaintext, error) {
+	bs := aes.BlockSize
+	secretLen, err := o.secretLength()
+	if err != nil {
+		return nil, err
+	}
+	var secret []byte
+	for i := 0; i < secretLen; i++ {
+		prefix := bytes.Repeat(utils.ByteA, bs-1-i%bs)
+		c, iv, err := o.Send(prefix)
+		if err != nil {
+			return secret, err
+		}
+		block := (len(prefix) + i) / bs
+		prev := []byte(iv)
+		if block > 0 {
+			prev = c[(block-1)*bs : block*bs]
+		}
+		target := c[block*bs : (block+1)*bs]
+		next := c[len(c)-bs:]
+		known := append(append([]byte{}, prefix...), secret...)[block*bs:]
+		b, err := o.guessByte(known, prev, target, next)
+		if err != nil {
+			return secret, fmt.Errorf("recovering byte %d: %w", i, err)
+		}
+		secret = append(secret, b)
+	}
+	return secret, nil
+}
+
+// guessByte injects known || guess, whitened so that it meets the chain as if it followed prev,
+// until the first injected block equals target
+func (o BEASTOracle) guessByte(known, prev, target, next []byte) (byte, error) {
+	for _, g := range guessOrder() {
+		guess := append(append([]byte{}, known...), g)
+		x, err := utils.FixedXor(guess, prev)
+		if err != nil {
+			return 0, err
+		}
+		x, err = utils.FixedXor(x, next)
+		if err != nil {
+			return 0, err
+		}
+		c, _, err := o.Inject(x)
+		if err != nil {
+			return 0, err
+		}
+		if bytes.Equal(c[:len(target)], target) {
+			return g, nil
+		}
+		next = c[len(c)-len(target):]
+	}
+	return 0, ErrBEASTGuessesExhausted
+}
+
+// secretLength finds the length of the secret from the prefix length at which the record grows by a block
+func (o BEASTOracle) secretLength() (int, error) {
+	c, _, err := o.Send(nil)
+	if err != nil {
+		return 0, err
+	}
+	for p := 1; p <= aes.BlockSize; p++ {
+		longer, _, err := o.Send(bytes.Repeat(utils.ByteA, p))
+		if err != nil {
+			return 0, err
+		}
+		if len(longer) > len(c) {
+			return len(c) - p, nil
+		}
+	}
+	return 0, fmt.Errorf("record length never changed")
+}
+
+// guessOrder tries printable bytes first, then the rest
+func guessOrder() []byte {
+	order := append([]byte{}, printableASCII...)
+	for b := 0; b < 256; b++ {
+		if b < 0x20 || b >= 0x7f {
+			order = append(order, byte(b))
+		}
+	}
+	return order
+}
+
+// CBCRecord is a record as recorded off the wire
+type CBCRecord struct {
+	IV         IV
+	Ciphertext Ciphertext
+}
+
+// PredictableIVReport counts the records whose IV an attacker could have known in advance
+type PredictableIVReport struct {
+	Records int
+	// Chained IVs are the last Ciphertext block of the record before
+	Chained int
+	// Repeated IVs were already used by an earlier record
+	Repeated int
+	// Sequential IVs are one more than the IV of the record before
+	Sequential int
+	Zero       int
+}
+
+// Predictable reports whether any record used a predictable IV
+func (r PredictableIVReport) Predictable() bool {
+	return r.Chained+r.Repeated+r.Sequential+r.Zero > 0
+}
+
+func (r PredictableIVReport) String() string {
+	return fmt.Sprintf("%d records: %d chained, %d repeated, %d sequential, %d zero IVs", r.Records, r.Chained, r.Repeated, r.Sequential, r.Zero)
+}
+
+// DetectPredictableIVs checks the IVs of recorded traffic, in the order it was sent
+func DetectPredictableIVs(records []CBCRecord) PredictableIVReport {
+	r := PredictableIVReport{Records: len(records)}
+	seen := map[string]bool{}
+	zero := make([]byte, aes.BlockSize)
+	for i, rec := range records {
+		switch {
+		case bytes.Equal(rec.IV, zero):
+			r.Zero++
+		case seen[string(rec.IV)]:
+			r.Repeated++
+		case i > 0 && len(records[i-1].Ciphertext) >= len(rec.IV) &&
+			bytes.Equal(rec.IV, records[i-1].Ciphertext[len(records[i-1].Ciphertext)-len(rec.IV):]):
+			r.Chained++
+		case i > 0 && new(big.Int).SetBytes(rec.IV).Cmp(new(big.Int).Add(new(big.Int).SetBytes(records[i-1].IV), big.NewInt(1))) == 0:
+			r.Sequential++
+		}
+		seen[string(rec.IV)] = true
+	}
+	return r
+}
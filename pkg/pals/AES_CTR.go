@@ -2,6 +2,7 @@ package pals
 
 import (
 	"bytes"
+	"context"
 	"crypto/aes"
 	"encoding/binary"
 
@@ -94,3 +95,44 @@ func EditCTR(ciphertext Ciphertext, key Key, newtext Plaintext, offset int) (Cip
 	}
 	return res, nil
 }
+
+// EditFn re-encrypts newtext into the Ciphertext at offset under the original Key, like a seekable read/write API
+type EditFn func(ciphertext Ciphertext, newtext Plaintext, offset int) (Ciphertext, error)
+
+// BreakRandomAccessCTR recovers the Plaintext of a CTR Ciphertext by guessing each byte through the edit API
+// until the re-encrypted Ciphertext matches the original
+func BreakRandomAccessCTR(c Ciphertext, edit EditFn) (Plaintext, error) {
+	return BreakRandomAccessCTRContext(context.Background(), c, edit, AttackOptions{})
+}
+
+// BreakRandomAccessCTRContext is BreakRandomAccessCTR, stopping with the bytes recovered so far and an InterruptedError when ctx is done
+func BreakRandomAccessCTRContext(ctx context.Context, c Ciphertext, edit EditFn, opts AttackOptions) (Plaintext, error) {
+	tracker := newProgressTracker(ctx, "BreakRandomAccessCTR", opts)
+	if opts.Stats != nil {
+		edit = opts.Stats.WrapEdit(edit)
+	}
+	var p Plaintext
+	var candidatesTried int
+	for offset := 0; offset < len(c); offset++ {
+		if err := tracker.interrupted(); err != nil {
+			return p, err
+		}
+		for i := 0; i < 256; i++ {
+			candidatesTried++
+			ciphertextCopy := make([]byte, len(c))
+			_ = copy(ciphertextCopy, c)
+			newCiphertext, err := edit(ciphertextCopy, []byte{byte(i)}, offset)
+			if err != nil {
+				return p, err
+			}
+			if c[offset] == newCiphertext[offset] {
+				p = append(p, byte(i))
+				break
+			}
+		}
+		if offset%aes.BlockSize == aes.BlockSize-1 || offset == len(c)-1 {
+			tracker.report(Progress{BytesRecovered: len(p), BlocksDone: (offset + 1) / aes.BlockSize, BlocksTotal: (len(c) + aes.BlockSize - 1) / aes.BlockSize, CandidatesTried: candidatesTried}, offset+1, len(c))
+		}
+	}
+	return p, nil
+}
@@ -47,19 +47,5 @@ func (c AES_ECB) Encrypt(k Key) (Ciphertext, error) {
 }
 
 func SmellsOfECB(b []byte) bool {
-	blocks := chunk(b, aes.BlockSize)
-	m := make(map[string]int64)
-	for _, block := range blocks {
-		for _, b := range blocks {
-			if testEq(b, block) {
-				m[string(block)]++
-			}
-		}
-	}
-	for _, v := range m {
-		if v > 2 {
-			return true
-		}
-	}
-	return false
+	return len(findRepeatedBlocks(b, aes.BlockSize)) > 0
 }
@@ -0,0 +1,134 @@
+package pals
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/mersenne"
+	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
+)
+
+// MTSeedSpace is the number of distinct AES_MT Keys
+const MTSeedSpace = 1 << 16
+
+// how many seeds to try between progress reports
+const mtSeedReportInterval = 4096
+
+// ErrSeedNotFound is returned when no seed in the searched range produces the Ciphertext
+var ErrSeedNotFound = errors.New("no seed produces this Ciphertext")
+
+// KeyForMTSeed returns the AES_MT Key that seeds the generator with seed
+func KeyForMTSeed(seed uint16) Key {
+	k := make([]byte, 2)
+	binary.BigEndian.PutUint16(k, seed)
+	return k
+}
+
+// mtKeystream returns the first l bytes of keystream produced by seed
+func mtKeystream(seed uint16, l int) []byte {
+	m := mersenne.New()
+	m.Seed(int(seed))
+	return doMT(make([]byte, l), m)
+}
+
+// RecoverMTSeed brute forces the AES_MT Key of a Ciphertext whose Plaintext is known to end in knownSuffix
+func RecoverMTSeed(c Ciphertext, knownSuffix []byte) (Key, error) {
+	return RecoverMTSeedContext(context.Background(), c, knownSuffix, AttackOptions{})
+}
+
+// RecoverMTSeedContext is RecoverMTSeed, stopping with an InterruptedError when ctx is done.
+// With a Checkpointer, the search cursor is saved periodically and a later run picks up where it left off.
+func RecoverMTSeedContext(ctx context.Context, c Ciphertext, knownSuffix []byte, opts AttackOptions) (Key, error) {
+	const attack = "RecoverMTSeed"
+	tracker := newProgressTracker(ctx, attack, opts)
+	offset := len(c) - len(knownSuffix)
+	if offset < 0 {
+		return nil, errors.New("known suffix is longer than the Ciphertext")
+	}
+	want, err := utils.FixedXor(c[offset:], knownSuffix)
+	if err != nil {
+		return nil, err
+	}
+	target := checkpointTarget(c, knownSuffix)
+	start := 0
+	cp, err := opts.Checkpoint.resume(attack, target)
+	if err != nil {
+		return nil, err
+	}
+	if cp != nil {
+		start = cp.Cursor
+	}
+	every := opts.Checkpoint.interval()
+	for seed := start; seed < MTSeedSpace; seed++ {
+		if seed%mtSeedReportInterval == 0 || seed%every == 0 {
+			if err := tracker.interrupted(); err != nil {
+				return nil, saveAfterInterruption(opts.Checkpoint, Checkpoint{Attack: attack, Target: target, Cursor: seed}, err)
+			}
+			// the tracker's clock started at this run, so time it on the seeds this run has covered
+			tracker.report(Progress{CandidatesTried: seed}, seed-start, MTSeedSpace-start)
+		}
+		if seed%every == 0 {
+			if err := opts.Checkpoint.save(Checkpoint{Attack: attack, Target: target, Cursor: seed}); err != nil {
+				return nil, err
+			}
+		}
+		if bytes.Equal(mtKeystream(uint16(seed), len(c))[offset:], want) {
+			return KeyForMTSeed(uint16(seed)), opts.Checkpoint.done()
+		}
+	}
+	if err := opts.Checkpoint.done(); err != nil {
+		return nil, err
+	}
+	return nil, ErrSeedNotFound
+}
+
+// RecoverMTTimeSeed finds the timestamp, at most window seconds before newest, whose truncation seeded
+// the AES_MT encryption of plain into token
+func RecoverMTTimeSeed(token Ciphertext, plain Plaintext, newest int64, window int) (int64, error) {
+	return RecoverMTTimeSeedContext(context.Background(), token, plain, newest, window, AttackOptions{})
+}
+
+// RecoverMTTimeSeedContext is RecoverMTTimeSeed, stopping with an InterruptedError when ctx is done.
+// With a Checkpointer, a resumed run searches the window of the original run, whatever newest it is given.
+func RecoverMTTimeSeedContext(ctx context.Context, token Ciphertext, plain Plaintext, newest int64, window int, opts AttackOptions) (int64, error) {
+	const attack = "RecoverMTTimeSeed"
+	tracker := newProgressTracker(ctx, attack, opts)
+	want, err := utils.FixedXor(token, plain)
+	if err != nil {
+		return 0, err
+	}
+	target := checkpointTarget(token, plain)
+	start := 0
+	cp, err := opts.Checkpoint.resume(attack, target)
+	if err != nil {
+		return 0, err
+	}
+	if cp != nil {
+		start = cp.Cursor
+		newest = cp.Anchor
+	}
+	every := opts.Checkpoint.interval()
+	for i := start; i < window; i++ {
+		if i%mtSeedReportInterval == 0 || i%every == 0 {
+			if err := tracker.interrupted(); err != nil {
+				return 0, saveAfterInterruption(opts.Checkpoint, Checkpoint{Attack: attack, Target: target, Cursor: i, Anchor: newest}, err)
+			}
+			tracker.report(Progress{CandidatesTried: i}, i-start, window-start)
+		}
+		if i%every == 0 {
+			if err := opts.Checkpoint.save(Checkpoint{Attack: attack, Target: target, Cursor: i, Anchor: newest}); err != nil {
+				return 0, err
+			}
+		}
+		t := newest - int64(i)
+		if bytes.Equal(mtKeystream(uint16(t), len(want)), want) {
+			return t, opts.Checkpoint.done()
+		}
+	}
+	if err := opts.Checkpoint.done(); err != nil {
+		return 0, err
+	}
+	return 0, ErrSeedNotFound
+}
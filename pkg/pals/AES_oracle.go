@@ -16,6 +16,15 @@ const (
 type EncryptionOracle struct {
 	Encrypt EncryptionFn
 	Mode    AESOracleMode
+	// Stats, if set, counts every query the attack makes and enforces its budget
+	Stats *OracleStats
+}
+
+func (o EncryptionOracle) encryptFn() EncryptionFn {
+	if o.Stats == nil {
+		return o.Encrypt
+	}
+	return o.Stats.WrapEncryption(o.Encrypt)
 }
 
 // Decrypt decrypts fixed text that is appended to the Plaintext input to fixed-Key EncryptionFn
@@ -31,6 +40,15 @@ type CBCPaddingOracle struct {
 	IV           []byte
 	Ciphertext   []byte
 	ValidationFn ValidationFn
+	// Stats, if set, counts every query the attack makes and enforces its budget
+	Stats *OracleStats
+}
+
+func (o CBCPaddingOracle) validationFn() ValidationFn {
+	if o.Stats == nil {
+		return o.ValidationFn
+	}
+	return o.Stats.WrapValidation(o.ValidationFn)
 }
 
 // Decrypt decrypts fixed text that is appended to the Plaintext input to fixed-Key EncryptionFn
@@ -2,7 +2,9 @@ package pals
 
 import (
 	"bytes"
+	"context"
 	"crypto/aes"
+	"errors"
 	"fmt"
 
 	"github.com/nadavoosh/go_crypto_pals/pkg/padding"
@@ -24,45 +26,85 @@ func GetValidationFnForOracle(k Key) ValidationFn {
 }
 
 func (c CBCPaddingOracle) DecryptCBCPadding() ([]byte, error) {
-	prevCipher := c.IV
+	return c.DecryptCBCPaddingContext(context.Background(), AttackOptions{})
+}
+
+// DecryptCBCPaddingContext is DecryptCBCPadding, stopping with the blocks recovered so far and an InterruptedError when ctx is done.
+// With a Checkpointer, the state is saved after every byte and a later run picks up where it left off.
+func (c CBCPaddingOracle) DecryptCBCPaddingContext(ctx context.Context, opts AttackOptions) ([]byte, error) {
+	const attack = "DecryptCBCPadding"
+	tracker := newProgressTracker(ctx, attack, opts)
+	validate := c.validationFn()
 	chunks := ChunkForAES(c.Ciphertext)
+	target := checkpointTarget(c.Ciphertext, c.IV)
 	var finalPlaintext []byte
-	for k := range chunks {
-		var Plaintext []byte
-		for j := 1; j <= aes.BlockSize; j++ {
-			b, err := c.calculateNextByte(chunks[k], Plaintext, j)
+	var Plaintext []byte
+	start := 0
+	cp, err := opts.Checkpoint.resume(attack, target)
+	if err != nil {
+		return nil, err
+	}
+	if cp != nil {
+		start, finalPlaintext, Plaintext = cp.Cursor, cp.Recovered, cp.Block
+	}
+	// bytes recovered by an earlier run, which the ETA leaves out since the tracker's clock started at this one
+	resumed := start*aes.BlockSize + len(Plaintext)
+	var candidatesTried int
+	for k := start; k < len(chunks); k++ {
+		prevCipher := c.IV
+		if k > 0 {
+			prevCipher = chunks[k-1]
+		}
+		for j := len(Plaintext) + 1; j <= aes.BlockSize; j++ {
+			b, tried, err := c.calculateNextByte(tracker, validate, chunks[k], Plaintext, j)
+			candidatesTried += tried
+			if errors.Is(err, ErrInterrupted) {
+				return finalPlaintext, saveAfterInterruption(opts.Checkpoint, Checkpoint{Attack: attack, Target: target, Cursor: k, Recovered: finalPlaintext, Block: Plaintext}, err)
+			}
 			if err != nil {
-				return nil, err
+				return finalPlaintext, err
 			}
 			Plaintext = append([]byte{b}, Plaintext...)
+			if err := opts.Checkpoint.save(Checkpoint{Attack: attack, Target: target, Cursor: k, Recovered: finalPlaintext, Block: Plaintext}); err != nil {
+				return finalPlaintext, err
+			}
+			tracker.report(Progress{BytesRecovered: len(finalPlaintext) + j, BlocksDone: k, BlocksTotal: len(chunks), CandidatesTried: candidatesTried}, k*aes.BlockSize+j-resumed, len(c.Ciphertext)-resumed)
 		}
 		next, err := utils.FixedXor(prevCipher, Plaintext)
 		if err != nil {
 			return nil, err
 		}
 		finalPlaintext = append(finalPlaintext, next...)
-		prevCipher = chunks[k]
+		Plaintext = nil
+	}
+	if err := opts.Checkpoint.done(); err != nil {
+		return nil, err
 	}
 	return padding.RemovePKCSPadding(finalPlaintext), nil
 }
-func (c CBCPaddingOracle) calculateNextByte(block, Plaintext []byte, j int) (byte, error) {
+
+// calculateNextByte returns the j-th byte from the end of the block's intermediate state, and how many guesses it took
+func (c CBCPaddingOracle) calculateNextByte(tracker *progressTracker, validate ValidationFn, block, Plaintext []byte, j int) (byte, int, error) {
 	base := bytes.Repeat([]byte{0}, aes.BlockSize-j)
 	soFar := utils.FlexibleXor(Plaintext, bytes.Repeat([]byte{byte(j)}, len(Plaintext)))
 	for i := 0; i < 256; i++ {
+		if err := tracker.interrupted(); err != nil {
+			return byte(0), i, err
+		}
 		filler := append(append(base, byte(i)), soFar...)
-		paddingCorrect, err := c.ValidationFn(append(filler, block...), c.IV)
+		paddingCorrect, err := validate(append(filler, block...), c.IV)
 		if err != nil {
-			return byte(0), err
+			return byte(0), i + 1, err
 		}
 		if paddingCorrect {
 			require := append(base, bytes.Repeat([]byte{byte(j)}, j)...)
 			g, err := utils.FixedXor(filler, require)
 			if err != nil {
-				return byte(0), err
+				return byte(0), i + 1, err
 			}
 			// fmt.Printf("YES correct padding found for byte %02v: %v : %v : %v \n", j, block, require, filler)
-			return g[aes.BlockSize-j], nil
+			return g[aes.BlockSize-j], i + 1, nil
 		}
 	}
-	return byte(0), fmt.Errorf("no correct padding found for byte %v: %v", j, block)
+	return byte(0), 256, fmt.Errorf("no correct padding found for byte %v: %v", j, block)
 }
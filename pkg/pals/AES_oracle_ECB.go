@@ -2,6 +2,7 @@ package pals
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 
 	"github.com/nadavoosh/go_crypto_pals/pkg/padding"
@@ -16,6 +17,10 @@ func buildMap(f EncryptionFn, testInput []byte, blocksize, blockNumber int) (map
 		if err != nil {
 			return nil, err
 		}
+		if len(p) < (blockNumber+1)*blocksize {
+			// the guess doesn't reach this block, which happens once the whole secret has been read
+			continue
+		}
 		ret := p[(blockNumber * blocksize) : (blockNumber+1)*blocksize]
 		m[string(ret)] = byte(i)
 	}
@@ -63,7 +68,13 @@ func getPaddingLength(f EncryptionFn, blocksize int) (int, int, error) {
 }
 
 func (o EncryptionOracle) DecryptECBAppend() ([]byte, error) {
-	f := o.Encrypt
+	return o.DecryptECBAppendContext(context.Background(), AttackOptions{})
+}
+
+// DecryptECBAppendContext is DecryptECBAppend, stopping with the bytes recovered so far and an InterruptedError when ctx is done
+func (o EncryptionOracle) DecryptECBAppendContext(ctx context.Context, opts AttackOptions) ([]byte, error) {
+	tracker := newProgressTracker(ctx, "DecryptECBAppend", opts)
+	f := o.encryptFn()
 	blocksize, err := inferBlocksize(f)
 	if err != nil {
 		return nil, err
@@ -85,14 +96,20 @@ func (o EncryptionOracle) DecryptECBAppend() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	blocksTotal := len(baseCiphertext)/blocksize + 1 - blocksToSkip
+	var candidatesTried int
 	for n := blocksToSkip; n < len(baseCiphertext)/blocksize+1; n++ {
 		for j := 0; j < blocksize; j++ {
+			if err := tracker.interrupted(); err != nil {
+				return nPlain, err
+			}
 			baseInput := bytes.Repeat(utils.ByteA, paddingLen+blocksize-(j+1))
 			testInput := append(baseInput, nPlain...)
 			m, err := buildMap(f, testInput, blocksize, n)
 			if err != nil {
 				return nil, err
 			}
+			candidatesTried += 256
 			match, err := f(baseInput)
 			if err != nil {
 				return nil, err
@@ -109,6 +126,8 @@ func (o EncryptionOracle) DecryptECBAppend() ([]byte, error) {
 				// fmt.Printf("encrypted string %s not found in decryption map for byte %d\n", actual, j)
 				continue
 			}
+			blocksDone := n - blocksToSkip
+			tracker.report(Progress{BytesRecovered: len(nPlain), BlocksDone: blocksDone, BlocksTotal: blocksTotal, CandidatesTried: candidatesTried}, blocksDone*blocksize+j+1, blocksTotal*blocksize)
 		}
 	}
 	if nPlain == nil {
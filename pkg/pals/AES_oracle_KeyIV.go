@@ -0,0 +1,165 @@
+package pals
+
+import (
+	"bytes"
+	"crypto/aes"
+	"errors"
+	"fmt"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
+)
+
+// ErrKeyNotVerified is returned when the value recovered from a KeyIVOracle does not decrypt as the Key
+var ErrKeyNotVerified = errors.New("recovered IV does not verify as the Key")
+
+var errIVMismatch = errors.New("receiver decrypts with a different IV than the sender encrypts with")
+
+// InvalidPlaintextError is returned by a receiver that rejects a decrypted message and echoes the Plaintext back
+type InvalidPlaintextError struct {
+	Plaintext Plaintext
+}
+
+func (e *InvalidPlaintextError) Error() string {
+	return fmt.Sprintf("Error, invalid values found in user input: %s", e.Plaintext)
+}
+
+// PlaintextLeaker decrypts a Ciphertext and, if it rejects the result, returns the rejected Plaintext.
+// An accepted Ciphertext leaks nothing and returns nil.
+type PlaintextLeaker interface {
+	LeakPlaintext(c Ciphertext) (Plaintext, error)
+}
+
+// LeakFn adapts an ordinary function to the PlaintextLeaker interface
+type LeakFn func(c Ciphertext) (Plaintext, error)
+
+func (f LeakFn) LeakPlaintext(c Ciphertext) (Plaintext, error) {
+	return f(c)
+}
+
+// LeakFromError adapts a decryption function that reports rejected Plaintext as an InvalidPlaintextError
+func LeakFromError(decrypt func(c Ciphertext) (Plaintext, error)) PlaintextLeaker {
+	return LeakFn(func(c Ciphertext) (Plaintext, error) {
+		_, err := decrypt(c)
+		var invalid *InvalidPlaintextError
+		if errors.As(err, &invalid) {
+			return invalid.Plaintext, nil
+		}
+		return nil, err
+	})
+}
+
+// KeyIVOracle is a CBC sender and receiver that use the Key as the IV
+type KeyIVOracle struct {
+	Encrypt EncryptionFn
+	Leaker  PlaintextLeaker
+	// Blocksize is inferred from Encrypt if unset
+	Blocksize int
+	// Verify checks a recovered Key; if unset, it is checked by decrypting with AES_CBC
+	Verify func(k Key, plain Plaintext, c Ciphertext) bool
+	// Stats, if set, counts every query the attack makes to the sender and receiver and enforces its budget
+	Stats *OracleStats
+}
+
+func (o KeyIVOracle) encryptFn() EncryptionFn {
+	if o.Stats == nil {
+		return o.Encrypt
+	}
+	return o.Stats.WrapEncryption(o.Encrypt)
+}
+
+func (o KeyIVOracle) leaker() PlaintextLeaker {
+	if o.Stats == nil {
+		return o.Leaker
+	}
+	return o.Stats.WrapLeaker(o.Leaker)
+}
+
+// RecoverKey encrypts three known blocks, sends C_1 || 0 || C_1 || C_2... to the receiver,
+// and recovers the Key from the leaked Plaintext as P'_1 XOR P'_3
+func (o KeyIVOracle) RecoverKey() (Key, error) {
+	encrypt := o.encryptFn()
+	bs, err := o.blocksize(encrypt)
+	if err != nil {
+		return nil, err
+	}
+	plain := bytes.Repeat(utils.ByteA, 3*bs)
+	c, err := encrypt(plain)
+	if err != nil {
+		return nil, err
+	}
+	if len(c) < 3*bs {
+		return nil, fmt.Errorf("Ciphertext of %d bytes is too short for block size %d", len(c), bs)
+	}
+	// keep the rest of the message after the forged blocks, so the padding still validates
+	forged := append(append(append([]byte{}, c[:bs]...), make([]byte, bs)...), c...)
+	leaked, err := o.leaker().LeakPlaintext(forged)
+	if err != nil {
+		return nil, err
+	}
+	if len(leaked) < 3*bs {
+		return nil, fmt.Errorf("receiver leaked %d bytes, need at least %d", len(leaked), 3*bs)
+	}
+	if !bytes.Equal(leaked[:bs], plain[:bs]) {
+		return nil, errIVMismatch
+	}
+	k, err := utils.FixedXor(leaked[:bs], leaked[2*bs:3*bs])
+	if err != nil {
+		return nil, err
+	}
+	if !o.verify(k, plain, c) {
+		return nil, ErrKeyNotVerified
+	}
+	return k, nil
+}
+
+// blocksize is the oracle's Blocksize, or the one inferred from encrypt if unset
+func (o KeyIVOracle) blocksize(encrypt EncryptionFn) (int, error) {
+	if o.Blocksize != 0 {
+		return o.Blocksize, nil
+	}
+	return inferBlocksize(encrypt)
+}
+
+// DetectKeyAsIV reports whether the oracle encrypts with its Key as the IV.
+// A sender with a random IV is ruled out without querying the receiver.
+func (o KeyIVOracle) DetectKeyAsIV() (bool, error) {
+	encrypt := o.encryptFn()
+	bs, err := o.blocksize(encrypt)
+	if err != nil {
+		return false, err
+	}
+	plain := bytes.Repeat(utils.ByteA, 3*bs)
+	first, err := encrypt(plain)
+	if err != nil {
+		return false, err
+	}
+	second, err := encrypt(plain)
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(first, second) {
+		return false, nil
+	}
+	_, err = o.RecoverKey()
+	if errors.Is(err, ErrKeyNotVerified) || errors.Is(err, errIVMismatch) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (o KeyIVOracle) verify(k Key, plain Plaintext, c Ciphertext) bool {
+	if o.Verify != nil {
+		return o.Verify(k, plain, c)
+	}
+	if len(k) != aes.BlockSize {
+		return false
+	}
+	d := AES_CBC{Ciphertext: c}
+	got, err := d.DecryptWithKeyIV(k)
+	return err == nil && bytes.Equal(got, plain)
+}
+
+// UsesKeyAsIV reports whether this AES_CBC was set up by EncryptWithKeyIV under k
+func (cbc *AES_CBC) UsesKeyAsIV(k Key) bool {
+	return len(cbc.IV) > 0 && bytes.Equal(cbc.IV, k)
+}
@@ -0,0 +1,150 @@
+package pals
+
+import (
+	"errors"
+	"fmt"
+)
+
+// LengthFn returns the length of the Ciphertext of a compressed request carrying the payload
+type LengthFn func(payload []byte) (int, error)
+
+// ErrNoCandidate is returned when no candidate character compresses better than the rest
+var ErrNoCandidate = errors.New("no candidate compresses better than the others")
+
+// Base64Alphabet is the alphabet of base64 encoded secrets such as session cookies
+var Base64Alphabet = []byte("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/=")
+
+// compressionFiller are distinct bytes, unlikely to appear in a request, that shift the compressed length
+// of a payload without compressing against anything
+var compressionFiller = []byte("!@#$%^&*()[]{}<>|~`'\"?;\x01\x02\x03\x04\x05\x06\x07\x08\x0b\x0c\x0e\x0f\x10")
+
+// how many characters CompressionOracle recovers if MaxLen is unset
+const defaultCompressionMaxLen = 64
+
+// CompressionOracle recovers a secret from a request that is compressed before it is encrypted (CRIME).
+// A guess that repeats the secret compresses better, so the right character gives the shortest Ciphertext.
+type CompressionOracle struct {
+	Length LengthFn
+	// Known is the text just before the secret in the request, such as "sessionid="
+	Known []byte
+	// Alphabet is the characters the secret is drawn from, and defaults to Base64Alphabet
+	Alphabet []byte
+	// Terminator ends the secret in the request; recovery stops when it is recovered
+	Terminator byte
+	// MaxLen bounds the number of characters recovered
+	MaxLen int
+	// Stats, if set, counts every query the attack makes and enforces its budget
+	Stats *OracleStats
+}
+
+// CompressionResult is the recovered secret, with the number of queries spent on each character
+type CompressionResult struct {
+	Secret         []byte
+	QueriesPerChar []int
+}
+
+// Queries is the total number of queries the attack made
+func (r CompressionResult) Queries() int {
+	var n int
+	for _, q := range r.QueriesPerChar {
+		n += q
+	}
+	return n
+}
+
+// MeanQueriesPerChar is the average number of queries spent per recovered character
+func (r CompressionResult) MeanQueriesPerChar() float64 {
+	if len(r.QueriesPerChar) == 0 {
+		return 0
+	}
+	return float64(r.Queries()) / float64(len(r.QueriesPerChar))
+}
+
+func (o CompressionOracle) lengthFn() LengthFn {
+	if o.Stats == nil {
+		return o.Length
+	}
+	return o.Stats.WrapLength(o.Length)
+}
+
+// Recover recovers the secret one character at a time. Where candidates tie, as they do when a block cipher
+// rounds lengths up to a block or deflate rounds them up to a byte, filler bytes are prepended until the
+// payloads sit at a length boundary, and only the candidates that stay shortest are kept.
+func (o CompressionOracle) Recover() (CompressionResult, error) {
+	length := o.lengthFn()
+	alphabet := o.Alphabet
+	if alphabet == nil {
+		alphabet = Base64Alphabet
+	}
+	if o.Terminator != 0 {
+		alphabet = append(append([]byte{}, alphabet...), o.Terminator)
+	}
+	maxLen := o.MaxLen
+	if maxLen == 0 {
+		maxLen = defaultCompressionMaxLen
+	}
+	var res CompressionResult
+	for len(res.Secret) < maxLen {
+		guess := append(append([]byte{}, o.Known...), res.Secret...)
+		next, queries, err := o.nextChar(length, guess, alphabet)
+		if err != nil {
+			return res, fmt.Errorf("recovering character %d: %w", len(res.Secret), err)
+		}
+		res.QueriesPerChar = append(res.QueriesPerChar, queries)
+		if o.Terminator != 0 && next == o.Terminator {
+			break
+		}
+		res.Secret = append(res.Secret, next)
+	}
+	return res, nil
+}
+
+// nextChar narrows the alphabet down to the one character that compresses best after guess
+func (o CompressionOracle) nextChar(length LengthFn, guess, alphabet []byte) (byte, int, error) {
+	var queries int
+	query := func(n int, c byte) (int, error) {
+		queries++
+		payload := append(append(append([]byte{}, compressionFiller[:n]...), guess...), c)
+		return length(payload)
+	}
+	candidates := alphabet
+	for n := 0; n <= len(compressionFiller); {
+		lengths := make([]int, len(candidates))
+		shortest := -1
+		for i, c := range candidates {
+			l, err := query(n, c)
+			if err != nil {
+				return 0, queries, err
+			}
+			lengths[i] = l
+			if shortest < 0 || l < shortest {
+				shortest = l
+			}
+		}
+		var kept []byte
+		for i, c := range candidates {
+			if lengths[i] == shortest {
+				kept = append(kept, c)
+			}
+		}
+		if len(kept) == 1 {
+			return kept[0], queries, nil
+		}
+		n++
+		if len(kept) == len(candidates) {
+			// every candidate rounds up to the same length, so add filler to a single candidate
+			// until its length changes, which puts the payloads right at a length boundary
+			for ; n <= len(compressionFiller); n++ {
+				l, err := query(n, candidates[0])
+				if err != nil {
+					return 0, queries, err
+				}
+				if l != shortest {
+					break
+				}
+			}
+		}
+		candidates = kept
+	}
+	return 0, queries, ErrNoCandidate
+}
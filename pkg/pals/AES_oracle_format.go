@@ -0,0 +1,556 @@
+package pals
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"unicode/utf8"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
+)
+
+// FormatPredicate is a check a receiver makes on decrypted Plaintext, and leaks the result of
+type FormatPredicate struct {
+	Name  string
+	Valid func(plain []byte) bool
+}
+
+var ASCIIPredicate = FormatPredicate{Name: "ASCII", Valid: func(plain []byte) bool {
+	for _, b := range plain {
+		if b >= 0x80 {
+			return false
+		}
+	}
+	return true
+}}
+
+var UTF8Predicate = FormatPredicate{Name: "UTF-8", Valid: utf8.Valid}
+
+// KeyValuePredicate accepts ;-separated fields that each have exactly one =
+var KeyValuePredicate = FormatPredicate{Name: "key=value", Valid: func(plain []byte) bool {
+	for _, field := range bytes.Split(plain, []byte(";")) {
+		if len(field) > 0 && bytes.Count(field, []byte("=")) != 1 {
+			return false
+		}
+	}
+	return true
+}}
+
+var JSONPredicate = FormatPredicate{Name: "JSON", Valid: json.Valid}
+
+// FormatPredicates returns the built-in predicates
+func FormatPredicates() []FormatPredicate {
+	return []FormatPredicate{ASCIIPredicate, UTF8Predicate, KeyValuePredicate, JSONPredicate}
+}
+
+// FormatOracle recovers Plaintext from a receiver that only reveals whether decrypted Plaintext satisfies a
+// FormatPredicate. It flips bits of the byte under attack, sets the bytes already recovered to chosen Plaintext,
+// and keeps only the values of the byte that agree with every answer.
+//
+// In Stream mode the Ciphertext is cut off after the byte under attack. In CBC mode the block under attack is
+// sent on its own, after a forged IV; the rest of that block is left untouched and assumed to behave like Filler.
+type FormatOracle struct {
+	Mode       AESMode
+	Ciphertext Ciphertext
+	// IV is the IV of the first block, in CBC mode
+	IV        IV
+	Predicate FormatPredicate
+	// Query reports whether the Predicate holds for the decryption of cipher; IV is nil in Stream mode
+	Query ValidationFn
+	// Contexts, if set, replaces the chosen Plaintexts of length n placed before the byte under attack
+	Contexts func(n int) [][]byte
+	// Filler stands in for the untouched rest of a CBC block, and defaults to a space
+	Filler byte
+	// Stats, if set, counts every query the attack makes and enforces its budget
+	Stats *OracleStats
+}
+
+// FormatOracleResult is the recovered Plaintext, with the number of values left for every byte.
+// Bytes with more than one value left are set to the lowest of them.
+type FormatOracleResult struct {
+	Plaintext  Plaintext
+	Candidates []int
+	Queries    int
+}
+
+// Resolved is the number of bytes pinned down to a single value
+func (r FormatOracleResult) Resolved() int {
+	var n int
+	for _, c := range r.Candidates {
+		if c == 1 {
+			n++
+		}
+	}
+	return n
+}
+
+// Exploitable reports whether every byte was recovered
+func (r FormatOracleResult) Exploitable() bool {
+	return len(r.Candidates) > 0 && r.Resolved() == len(r.Candidates)
+}
+
+// BitsPerByte is the mean number of bits learned about each byte
+func (r FormatOracleResult) BitsPerByte() float64 {
+	if len(r.Candidates) == 0 {
+		return 0
+	}
+	var bits float64
+	for _, c := range r.Candidates {
+		bits += 8 - math.Log2(float64(c))
+	}
+	return bits / float64(len(r.Candidates))
+}
+
+// QueriesPerByte is the mean number of queries spent on each byte
+func (r FormatOracleResult) QueriesPerByte() float64 {
+	if len(r.Candidates) == 0 {
+		return 0
+	}
+	return float64(r.Queries) / float64(len(r.Candidates))
+}
+
+func (o FormatOracle) queryFn() ValidationFn {
+	if o.Stats == nil {
+		return o.Query
+	}
+	return o.Stats.WrapValidation(o.Query)
+}
+
+// byteSet is a set of candidate values for a byte
+type byteSet [256]bool
+
+func (s *byteSet) count() int {
+	var n int
+	for _, in := range s {
+		if in {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *byteSet) values() []byte {
+	var values []byte
+	for v, in := range s {
+		if in {
+			values = append(values, byte(v))
+		}
+	}
+	return values
+}
+
+func (s *byteSet) lowest() byte {
+	for v, in := range s {
+		if in {
+			return byte(v)
+		}
+	}
+	return 0
+}
+
+// how many values an unresolved byte may have and still be narrowed down by the queries for the bytes after it
+const maxJointCandidates = 4
+
+// formatQuery is a chosen Plaintext to put before the byte under attack and, for every value an earlier
+// unresolved byte may have, the values of the byte under attack that it accepts
+type formatQuery struct {
+	context  []byte
+	valid    []byteSet
+	accepted [][]byte
+}
+
+// unresolved is an earlier byte that may still be any of values
+type unresolved struct {
+	pos    int
+	values []byte
+}
+
+// Decrypt recovers as much of the Plaintext as the Predicate leaks
+func (o FormatOracle) Decrypt() (FormatOracleResult, error) {
+	switch o.Mode {
+	case Stream, CBC:
+	default:
+		return FormatOracleResult{}, fmt.Errorf("format oracle does not support mode %s", o.Mode)
+	}
+	query := o.queryFn()
+	// in CBC mode every block is attacked with the same queries
+	cache := map[int][]formatQuery{}
+	var res FormatOracleResult
+	var open *unresolved
+	for j := range o.Ciphertext {
+		if open != nil && open.pos < o.windowStart(j) {
+			open = nil
+		}
+		h, queries, err := o.recoverByte(query, cache, res.Plaintext, open, j)
+		res.Queries += queries
+		if err != nil {
+			return res, err
+		}
+		var values byteSet
+		if open != nil {
+			// keep the values of the earlier byte that some value of this one agrees with
+			var kept []byte
+			for i, set := range h {
+				if set.count() > 0 {
+					kept = append(kept, open.values[i])
+				}
+				for v, in := range set {
+					values[v] = values[v] || in
+				}
+			}
+			open.values = kept
+			res.Plaintext[open.pos] = kept[0]
+			res.Candidates[open.pos] = len(kept)
+			if len(kept) == 1 {
+				open = nil
+			}
+		} else {
+			values = h[0]
+		}
+		res.Plaintext = append(res.Plaintext, values.lowest())
+		res.Candidates = append(res.Candidates, values.count())
+		if c := values.count(); c > 1 && c <= maxJointCandidates {
+			open = &unresolved{pos: j, values: values.values()}
+		}
+	}
+	return res, nil
+}
+
+// windowStart is the first byte sent along with byte j
+func (o FormatOracle) windowStart(j int) int {
+	if o.Mode == CBC {
+		return j - j%aes.BlockSize
+	}
+	return 0
+}
+
+// recoverByte narrows down byte j, given the bytes recovered before it, jointly with an earlier unresolved byte.
+// It returns the values of byte j left for each value of the unresolved byte.
+func (o FormatOracle) recoverByte(query ValidationFn, cache map[int][]formatQuery, recovered Plaintext, open *unresolved, j int) ([]byteSet, int, error) {
+	start := o.windowStart(j)
+	n := j - start
+	// how many untouched bytes follow j
+	after := 0
+	if o.Mode == CBC {
+		after = aes.BlockSize - 1 - n
+	}
+	// the earlier byte under each hypothesis differs from the value recovered for it by errs
+	k, errs := -1, []byte{0}
+	if open != nil {
+		k, errs = open.pos-start, nil
+		for _, v := range open.values {
+			errs = append(errs, v^recovered[open.pos])
+		}
+	}
+	queries, ok := cache[n]
+	if !ok || open != nil {
+		queries = o.formatQueries(n, after, k, errs)
+		if o.Mode == CBC && open == nil {
+			cache[n] = queries
+		}
+	}
+	h := make([]byteSet, len(errs))
+	reset := func() {
+		for i := range h {
+			for v := range h[i] {
+				h[i][v] = true
+			}
+		}
+	}
+	reset()
+	var tried int
+	for countAll(h) > 1 {
+		q, d, ok := bestFormatQuery(queries, h)
+		if !ok {
+			break
+		}
+		valid, err := o.ask(query, recovered[start:], q.context, j, d)
+		tried++
+		if err != nil {
+			return h, tried, err
+		}
+		next := make([]byteSet, len(h))
+		for i := range h {
+			for v, in := range h[i] {
+				next[i][v] = in && q.valid[i][byte(v)^d] == valid
+			}
+		}
+		if countAll(next) == 0 {
+			// the answers contradict each other, so the untouched bytes did not behave as assumed
+			reset()
+			break
+		}
+		h = next
+	}
+	if countAll(h) == 1 {
+		// answers that are always the same can single out a value without the Predicate ever holding,
+		// so confirm it with a query that should succeed
+		confirmed, queried, err := o.confirm(query, queries, h, recovered[start:], j)
+		if queried {
+			tried++
+		}
+		if err != nil {
+			return h, tried, err
+		}
+		if !confirmed {
+			reset()
+		}
+	}
+	return h, tried, nil
+}
+
+// confirm asks a query the single remaining candidate should pass, reporting whether a query was made
+func (o FormatOracle) confirm(query ValidationFn, queries []formatQuery, h []byteSet, known Plaintext, j int) (bool, bool, error) {
+	for i := range h {
+		if h[i].count() == 0 {
+			continue
+		}
+		v := h[i].lowest()
+		for _, q := range queries {
+			if len(q.accepted[i]) > 0 {
+				valid, err := o.ask(query, known, q.context, j, v^q.accepted[i][0])
+				return valid, true, err
+			}
+		}
+	}
+	return true, false, nil
+}
+
+func countAll(h []byteSet) int {
+	var n int
+	for i := range h {
+		n += h[i].count()
+	}
+	return n
+}
+
+// formatQueries computes the values of the byte under attack that every context accepts, for each error
+// in the earlier byte at k, dropping contexts that can't tell any values apart and contexts that duplicate another
+func (o FormatOracle) formatQueries(n, after, k int, errs []byte) []formatQuery {
+	contexts := o.Contexts
+	if contexts == nil {
+		contexts = defaultFormatContexts
+	}
+	filler := o.Filler
+	if filler == 0 {
+		filler = ' '
+	}
+	seen := map[string]bool{}
+	var queries []formatQuery
+	for _, ctx := range contexts(n) {
+		if len(ctx) != n {
+			continue
+		}
+		q := formatQuery{context: ctx, valid: make([]byteSet, len(errs))}
+		var key []byte
+		informative := false
+		for i, e := range errs {
+			plain := append(append(append([]byte{}, ctx...), 0), bytes.Repeat([]byte{filler}, after)...)
+			if k >= 0 {
+				plain[k] ^= e
+			}
+			for v := 0; v < 256; v++ {
+				plain[n] = byte(v)
+				q.valid[i][v] = o.Predicate.Valid(plain)
+			}
+			if c := q.valid[i].count(); (c != 0 && c != 256) || q.valid[i] != q.valid[0] {
+				informative = true
+			}
+			for _, in := range q.valid[i] {
+				if in {
+					key = append(key, 1)
+				} else {
+					key = append(key, 0)
+				}
+			}
+		}
+		if !informative || seen[string(key)] {
+			continue
+		}
+		seen[string(key)] = true
+		for i := range q.valid {
+			q.accepted = append(q.accepted, q.valid[i].values())
+		}
+		queries = append(queries, q)
+	}
+	return queries
+}
+
+// bestFormatQuery picks the query and flip that split the candidates most evenly
+func bestFormatQuery(queries []formatQuery, h []byteSet) (formatQuery, byte, bool) {
+	candidates := make([][]byte, len(h))
+	total := 0
+	for i := range h {
+		candidates[i] = h[i].values()
+		total += len(candidates[i])
+	}
+	var best formatQuery
+	var bestD byte
+	bestSplit := 0
+	for _, q := range queries {
+		for d := 0; d < 256; d++ {
+			var n int
+			for i := range h {
+				// count whichever of the two sets is smaller
+				if len(q.accepted[i]) < len(candidates[i]) {
+					for _, a := range q.accepted[i] {
+						if h[i][a^byte(d)] {
+							n++
+						}
+					}
+				} else {
+					for _, v := range candidates[i] {
+						if q.valid[i][v^byte(d)] {
+							n++
+						}
+					}
+				}
+			}
+			split := n
+			if total-n < split {
+				split = total - n
+			}
+			if split > bestSplit {
+				best, bestD, bestSplit = q, byte(d), split
+				if bestSplit == total/2 {
+					return best, bestD, true
+				}
+			}
+		}
+	}
+	return best, bestD, bestSplit > 0
+}
+
+// ask sends a Ciphertext whose Plaintext is context followed by byte j flipped by d
+func (o FormatOracle) ask(query ValidationFn, known Plaintext, context []byte, j int, d byte) (bool, error) {
+	delta, err := utils.FixedXor(known, context)
+	if err != nil {
+		return false, err
+	}
+	delta = append(delta, d)
+	if o.Mode == Stream {
+		return query(utils.FlexibleXor(append([]byte{}, o.Ciphertext[:j+1]...), delta), nil)
+	}
+	block := j / aes.BlockSize
+	prev := []byte(o.IV)
+	if block > 0 {
+		prev = o.Ciphertext[(block-1)*aes.BlockSize : block*aes.BlockSize]
+	}
+	iv := utils.FlexibleXor(append([]byte{}, prev...), delta)
+	return query(o.Ciphertext[block*aes.BlockSize:(block+1)*aes.BlockSize], iv)
+}
+
+var printableASCII = func() []byte {
+	var b []byte
+	for c := byte(0x20); c < 0x7f; c++ {
+		b = append(b, c)
+	}
+	return b
+}()
+
+// defaultFormatContexts are runs of one character, runs opened by a quote or bracket,
+// and runs of spaces ending in a printable byte or a UTF-8 lead byte
+func defaultFormatContexts(n int) [][]byte {
+	if n == 0 {
+		return [][]byte{{}}
+	}
+	var contexts [][]byte
+	for _, f := range printableASCII {
+		contexts = append(contexts, bytes.Repeat([]byte{f}, n))
+	}
+	for _, open := range []byte(`"[{`) {
+		for _, f := range []byte(" a1") {
+			contexts = append(contexts, append([]byte{open}, bytes.Repeat([]byte{f}, n-1)...))
+		}
+	}
+	// a lead byte of a two byte UTF-8 sequence, and every printable byte
+	for _, v := range append([]byte{0xc2}, printableASCII...) {
+		ctx := bytes.Repeat([]byte{' '}, n)
+		ctx[n-1] = v
+		contexts = append(contexts, ctx)
+	}
+	return contexts
+}
+
+// FormatOracleReport summarizes how much a FormatPredicate leaks, and at what cost
+type FormatOracleReport struct {
+	Predicate string
+	Mode      AESMode
+	// Exploitable is set if every byte was recovered correctly
+	Exploitable bool
+	// Correct is the fraction of bytes recovered correctly
+	Correct        float64
+	BitsPerByte    float64
+	QueriesPerByte float64
+}
+
+func (r FormatOracleReport) String() string {
+	return fmt.Sprintf("%-10s %-6s exploitable=%-5t %3.0f%% correct, %.2f bits/byte, %.1f queries/byte", r.Predicate, r.Mode, r.Exploitable, 100*r.Correct, r.BitsPerByte, r.QueriesPerByte)
+}
+
+// AssessFormatPredicate runs the attack against a simulated receiver that checks p, over an encryption of sample
+func AssessFormatPredicate(p FormatPredicate, mode AESMode, sample Plaintext) (FormatOracleReport, error) {
+	k := utils.GenerateKey()
+	o := FormatOracle{Mode: mode, Predicate: p}
+	var err error
+	switch mode {
+	case Stream:
+		o.Ciphertext, err = CTR{Plaintext: sample}.Encrypt(k)
+		o.Query = func(c, _ []byte) (bool, error) {
+			plain, err := CTR{Ciphertext: c}.Decrypt(k)
+			return err == nil && p.Valid(plain), err
+		}
+	case CBC:
+		cbc := AES_CBC{Plaintext: append([]byte{}, sample...)}
+		o.Ciphertext, err = cbc.Encrypt(k)
+		o.IV = cbc.IV
+		o.Query = func(c, iv []byte) (bool, error) {
+			plain, err := decryptCBCNoPadding(k, iv, c)
+			return err == nil && p.Valid(plain), err
+		}
+	default:
+		return FormatOracleReport{}, fmt.Errorf("format oracle does not support mode %s", mode)
+	}
+	if err != nil {
+		return FormatOracleReport{}, err
+	}
+	res, err := o.Decrypt()
+	if err != nil {
+		return FormatOracleReport{}, err
+	}
+	var correct int
+	for i, b := range sample {
+		if res.Candidates[i] == 1 && res.Plaintext[i] == b {
+			correct++
+		}
+	}
+	return FormatOracleReport{
+		Predicate:      p.Name,
+		Mode:           mode,
+		Exploitable:    correct == len(sample),
+		Correct:        float64(correct) / float64(len(sample)),
+		BitsPerByte:    res.BitsPerByte(),
+		QueriesPerByte: res.QueriesPerByte(),
+	}, nil
+}
+
+// decryptCBCNoPadding decrypts whole blocks without checking or removing padding
+func decryptCBCNoPadding(k Key, iv IV, c Ciphertext) (Plaintext, error) {
+	cipher, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	var d Plaintext
+	prior := iv
+	for _, block := range chunk(c, aes.BlockSize) {
+		plain, err := utils.FixedXor(decryptSingleBlock(cipher, block), prior)
+		if err != nil {
+			return nil, err
+		}
+		d = append(d, plain...)
+		prior = block
+	}
+	return d, nil
+}
@@ -0,0 +1,121 @@
+package pals
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/padding"
+	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
+)
+
+// ErrNoCollision is returned when no glue block is accepted within the search limit
+var ErrNoCollision = errors.New("no acceptable collision found")
+
+// how many filler blocks ForgeCBCMACCollision tries before giving up
+const collisionAttempts = 1 << 16
+
+// CBCMAC is the last block of the AES_CBC encryption of msg under k.
+// A nil IV is the fixed all-zero IV; otherwise the IV is chosen by the sender and sent alongside the message.
+func CBCMAC(k Key, iv IV, msg []byte) ([]byte, error) {
+	if iv == nil {
+		iv = make(IV, aes.BlockSize)
+	}
+	// copy msg, since PKCS padding appends to it
+	cbc := AES_CBC{Plaintext: append([]byte{}, msg...), IV: iv}
+	c, err := cbc.Encrypt(k)
+	if err != nil {
+		return nil, err
+	}
+	return c[len(c)-aes.BlockSize:], nil
+}
+
+// VerifyCBCMAC reports whether mac is the CBCMAC of msg under k and iv
+func VerifyCBCMAC(k Key, iv IV, msg, mac []byte) (bool, error) {
+	want, err := CBCMAC(k, iv, msg)
+	if err != nil {
+		return false, err
+	}
+	return hmac.Equal(want, mac), nil
+}
+
+// ForgeCBCMACIV returns the IV under which forged has the same CBCMAC as msg under iv.
+// The two messages may only differ in their first block.
+func ForgeCBCMACIV(msg []byte, iv IV, forged []byte) (IV, error) {
+	bs := aes.BlockSize
+	if len(msg) < bs || len(forged) < bs {
+		return nil, fmt.Errorf("messages must be at least a block long")
+	}
+	if !bytes.Equal(msg[bs:], forged[bs:]) {
+		return nil, fmt.Errorf("forged message differs from the original after the first block")
+	}
+	x, err := utils.FixedXor(msg[:bs], forged[:bs])
+	if err != nil {
+		return nil, err
+	}
+	return utils.FixedXor(iv, x)
+}
+
+// ExtendCBCMAC glues suffix onto msg so that, under a fixed zero IV, the result has the CBCMAC of suffix.
+// mac is the CBCMAC of msg; suffix must be at least a block long, since its first block is replaced by glue.
+func ExtendCBCMAC(msg, mac, suffix []byte) ([]byte, error) {
+	bs := aes.BlockSize
+	if len(suffix) < bs {
+		return nil, fmt.Errorf("suffix of %d bytes is shorter than a block", len(suffix))
+	}
+	glue, err := utils.FixedXor(suffix[:bs], mac)
+	if err != nil {
+		return nil, err
+	}
+	forged := padding.PKCSPadding(append([]byte{}, msg...), bs)
+	forged = append(forged, glue...)
+	return append(forged, suffix[bs:]...), nil
+}
+
+// ForgeCBCMACCollision returns a message starting with prefix that has the same CBCMAC as target, under a
+// Key and IV that are public, as when CBC-MAC is used as a hash. The prefix is filled out to a block boundary
+// with a filler block, varied until accept (if set) takes the glue block that joins it to the rest of target.
+func ForgeCBCMACCollision(k Key, iv IV, target, prefix []byte, accept func(glue []byte) bool) ([]byte, error) {
+	bs := aes.BlockSize
+	if len(target) < bs {
+		return nil, fmt.Errorf("target of %d bytes is shorter than a block", len(target))
+	}
+	if iv == nil {
+		iv = make(IV, bs)
+	}
+	c, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	head := append([]byte{}, prefix...)
+	if r := len(head) % bs; r != 0 {
+		head = append(head, bytes.Repeat([]byte{' '}, bs-r)...)
+	}
+	// chaining value after the prefix, without padding
+	state := iv
+	for _, block := range chunk(head, bs) {
+		state = encryptSingleBlock(c, utils.FlexibleXor(block, state))
+	}
+	// the first block of target is encrypted as target[:bs] XOR iv; the glue makes the chain arrive there too
+	want, err := utils.FixedXor(target[:bs], iv)
+	if err != nil {
+		return nil, err
+	}
+	for attempt := 0; attempt < collisionAttempts; attempt++ {
+		filler := []byte(fmt.Sprintf("%0*x", bs, attempt))
+		s := encryptSingleBlock(c, utils.FlexibleXor(filler, state))
+		glue, err := utils.FixedXor(s, want)
+		if err != nil {
+			return nil, err
+		}
+		if accept != nil && !accept(glue) {
+			continue
+		}
+		forged := append(append([]byte{}, head...), filler...)
+		forged = append(forged, glue...)
+		return append(forged, target[bs:]...), nil
+	}
+	return nil, ErrNoCollision
+}
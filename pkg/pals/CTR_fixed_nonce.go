@@ -0,0 +1,169 @@
+package pals
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
+)
+
+// defaults for BreakFixedNonceCTR
+const (
+	defaultRefineBelow     = 0.5
+	refineWindow           = 4
+	refineCandidatesPerCol = 8
+)
+
+// Crib is Plaintext known to appear at Offset in the Ciphertext at Index
+type Crib struct {
+	Index  int
+	Offset int
+	Text   []byte
+}
+
+// FixedNonceOptions tune BreakFixedNonceCTR
+type FixedNonceOptions struct {
+	// Refine re-scores low-confidence columns with the Scorer, using the neighbouring Plaintext as context
+	Refine bool
+	// RefineBelow is the confidence under which a column is refined
+	RefineBelow float64
+	// Scorer judges the columns and the windows of Plaintext that are refined, DefaultScorer if nil
+	Scorer Scorer
+	// Cribs fix Keystream bytes outright
+	Cribs []Crib
+}
+
+// FixedNonceResult is the recovered Keystream, with a confidence between 0 and 1 for every byte
+type FixedNonceResult struct {
+	Keystream  []byte
+	Confidence []float64
+	Plaintexts []Plaintext
+}
+
+type keyCandidate struct {
+	key   byte
+	score float64
+}
+
+// BreakFixedNonceCTR recovers the Keystream shared by Ciphertexts encrypted under the same CTR Key and nonce.
+// Each column of the Keystream is solved as a single-byte XOR over every Ciphertext long enough to cover it,
+// so the tails of the longer Ciphertexts are recovered too, with less confidence.
+func BreakFixedNonceCTR(ciphertexts []Ciphertext, opts FixedNonceOptions) (FixedNonceResult, error) {
+	var maxLen int
+	for _, c := range ciphertexts {
+		if len(c) > maxLen {
+			maxLen = len(c)
+		}
+	}
+	s := scorerOrDefault(opts.Scorer)
+	res := FixedNonceResult{Keystream: make([]byte, maxLen), Confidence: make([]float64, maxLen)}
+	candidates := make([][]keyCandidate, maxLen)
+	for i := 0; i < maxLen; i++ {
+		candidates[i] = scoreColumn(column(ciphertexts, i), columnScorer(s))
+		res.Keystream[i] = candidates[i][0].key
+		res.Confidence[i] = columnConfidence(candidates[i])
+	}
+	locked := make([]bool, maxLen)
+	for _, crib := range opts.Cribs {
+		if crib.Index < 0 || crib.Index >= len(ciphertexts) || crib.Offset < 0 || crib.Offset+len(crib.Text) > len(ciphertexts[crib.Index]) {
+			return res, fmt.Errorf("crib %q at %d of Ciphertext %d is out of range", crib.Text, crib.Offset, crib.Index)
+		}
+		for t, p := range crib.Text {
+			i := crib.Offset + t
+			res.Keystream[i] = ciphertexts[crib.Index][i] ^ p
+			res.Confidence[i] = 1
+			locked[i] = true
+		}
+	}
+	if opts.Refine {
+		refineColumns(ciphertexts, &res, candidates, locked, s, opts.RefineBelow)
+	}
+	for _, c := range ciphertexts {
+		p, err := utils.FixedXor(c, res.Keystream[:len(c)])
+		if err != nil {
+			return res, err
+		}
+		res.Plaintexts = append(res.Plaintexts, p)
+	}
+	return res, nil
+}
+
+// column returns byte i of every Ciphertext long enough to have one
+func column(ciphertexts []Ciphertext, i int) []byte {
+	var col []byte
+	for _, c := range ciphertexts {
+		if len(c) > i {
+			col = append(col, c[i])
+		}
+	}
+	return col
+}
+
+// scoreColumn ranks every single-byte Key for the column, best first
+func scoreColumn(col []byte, s Scorer) []keyCandidate {
+	candidates := make([]keyCandidate, 256)
+	decrypted := make([]byte, len(col))
+	for k := 0; k < 256; k++ {
+		for j, b := range col {
+			decrypted[j] = b ^ byte(k)
+		}
+		candidates[k] = keyCandidate{key: byte(k), score: s.Score(decrypted)}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score < candidates[j].score
+	})
+	return candidates
+}
+
+// columnConfidence is how far ahead the best candidate is of the runner up
+func columnConfidence(candidates []keyCandidate) float64 {
+	best, next := candidates[0].score, candidates[1].score
+	if next <= 0 {
+		return 0
+	}
+	return 1 - best/next
+}
+
+// refineColumns re-picks the Keystream byte of each low-confidence column from its best few candidates,
+// scoring the Plaintext around it in every row with s
+func refineColumns(ciphertexts []Ciphertext, res *FixedNonceResult, candidates [][]keyCandidate, locked []bool, s Scorer, threshold float64) {
+	if threshold == 0 {
+		threshold = defaultRefineBelow
+	}
+	for i := range res.Keystream {
+		if locked[i] || res.Confidence[i] >= threshold {
+			continue
+		}
+		top := candidates[i]
+		if len(top) > refineCandidatesPerCol {
+			top = top[:refineCandidatesPerCol]
+		}
+		var scored []keyCandidate
+		for _, cand := range top {
+			res.Keystream[i] = cand.key
+			var score float64
+			for _, c := range ciphertexts {
+				if len(c) <= i {
+					continue
+				}
+				start, end := i-refineWindow, i+refineWindow+1
+				if start < 0 {
+					start = 0
+				}
+				if end > len(c) {
+					end = len(c)
+				}
+				window, _ := utils.FixedXor(c[start:end], res.Keystream[start:end])
+				score += s.Score(window)
+			}
+			scored = append(scored, keyCandidate{key: cand.key, score: score})
+		}
+		sort.SliceStable(scored, func(a, b int) bool {
+			return scored[a].score < scored[b].score
+		})
+		res.Keystream[i] = scored[0].key
+		if len(scored) > 1 {
+			res.Confidence[i] = columnConfidence(scored)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package pals
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/padding"
+)
+
+// Codebook maps ECB Ciphertext blocks to the Plaintext blocks behind them. ECB encrypts equal blocks
+// to equal blocks under one Key, so a block learned from one known Plaintext decrypts it everywhere else.
+type Codebook struct {
+	Blocksize int
+	blocks    map[string][]byte
+}
+
+// NewCodebook makes an empty Codebook for blocks of blocksize bytes, which must be positive
+func NewCodebook(blocksize int) (*Codebook, error) {
+	if blocksize <= 0 {
+		return nil, fmt.Errorf("block size %d must be positive", blocksize)
+	}
+	return &Codebook{Blocksize: blocksize, blocks: make(map[string][]byte)}, nil
+}
+
+// Add records a single block mapping, such as a guess. It fails if the Ciphertext block is already mapped
+// to a different Plaintext block, which means the pairs did not come from the same Key.
+func (cb *Codebook) Add(c, p []byte) error {
+	if len(c) != cb.Blocksize || len(p) != cb.Blocksize {
+		return fmt.Errorf("blocks must be %d bytes, got %d and %d", cb.Blocksize, len(c), len(p))
+	}
+	if known, ok := cb.blocks[string(c)]; ok {
+		if !bytes.Equal(known, p) {
+			return fmt.Errorf("block %x already maps to %q, not %q", c, known, p)
+		}
+		return nil
+	}
+	cb.blocks[string(c)] = append([]byte{}, p...)
+	return nil
+}
+
+// Learn records every block of a known pair. The Plaintext is PKCS padded, as AES_ECB pads it.
+func (cb *Codebook) Learn(plain Plaintext, c Ciphertext) error {
+	padded := padding.PKCSPadding(append([]byte{}, plain...), cb.Blocksize)
+	if len(padded) != len(c) {
+		return fmt.Errorf("padded Plaintext is %d bytes but Ciphertext is %d", len(padded), len(c))
+	}
+	for i := 0; i < len(c); i += cb.Blocksize {
+		if err := cb.Add(c[i:i+cb.Blocksize], padded[i:i+cb.Blocksize]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LearnFrom encrypts each Plaintext with the oracle and learns the pair
+func (cb *Codebook) LearnFrom(encrypt EncryptionFn, plaintexts [][]byte) error {
+	for _, p := range plaintexts {
+		c, err := encrypt(append([]byte{}, p...))
+		if err != nil {
+			return err
+		}
+		if err := cb.Learn(p, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Len is the number of blocks learned
+func (cb *Codebook) Len() int {
+	return len(cb.blocks)
+}
+
+// Lookup returns the Plaintext block behind a Ciphertext block, if it has been learned
+func (cb *Codebook) Lookup(c []byte) ([]byte, bool) {
+	p, ok := cb.blocks[string(c)]
+	return p, ok
+}
+
+// PartialDecryption is a Ciphertext decrypted as far as a Codebook allows
+type PartialDecryption struct {
+	Blocksize  int
+	Ciphertext Ciphertext
+	// Blocks holds the Plaintext of each block, nil where the block is unknown
+	Blocks [][]byte
+}
+
+// Known is the number of blocks that were decrypted
+func (d PartialDecryption) Known() int {
+	var n int
+	for _, b := range d.Blocks {
+		if b != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Complete reports whether every block was decrypted
+func (d PartialDecryption) Complete() bool {
+	return d.Known() == len(d.Blocks)
+}
+
+// Marked joins the decrypted blocks, with mark repeated over each unknown block
+func (d PartialDecryption) Marked(mark byte) Plaintext {
+	var p []byte
+	for _, b := range d.Blocks {
+		if b == nil {
+			b = bytes.Repeat([]byte{mark}, d.Blocksize)
+		}
+		p = append(p, b...)
+	}
+	return p
+}
+
+// String shows known blocks as quoted text and unknown blocks as the first bytes of their Ciphertext,
+// so the same unknown block can be spotted across messages
+func (d PartialDecryption) String() string {
+	var parts []string
+	for i, b := range d.Blocks {
+		if b == nil {
+			c := d.Ciphertext[i*d.Blocksize : (i+1)*d.Blocksize]
+			if len(c) > 4 {
+				c = c[:4]
+			}
+			parts = append(parts, fmt.Sprintf("[? %s]", hex.EncodeToString(c)))
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%q", b))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Decrypt decrypts every block of c that the Codebook knows
+func (cb *Codebook) Decrypt(c Ciphertext) (PartialDecryption, error) {
+	if len(c)%cb.Blocksize != 0 {
+		return PartialDecryption{}, fmt.Errorf("Ciphertext of %d bytes is not a multiple of the block size %d", len(c), cb.Blocksize)
+	}
+	d := PartialDecryption{Blocksize: cb.Blocksize, Ciphertext: c}
+	for _, block := range chunk(c, cb.Blocksize) {
+		p, _ := cb.Lookup(block)
+		d.Blocks = append(d.Blocks, p)
+	}
+	return d, nil
+}
+
+// DecryptAll decrypts every Ciphertext of the corpus as far as the Codebook allows
+func (cb *Codebook) DecryptAll(corpus []Ciphertext) ([]PartialDecryption, error) {
+	var all []PartialDecryption
+	for i, c := range corpus {
+		d, err := cb.Decrypt(c)
+		if err != nil {
+			return nil, fmt.Errorf("Ciphertext %d: %w", i, err)
+		}
+		all = append(all, d)
+	}
+	return all, nil
+}
+
+// BlockFrequency counts how often a Ciphertext block appears in a corpus
+type BlockFrequency struct {
+	Block []byte
+	// Count is the number of times the block appears, and Messages the number of Ciphertexts it appears in
+	Count    int
+	Messages int
+	// Positions is the block index of each appearance
+	Positions []int
+	// Plaintext is the learned Plaintext of the block, nil if it is unknown
+	Plaintext []byte
+}
+
+// BlockStats counts every block of the corpus, most frequent first. Frequent unknown blocks are the best
+// ones to guess: a fixed field or a common value, at a block index that hints at what precedes it.
+func (cb *Codebook) BlockStats(corpus []Ciphertext) []BlockFrequency {
+	stats := make(map[string]*BlockFrequency)
+	var order []string
+	for _, c := range corpus {
+		seen := make(map[string]bool)
+		for i, block := range chunk(c, cb.Blocksize) {
+			if len(block) < cb.Blocksize {
+				continue
+			}
+			k := string(block)
+			f, ok := stats[k]
+			if !ok {
+				p, _ := cb.Lookup(block)
+				f = &BlockFrequency{Block: []byte(k), Plaintext: p}
+				stats[k] = f
+				order = append(order, k)
+			}
+			f.Count++
+			f.Positions = append(f.Positions, i)
+			if !seen[k] {
+				f.Messages++
+				seen[k] = true
+			}
+		}
+	}
+	freqs := make([]BlockFrequency, len(order))
+	for i, k := range order {
+		freqs[i] = *stats[k]
+	}
+	sort.SliceStable(freqs, func(i, j int) bool {
+		return freqs[i].Count > freqs[j].Count
+	})
+	return freqs
+}
@@ -0,0 +1,243 @@
+package pals
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Distribution is the public frequency of each Plaintext value of a column, such as census name counts.
+// Weights need not sum to 1.
+type Distribution map[string]float64
+
+// ReadDistribution reads a CSV of value,weight rows. A first row whose weight is not a number is taken as a header.
+func ReadDistribution(filename string) (Distribution, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = 2
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	d := make(Distribution)
+	for i, row := range rows {
+		w, err := strconv.ParseFloat(strings.TrimSpace(row[1]), 64)
+		if err != nil {
+			if i == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+		d[row[0]] += w
+	}
+	return d, nil
+}
+
+// ReadEncryptedColumn reads the named column of a CSV with a header row. Each value is decoded as hex or
+// base64, whichever it looks like.
+func ReadEncryptedColumn(r io.Reader, column string) ([]Ciphertext, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no header row")
+	}
+	index := -1
+	for i, name := range rows[0] {
+		if name == column {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("no column %q in %v", column, rows[0])
+	}
+	var values []Ciphertext
+	for i, row := range rows[1:] {
+		encoding, c := DetectEncoding([]byte(row[index]))
+		if encoding == Raw {
+			return nil, fmt.Errorf("row %d: %q is neither hex nor base64", i+2, row[index])
+		}
+		values = append(values, c)
+	}
+	return values, nil
+}
+
+// ColumnGuess is the Plaintext matched to one distinct Ciphertext value of a column
+type ColumnGuess struct {
+	Ciphertext Ciphertext
+	// Count is the number of rows holding the Ciphertext
+	Count int
+	// Plaintext is nil when there were fewer public values of the right length than Ciphertexts
+	Plaintext Plaintext
+}
+
+// ColumnRecovery maps every distinct Ciphertext of a column to its guessed Plaintext, most frequent first
+type ColumnRecovery struct {
+	Guesses []ColumnGuess
+	byValue map[string]Plaintext
+}
+
+// Decrypt returns the guessed Plaintext of a single value
+func (r ColumnRecovery) Decrypt(c Ciphertext) (Plaintext, bool) {
+	p, ok := r.byValue[string(c)]
+	return p, ok && p != nil
+}
+
+// DecryptColumn returns the guessed Plaintext of every row, nil where there is no guess
+func (r ColumnRecovery) DecryptColumn(column []Ciphertext) []Plaintext {
+	plain := make([]Plaintext, len(column))
+	for i, c := range column {
+		plain[i], _ = r.Decrypt(c)
+	}
+	return plain
+}
+
+// FrequencyAttack matches the frequency rank of each distinct Ciphertext to the rank of a public value.
+// ECB encrypts equal values to equal Ciphertexts, and values longer than a block still pad to a fixed number
+// of blocks, so ranks are only matched between Ciphertexts and values that pad to the same length.
+// blocksize is that of the cipher the column was encrypted with, aes.BlockSize for AES_ECB.
+func FrequencyAttack(column []Ciphertext, aux Distribution, blocksize int) ColumnRecovery {
+	counts := make(map[string]int)
+	var order []string
+	for _, c := range column {
+		if counts[string(c)] == 0 {
+			order = append(order, string(c))
+		}
+		counts[string(c)]++
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return counts[order[i]] > counts[order[j]]
+	})
+
+	values := make(map[int][]string)
+	for v := range aux {
+		l := paddedLength(len(v), blocksize)
+		values[l] = append(values[l], v)
+	}
+	for _, vs := range values {
+		sort.Slice(vs, func(i, j int) bool {
+			if aux[vs[i]] != aux[vs[j]] {
+				return aux[vs[i]] > aux[vs[j]]
+			}
+			return vs[i] < vs[j]
+		})
+	}
+
+	r := ColumnRecovery{byValue: make(map[string]Plaintext)}
+	used := make(map[int]int)
+	for _, c := range order {
+		g := ColumnGuess{Ciphertext: Ciphertext(c), Count: counts[c]}
+		if vs := values[len(c)]; used[len(c)] < len(vs) {
+			g.Plaintext = Plaintext(vs[used[len(c)]])
+			used[len(c)]++
+		}
+		r.Guesses = append(r.Guesses, g)
+		r.byValue[c] = g.Plaintext
+	}
+	return r
+}
+
+// paddedLength is the length of a PKCS padded ECB Ciphertext of an n byte value
+func paddedLength(n, blocksize int) int {
+	return (n/blocksize + 1) * blocksize
+}
+
+// ColumnAccuracy is how much of a column a FrequencyAttack recovered
+type ColumnAccuracy struct {
+	Rows, RowsCorrect     int
+	Values, ValuesCorrect int
+}
+
+// RowRate is the fraction of rows recovered
+func (a ColumnAccuracy) RowRate() float64 {
+	if a.Rows == 0 {
+		return 0
+	}
+	return float64(a.RowsCorrect) / float64(a.Rows)
+}
+
+// ValueRate is the fraction of distinct values recovered
+func (a ColumnAccuracy) ValueRate() float64 {
+	if a.Values == 0 {
+		return 0
+	}
+	return float64(a.ValuesCorrect) / float64(a.Values)
+}
+
+func (a ColumnAccuracy) String() string {
+	return fmt.Sprintf("%d/%d rows (%.1f%%), %d/%d distinct values (%.1f%%) recovered",
+		a.RowsCorrect, a.Rows, 100*a.RowRate(), a.ValuesCorrect, a.Values, 100*a.ValueRate())
+}
+
+// MeasureColumnAccuracy compares the recovered column against the true Plaintexts
+func MeasureColumnAccuracy(r ColumnRecovery, column []Ciphertext, truth []Plaintext) ColumnAccuracy {
+	a := ColumnAccuracy{Rows: len(column)}
+	seen := make(map[string]bool)
+	for i, c := range column {
+		p, ok := r.Decrypt(c)
+		correct := ok && string(p) == string(truth[i])
+		if correct {
+			a.RowsCorrect++
+		}
+		if !seen[string(c)] {
+			seen[string(c)] = true
+			a.Values++
+			if correct {
+				a.ValuesCorrect++
+			}
+		}
+	}
+	return a
+}
+
+// SimulateColumn draws rows values from the distribution and encrypts each with AES_ECB under k,
+// returning the encrypted column and the Plaintext of each row
+func SimulateColumn(d Distribution, rows int, k Key, rng *rand.Rand) ([]Ciphertext, []Plaintext, error) {
+	var values []string
+	var total float64
+	for v, w := range d {
+		values = append(values, v)
+		total += w
+	}
+	if len(values) == 0 || total <= 0 {
+		return nil, nil, fmt.Errorf("empty distribution")
+	}
+	// map iteration order is random, so sort for a reproducible draw from a seeded rng
+	sort.Strings(values)
+	encrypted := make(map[string]Ciphertext)
+	var column []Ciphertext
+	var truth []Plaintext
+	for i := 0; i < rows; i++ {
+		x := rng.Float64() * total
+		v := values[len(values)-1]
+		for _, candidate := range values {
+			if x < d[candidate] {
+				v = candidate
+				break
+			}
+			x -= d[candidate]
+		}
+		c, ok := encrypted[v]
+		if !ok {
+			var err error
+			c, err = NewAESECB(Plaintext(v)).Encrypt(k)
+			if err != nil {
+				return nil, nil, err
+			}
+			encrypted[v] = c
+		}
+		column = append(column, c)
+		truth = append(truth, Plaintext(v))
+	}
+	return column, truth, nil
+}
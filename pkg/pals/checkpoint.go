@@ -0,0 +1,118 @@
+package pals
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// CheckpointVersion is the checkpoint file format written by Checkpointer
+const CheckpointVersion = 1
+
+// how many candidates a search tries between checkpoints when Checkpointer.Every is unset
+const defaultCheckpointInterval = 1024
+
+// Checkpoint is the serialized state of an interrupted attack
+type Checkpoint struct {
+	Version int    `json:"version"`
+	Attack  string `json:"attack"`
+	// Target fingerprints the inputs, so a checkpoint is never resumed against a different Ciphertext
+	Target []byte `json:"target"`
+	// Cursor is the next seed, time offset or block to try
+	Cursor int `json:"cursor"`
+	// Anchor pins the reference point of a search, such as the newest timestamp in a time window
+	Anchor int64 `json:"anchor,omitempty"`
+	// Recovered is the Plaintext recovered so far
+	Recovered []byte `json:"recovered,omitempty"`
+	// Block is the partial state of the block in progress
+	Block []byte `json:"block,omitempty"`
+}
+
+// Checkpointer periodically saves an attack's state to Path, and resumes from it on the next run.
+// The file is removed once the attack completes.
+type Checkpointer struct {
+	Path string
+	// Every is how many candidates a seed search tries between saves; the padding oracle saves after every byte
+	Every int
+}
+
+func (c *Checkpointer) interval() int {
+	if c == nil || c.Every <= 0 {
+		return defaultCheckpointInterval
+	}
+	return c.Every
+}
+
+// resume returns the saved checkpoint for this attack and target, or nil if there is none
+func (c *Checkpointer) resume(attack string, target []byte) (*Checkpoint, error) {
+	if c == nil {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(c.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return nil, fmt.Errorf("checkpoint %s is corrupt: %w", c.Path, err)
+	}
+	if cp.Version != CheckpointVersion {
+		return nil, fmt.Errorf("checkpoint %s has version %d, want %d", c.Path, cp.Version, CheckpointVersion)
+	}
+	if cp.Attack != attack || !bytes.Equal(cp.Target, target) {
+		return nil, fmt.Errorf("checkpoint %s belongs to a different %s run", c.Path, cp.Attack)
+	}
+	return &cp, nil
+}
+
+// save atomically replaces the checkpoint file with cp
+func (c *Checkpointer) save(cp Checkpoint) error {
+	if c == nil {
+		return nil
+	}
+	cp.Version = CheckpointVersion
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp := c.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.Path)
+}
+
+// done removes the checkpoint of a completed attack
+func (c *Checkpointer) done() error {
+	if c == nil {
+		return nil
+	}
+	if err := os.Remove(c.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// saveAfterInterruption saves the state an interrupted attack stopped in, returning the interruption
+func saveAfterInterruption(c *Checkpointer, cp Checkpoint, interruption error) error {
+	if err := c.save(cp); err != nil {
+		return err
+	}
+	return interruption
+}
+
+// checkpointTarget fingerprints the inputs of an attack
+func checkpointTarget(inputs ...[]byte) []byte {
+	h := sha256.New()
+	for _, in := range inputs {
+		fmt.Fprintf(h, "%d:", len(in))
+		h.Write(in)
+	}
+	return h.Sum(nil)
+}
@@ -0,0 +1,203 @@
+package pals
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
+)
+
+// CribSessionVersion is the session file format written by CribSession.Save
+const CribSessionVersion = 1
+
+// CribSession is a crib-dragging analysis of Ciphertexts that share a Keystream,
+// such as fixed-nonce CTR or AES_MT under a reused seed
+type CribSession struct {
+	Version     int          `json:"version"`
+	Ciphertexts []Ciphertext `json:"ciphertexts"`
+	Keystream   []byte       `json:"keystream"`
+	Known       []bool       `json:"known"`
+	// Scorer ranks the placements Drag finds and fills the Keystream in FillFromStatistics, DefaultScorer
+	// if nil. It is not saved with the session.
+	Scorer Scorer `json:"-"`
+}
+
+// CribPlacement is what a crib implies about every other Ciphertext when placed at Offset
+type CribPlacement struct {
+	Offset int
+	// Implied holds the Plaintext each Ciphertext would have under the crib, or nil if it is too short to reach
+	Implied [][]byte
+	// Printable is the fraction of implied bytes that are printable
+	Printable float64
+	// Score is the session Scorer's score of the implied text, lower is better
+	Score float64
+}
+
+func NewCribSession(ciphertexts []Ciphertext) *CribSession {
+	var maxLen int
+	for _, c := range ciphertexts {
+		if len(c) > maxLen {
+			maxLen = len(c)
+		}
+	}
+	return &CribSession{
+		Version:     CribSessionVersion,
+		Ciphertexts: ciphertexts,
+		Keystream:   make([]byte, maxLen),
+		Known:       make([]bool, maxLen),
+	}
+}
+
+// Drag places the crib at every offset of the Ciphertext at index, returning the placements
+// that leave the other Ciphertexts most plausible first
+func (s *CribSession) Drag(index int, crib []byte) ([]CribPlacement, error) {
+	if index < 0 || index >= len(s.Ciphertexts) {
+		return nil, fmt.Errorf("no Ciphertext %d", index)
+	}
+	target := s.Ciphertexts[index]
+	scorer := scorerOrDefault(s.Scorer)
+	var placements []CribPlacement
+	for offset := 0; offset+len(crib) <= len(target); offset++ {
+		keystream, err := utils.FixedXor(target[offset:offset+len(crib)], crib)
+		if err != nil {
+			return nil, err
+		}
+		p := CribPlacement{Offset: offset, Implied: make([][]byte, len(s.Ciphertexts))}
+		var all []byte
+		for i, c := range s.Ciphertexts {
+			if i == index || len(c) <= offset {
+				continue
+			}
+			end := offset + len(crib)
+			if end > len(c) {
+				end = len(c)
+			}
+			p.Implied[i], _ = utils.FixedXor(c[offset:end], keystream[:end-offset])
+			all = append(all, p.Implied[i]...)
+		}
+		p.Printable = printableRatio(all)
+		p.Score = scorer.Score(all)
+		placements = append(placements, p)
+	}
+	sort.SliceStable(placements, func(i, j int) bool {
+		if placements[i].Printable != placements[j].Printable {
+			return placements[i].Printable > placements[j].Printable
+		}
+		return placements[i].Score < placements[j].Score
+	})
+	return placements, nil
+}
+
+// Lock records that text appears at offset in the Ciphertext at index, fixing the Keystream underneath it
+func (s *CribSession) Lock(index, offset int, text []byte) error {
+	if index < 0 || index >= len(s.Ciphertexts) {
+		return fmt.Errorf("no Ciphertext %d", index)
+	}
+	c := s.Ciphertexts[index]
+	if offset < 0 || offset+len(text) > len(c) {
+		return fmt.Errorf("%q at offset %d runs past the end of Ciphertext %d", text, offset, index)
+	}
+	for i, p := range text {
+		s.Keystream[offset+i] = c[offset+i] ^ p
+		s.Known[offset+i] = true
+	}
+	return nil
+}
+
+// Unlock forgets the Keystream bytes from offset to offset+length
+func (s *CribSession) Unlock(offset, length int) {
+	for i := offset; i < offset+length && i < len(s.Known); i++ {
+		if i >= 0 {
+			s.Keystream[i] = 0
+			s.Known[i] = false
+		}
+	}
+}
+
+// FillFromStatistics solves the Keystream with BreakFixedNonceCTR and keeps the unknown bytes
+// it is at least minConfidence sure of, returning how many were filled
+func (s *CribSession) FillFromStatistics(minConfidence float64) (int, error) {
+	res, err := BreakFixedNonceCTR(s.Ciphertexts, FixedNonceOptions{Refine: true, Scorer: s.Scorer})
+	if err != nil {
+		return 0, err
+	}
+	var filled int
+	for i := range s.Keystream {
+		if !s.Known[i] && res.Confidence[i] >= minConfidence {
+			s.Keystream[i] = res.Keystream[i]
+			s.Known[i] = true
+			filled++
+		}
+	}
+	return filled, nil
+}
+
+// Plaintexts decrypts every Ciphertext under the known Keystream; known[i][j] reports whether byte j of Plaintext i is known
+func (s *CribSession) Plaintexts() (plaintexts [][]byte, known [][]bool) {
+	for _, c := range s.Ciphertexts {
+		p := make([]byte, len(c))
+		k := make([]bool, len(c))
+		for j := range c {
+			if s.Known[j] {
+				p[j] = c[j] ^ s.Keystream[j]
+				k[j] = true
+			}
+		}
+		plaintexts = append(plaintexts, p)
+		known = append(known, k)
+	}
+	return plaintexts, known
+}
+
+// Save writes the session to filename as JSON
+func (s *CribSession) Save(filename string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, b, 0644)
+}
+
+// LoadCribSession reads a session written by Save
+func LoadCribSession(filename string) (*CribSession, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var s CribSession
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+	if s.Version != CribSessionVersion {
+		return nil, fmt.Errorf("session %s has version %d, want %d", filename, s.Version, CribSessionVersion)
+	}
+	if len(s.Keystream) != len(s.Known) {
+		return nil, fmt.Errorf("session %s is corrupt: %d Keystream bytes but %d known flags", filename, len(s.Keystream), len(s.Known))
+	}
+	for i, c := range s.Ciphertexts {
+		if len(c) > len(s.Keystream) {
+			return nil, fmt.Errorf("session %s is corrupt: Ciphertext %d is %d bytes but the Keystream only %d", filename, i, len(c), len(s.Keystream))
+		}
+	}
+	return &s, nil
+}
+
+// IsPrintable reports whether b is printable ASCII or common whitespace
+func IsPrintable(b byte) bool {
+	return (b >= 0x20 && b < 0x7f) || b == '\n' || b == '\r' || b == '\t'
+}
+
+func printableRatio(b []byte) float64 {
+	if len(b) == 0 {
+		return 0
+	}
+	var n int
+	for _, c := range b {
+		if IsPrintable(c) {
+			n++
+		}
+	}
+	return float64(n) / float64(len(b))
+}
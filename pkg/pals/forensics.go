@@ -0,0 +1,302 @@
+package pals
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
+)
+
+// encodings a ciphertext can be serialized in
+const (
+	Raw    Encoding = 0
+	Hex    Encoding = 1
+	Base64 Encoding = 2
+)
+
+type Encoding int
+
+func (e Encoding) String() string {
+	switch e {
+	case Raw:
+		return "raw"
+	case Hex:
+		return "hex"
+	case Base64:
+		return "base64"
+	}
+	return fmt.Sprintf("Encoding(%d)", int(e))
+}
+
+// candidate block sizes, in order of preference when the evidence is tied
+var forensicsBlocksizes = []int{16, 8}
+
+// likelihood that an ECB plaintext happens to contain a repeated block
+const ecbRepeatLikelihood = 0.5
+
+// RepeatedBlock is a Ciphertext block that occurs more than once
+type RepeatedBlock struct {
+	Block     []byte
+	Count     int
+	Positions []int
+}
+
+// ModeGuess is a candidate mode with a confidence between 0 and 1
+type ModeGuess struct {
+	Mode       AESMode
+	Confidence float64
+}
+
+// ForensicsReport summarizes what can be learned about a Ciphertext without the Key
+type ForensicsReport struct {
+	Line           int
+	Encoding       Encoding
+	Ciphertext     Ciphertext
+	Blocksize      int
+	RepeatedBlocks []RepeatedBlock
+	Entropy        float64
+	BlockEntropy   []float64
+	LengthModulus  map[int]int
+	Hints          []string
+	ModeGuesses    []ModeGuess
+}
+
+// Mode returns the highest ranked mode guess
+func (r ForensicsReport) Mode() ModeGuess {
+	if len(r.ModeGuesses) == 0 {
+		return ModeGuess{}
+	}
+	return r.ModeGuesses[0]
+}
+
+func (r ForensicsReport) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "encoding:   %s\n", r.Encoding)
+	fmt.Fprintf(&sb, "length:     %d bytes\n", len(r.Ciphertext))
+	fmt.Fprintf(&sb, "blocksize:  %d\n", r.Blocksize)
+	fmt.Fprintf(&sb, "entropy:    %.3f bits/byte\n", r.Entropy)
+	// a single byte block always has an entropy of 0, so there is nothing to show
+	if r.Blocksize > 1 && len(r.BlockEntropy) > 0 {
+		entropies := make([]string, len(r.BlockEntropy))
+		for i, e := range r.BlockEntropy {
+			entropies[i] = fmt.Sprintf("%.2f", e)
+		}
+		fmt.Fprintf(&sb, "per block:  %s bits/byte\n", strings.Join(entropies, " "))
+	}
+	moduli := make([]string, 0, len(r.LengthModulus))
+	for _, bs := range forensicsBlocksizes {
+		if m, ok := r.LengthModulus[bs]; ok {
+			moduli = append(moduli, fmt.Sprintf("%%%d=%d", bs, m))
+		}
+	}
+	if len(moduli) > 0 {
+		fmt.Fprintf(&sb, "length mod: %s\n", strings.Join(moduli, " "))
+	}
+	for _, rb := range r.RepeatedBlocks {
+		fmt.Fprintf(&sb, "repeated:   %x x%d at blocks %v\n", rb.Block, rb.Count, rb.Positions)
+	}
+	for _, h := range r.Hints {
+		fmt.Fprintf(&sb, "hint:       %s\n", h)
+	}
+	for _, g := range r.ModeGuesses {
+		fmt.Fprintf(&sb, "mode:       %-6s %.3f\n", g.Mode, g.Confidence)
+	}
+	return sb.String()
+}
+
+// DetectEncoding guesses whether the input is hex, base64 or raw bytes, and returns it decoded
+func DetectEncoding(b []byte) (Encoding, []byte) {
+	stripped := stripWhitespace(b)
+	if len(stripped) == 0 {
+		return Raw, b
+	}
+	if len(stripped)%2 == 0 {
+		if decoded, err := hex.DecodeString(string(stripped)); err == nil {
+			return Hex, decoded
+		}
+	}
+	if len(stripped)%4 == 0 {
+		if decoded, err := base64.StdEncoding.DecodeString(string(stripped)); err == nil {
+			return Base64, decoded
+		}
+	}
+	return Raw, b
+}
+
+func stripWhitespace(b []byte) []byte {
+	return bytes.Join(bytes.Fields(b), nil)
+}
+
+// AnalyzeCiphertext decodes the input and reports its likely structure and mode of encryption
+func AnalyzeCiphertext(input []byte) ForensicsReport {
+	encoding, c := DetectEncoding(input)
+	r := ForensicsReport{
+		Encoding:      encoding,
+		Ciphertext:    c,
+		Entropy:       shannonEntropy(c),
+		LengthModulus: make(map[int]int),
+	}
+	for _, bs := range forensicsBlocksizes {
+		r.LengthModulus[bs] = len(c) % bs
+	}
+	r.Blocksize = inferBlocksizeFromCiphertext(c)
+	if r.Blocksize > 1 {
+		r.RepeatedBlocks = findRepeatedBlocks(c, r.Blocksize)
+	}
+	for _, block := range chunk(c, r.Blocksize) {
+		r.BlockEntropy = append(r.BlockEntropy, shannonEntropy(block))
+	}
+	r.Hints = lengthHints(c, r.Blocksize)
+	r.ModeGuesses = rankModes(c, r.Blocksize, len(r.RepeatedBlocks) > 0)
+	return r
+}
+
+// AnalyzeCiphertextFile analyzes every line of the file as a separate candidate Ciphertext.
+// Reports are sorted by their confidence in ECB, most likely first.
+func AnalyzeCiphertextFile(filename string) ([]ForensicsReport, error) {
+	lines, err := utils.ScanFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var reports []ForensicsReport
+	for i, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		r := AnalyzeCiphertext([]byte(l))
+		r.Line = i + 1
+		reports = append(reports, r)
+	}
+	SortReportsByMode(reports, ECB)
+	return reports, nil
+}
+
+// SortReportsByMode orders reports by their confidence in mode m, most confident first
+func SortReportsByMode(reports []ForensicsReport, m AESMode) {
+	sort.SliceStable(reports, func(i, j int) bool {
+		return reports[i].confidence(m) > reports[j].confidence(m)
+	})
+}
+
+func (r ForensicsReport) confidence(m AESMode) float64 {
+	for _, g := range r.ModeGuesses {
+		if g.Mode == m {
+			return g.Confidence
+		}
+	}
+	return 0
+}
+
+// findRepeatedBlocks counts every block of the given size, returning those seen more than once in order of first appearance
+func findRepeatedBlocks(b []byte, blocksize int) []RepeatedBlock {
+	positions := make(map[string][]int)
+	var order []string
+	for i, block := range chunk(b, blocksize) {
+		if len(block) < blocksize {
+			continue
+		}
+		k := string(block)
+		if _, ok := positions[k]; !ok {
+			order = append(order, k)
+		}
+		positions[k] = append(positions[k], i)
+	}
+	var repeated []RepeatedBlock
+	for _, k := range order {
+		if p := positions[k]; len(p) > 1 {
+			repeated = append(repeated, RepeatedBlock{Block: []byte(k), Count: len(p), Positions: p})
+		}
+	}
+	return repeated
+}
+
+// inferBlocksizeFromCiphertext prefers the first block size in forensicsBlocksizes that shows repeats,
+// then the first that divides the length, and otherwise assumes a stream (block size 1)
+func inferBlocksizeFromCiphertext(c []byte) int {
+	best := 1
+	for _, bs := range forensicsBlocksizes {
+		if len(c) == 0 || len(c)%bs != 0 {
+			continue
+		}
+		if len(findRepeatedBlocks(c, bs)) > 0 {
+			return bs
+		}
+		if best == 1 {
+			best = bs
+		}
+	}
+	return best
+}
+
+func shannonEntropy(b []byte) float64 {
+	if len(b) == 0 {
+		return 0
+	}
+	var counts [256]int
+	for _, c := range b {
+		counts[c]++
+	}
+	var e float64
+	total := float64(len(b))
+	for _, n := range counts {
+		if n == 0 {
+			continue
+		}
+		p := float64(n) / total
+		e -= p * math.Log2(p)
+	}
+	return e
+}
+
+func lengthHints(c []byte, blocksize int) []string {
+	var hints []string
+	if blocksize == 1 {
+		hints = append(hints, fmt.Sprintf("length %d is not a multiple of any block size: a stream mode or unpadded plaintext", len(c)))
+		return hints
+	}
+	hints = append(hints, fmt.Sprintf("length %d is %d blocks of %d bytes: consistent with a padded block mode", len(c), len(c)/blocksize, blocksize))
+	if len(c) == blocksize {
+		hints = append(hints, "only one block: too short to tell ECB from CBC")
+	}
+	// a uniformly random byte string has close to log2(len) bits of entropy per byte when short
+	if expected := math.Min(8, math.Log2(float64(len(c)))); shannonEntropy(c) < expected-2 {
+		hints = append(hints, "entropy is well below random: this may not be encrypted at all")
+	}
+	return hints
+}
+
+// rankModes weighs each mode by how likely it is to have produced the observed length and repeats
+func rankModes(c []byte, blocksize int, repeats bool) []ModeGuess {
+	likelihoods := map[AESMode]float64{ECB: 1, CBC: 1, Stream: 1}
+	if blocksize == 1 {
+		likelihoods[ECB] = 1e-6
+		likelihoods[CBC] = 1e-6
+	} else {
+		// a stream Ciphertext lands on a block boundary by chance
+		likelihoods[Stream] = 1 / float64(blocksize)
+	}
+	if repeats {
+		likelihoods[ECB] *= ecbRepeatLikelihood
+		likelihoods[CBC] *= 1e-6
+		likelihoods[Stream] *= 1e-6
+	} else if len(c) > blocksize {
+		likelihoods[ECB] *= 1 - ecbRepeatLikelihood
+	}
+	var total float64
+	for _, l := range likelihoods {
+		total += l
+	}
+	var guesses []ModeGuess
+	for _, m := range []AESMode{ECB, CBC, Stream} {
+		guesses = append(guesses, ModeGuess{Mode: m, Confidence: likelihoods[m] / total})
+	}
+	sort.SliceStable(guesses, func(i, j int) bool {
+		return guesses[i].Confidence > guesses[j].Confidence
+	})
+	return guesses
+}
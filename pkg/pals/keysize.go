@@ -0,0 +1,128 @@
+package pals
+
+import (
+	"math"
+	"sort"
+)
+
+// defaultMaxKeysize is the longest repeating Key the estimators try when no maximum is given
+const defaultMaxKeysize = 40
+
+// the Hamming estimator compares every pair among at most this many blocks
+const maxHammingBlocks = 64
+
+// repeats of this many bytes are the ones the Kasiski estimator measures the spacing of
+const kasiskiRepeatLength = 3
+
+// KeysizeCandidate is a possible length of a repeating Key, scored so that lower is more likely
+type KeysizeCandidate struct {
+	Keysize int
+	Score   float64
+}
+
+// KeysizesByHamming scores each Keysize by the Hamming distance, in bits per byte, between every pair of
+// Keysize blocks. Blocks encrypted under the same Key differ only as much as their Plaintexts, which is
+// less than random bytes do. Only the first 64 blocks are compared, which keeps long Ciphertexts from
+// costing quadratic time and is plenty to tell Keysizes apart. Keysizes that don't fit two whole blocks
+// are not scored.
+func KeysizesByHamming(b []byte, maxKeysize int) []KeysizeCandidate {
+	var candidates []KeysizeCandidate
+	for Keysize := 1; Keysize <= keysizeLimit(maxKeysize) && 2*Keysize <= len(b); Keysize++ {
+		blocks := len(b) / Keysize
+		if blocks > maxHammingBlocks {
+			blocks = maxHammingBlocks
+		}
+		var bits, pairs int
+		for i := 0; i < blocks; i++ {
+			for j := i + 1; j < blocks; j++ {
+				d, err := hemmingDistanceBytes(b[i*Keysize:(i+1)*Keysize], b[j*Keysize:(j+1)*Keysize])
+				if err != nil {
+					continue
+				}
+				bits += d
+				pairs++
+			}
+		}
+		candidates = append(candidates, KeysizeCandidate{Keysize: Keysize, Score: float64(bits) / float64(pairs*Keysize)})
+	}
+	sortKeysizes(candidates)
+	return candidates
+}
+
+// KeysizesByIoC scores each Keysize by the index of coincidence of the columns it splits the Ciphertext
+// into. Each column is XORed with a single byte, which keeps the Plaintext's uneven byte frequencies, so the
+// right Keysize (and its multiples) gives columns that coincide more often than random bytes. The score is
+// 1 for random bytes and lower for text. Keysizes that leave a column shorter than 2 bytes are not scored.
+func KeysizesByIoC(b []byte, maxKeysize int) []KeysizeCandidate {
+	var candidates []KeysizeCandidate
+	for Keysize := 1; Keysize <= keysizeLimit(maxKeysize) && 2*Keysize <= len(b); Keysize++ {
+		var coincidences, pairs float64
+		for _, col := range transpose(chunk(b, Keysize), Keysize) {
+			var counts [256]float64
+			for _, c := range col {
+				counts[c]++
+			}
+			for _, n := range counts {
+				coincidences += n * (n - 1)
+			}
+			pairs += float64(len(col) * (len(col) - 1))
+		}
+		score := math.Inf(1)
+		if coincidences > 0 {
+			score = pairs / (256 * coincidences)
+		}
+		candidates = append(candidates, KeysizeCandidate{Keysize: Keysize, Score: score})
+	}
+	sortKeysizes(candidates)
+	return candidates
+}
+
+// KeysizesByKasiski scores each Keysize by how many of the spacings between repeated runs of Ciphertext it
+// divides. A run of Plaintext that repeats at a multiple of the Keysize repeats in the Ciphertext too, while
+// other repeats are chance. The score compares the fraction of spacings divided with the 1/Keysize expected
+// by chance: 1 is no better than chance, lower is more likely. Keysizes that divide no spacing are not
+// scored, so a short Ciphertext with no repeats gives no candidates.
+func KeysizesByKasiski(b []byte, maxKeysize int) []KeysizeCandidate {
+	last := map[string]int{}
+	var spacings []int
+	for i := 0; i+kasiskiRepeatLength <= len(b); i++ {
+		run := string(b[i : i+kasiskiRepeatLength])
+		if j, ok := last[run]; ok {
+			spacings = append(spacings, i-j)
+		}
+		last[run] = i
+	}
+	var candidates []KeysizeCandidate
+	for Keysize := 2; Keysize <= keysizeLimit(maxKeysize) && Keysize < len(b); Keysize++ {
+		var divided int
+		for _, s := range spacings {
+			if s%Keysize == 0 {
+				divided++
+			}
+		}
+		if divided == 0 {
+			continue
+		}
+		fraction := float64(divided) / float64(len(spacings))
+		candidates = append(candidates, KeysizeCandidate{Keysize: Keysize, Score: 1 / (fraction * float64(Keysize))})
+	}
+	sortKeysizes(candidates)
+	return candidates
+}
+
+func keysizeLimit(maxKeysize int) int {
+	if maxKeysize <= 0 {
+		return defaultMaxKeysize
+	}
+	return maxKeysize
+}
+
+// sortKeysizes puts the most likely Keysize first, and the shorter of two that score the same
+func sortKeysizes(c []KeysizeCandidate) {
+	sort.SliceStable(c, func(i, j int) bool {
+		if c[i].Score != c[j].Score {
+			return c[i].Score < c[j].Score
+		}
+		return c[i].Keysize < c[j].Keysize
+	})
+}
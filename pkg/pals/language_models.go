@@ -0,0 +1,172 @@
+package pals
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The models directory holds n-gram models written by cmd/trainlm, named <language>.<n>
+//
+//go:embed models
+var embeddedModels embed.FS
+
+var (
+	embeddedMu    sync.Mutex
+	embeddedCache = map[string]*NGramModel{}
+)
+
+// loadEmbeddedModel reads one of the models compiled into the package. The model is parsed once, and
+// every caller gets a copy of it, so one that Prunes or edits its model does not change anyone else's.
+func loadEmbeddedModel(file string) (*NGramModel, error) {
+	embeddedMu.Lock()
+	defer embeddedMu.Unlock()
+	if m, ok := embeddedCache[file]; ok {
+		return copyModel(m), nil
+	}
+	f, err := embeddedModels.Open("models/" + file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m, err := ReadNGramModel(f)
+	if err != nil {
+		return nil, fmt.Errorf("model %s: %w", file, err)
+	}
+	embeddedCache[file] = m
+	return copyModel(m), nil
+}
+
+func copyModel(m *NGramModel) *NGramModel {
+	c := &NGramModel{N: m.N, Total: m.Total, Counts: make(map[string]float64, len(m.Counts)), UTF8: m.UTF8}
+	for g, n := range m.Counts {
+		c.Counts[g] = n
+	}
+	return c
+}
+
+func mustLoadEmbeddedModel(file string) *NGramModel {
+	m, err := loadEmbeddedModel(file)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// EnglishBigrams is a bigram model of english prose
+func EnglishBigrams() *NGramModel {
+	return mustLoadEmbeddedModel("english.2")
+}
+
+// EnglishQuadgrams is a quadgram model of english prose
+func EnglishQuadgrams() *NGramModel {
+	return mustLoadEmbeddedModel("english.4")
+}
+
+// EnglishWords is a DictionaryScorer of common english words
+func EnglishWords() DictionaryScorer {
+	return NewDictionaryScorer(strings.Fields(commonEnglishWords))
+}
+
+const commonEnglishWords = `
+a about above after again against all also am an and any are as at back be because been before being
+below between both but by came can come could day did do does doing down during each even every few
+first for from further get give go good had has have having he her here hers herself him himself his
+how i if in into is it its itself just know last like little long look made make man many may me more
+most much must my myself new no nor not now of off on once one only or other our ours ourselves out
+over own people said same say see she should so some such take than that the their theirs them
+themselves then there these they thing think this those through time to too two under until up upon
+us use very want was way we well were what when where which while who whom why will with work would
+year you your yours yourself yourselves s t m ll d ve re don didn isn won
+`
+
+// scorers that are not n-gram models but can be asked for by name
+var namedScorers = map[string]Scorer{
+	"letterfrequency": LetterFrequencyScorer,
+	"chisquared":      ChiSquaredScorer{},
+	"printable":       PrintableScorer{},
+}
+
+// Models lists the names ScorerByName accepts: every built-in language or format, alone for its longest
+// n-gram model or with a suffix such as ".2" for a shorter one, and the scorers that are not n-gram models
+func Models() []string {
+	var names []string
+	seen := map[string]bool{}
+	entries, _ := fs.ReadDir(embeddedModels, "models")
+	for _, e := range entries {
+		lang := strings.SplitN(e.Name(), ".", 2)[0]
+		if !seen[lang] {
+			seen[lang] = true
+			names = append(names, lang)
+		}
+		names = append(names, e.Name())
+	}
+	for name := range namedScorers {
+		names = append(names, name)
+	}
+	names = append(names, "dictionary")
+	sort.Strings(names)
+	return names
+}
+
+// ScorerByName returns a built-in Scorer, such as "english", "german.2", "json" or "chisquared"
+func ScorerByName(name string) (Scorer, error) {
+	if s, ok := namedScorers[name]; ok {
+		return s, nil
+	}
+	if name == "dictionary" {
+		return EnglishWords(), nil
+	}
+	if strings.Contains(name, ".") {
+		if _, err := fs.Stat(embeddedModels, "models/"+name); err == nil {
+			return loadEmbeddedModel(name)
+		}
+		return nil, fmt.Errorf("no model %q, want one of %v", name, Models())
+	}
+	entries, _ := fs.ReadDir(embeddedModels, "models")
+	best, bestN := "", 0
+	for _, e := range entries {
+		parts := strings.SplitN(e.Name(), ".", 2)
+		if parts[0] != name || len(parts) != 2 {
+			continue
+		}
+		if n, err := strconv.Atoi(parts[1]); err == nil && n > bestN {
+			best, bestN = e.Name(), n
+		}
+	}
+	if best == "" {
+		return nil, fmt.Errorf("no model %q, want one of %v", name, Models())
+	}
+	return loadEmbeddedModel(best)
+}
+
+// SolveSingleByteXorCipherWithModel is SolveSingleByteXorCipher, judging the candidates with the named model
+func SolveSingleByteXorCipherWithModel(hBytes []byte, model string) (Plaintext, Key, error) {
+	s, err := ScorerByName(model)
+	if err != nil {
+		return nil, nil, err
+	}
+	return SolveSingleByteXorCipherWithScorer(hBytes, s)
+}
+
+// DetectSingleByteXorCipherWithModel is DetectSingleByteXorCipher, judging the candidates with the named model
+func DetectSingleByteXorCipherWithModel(lines []string, model string) (Plaintext, error) {
+	s, err := ScorerByName(model)
+	if err != nil {
+		return nil, err
+	}
+	return DetectSingleByteXorCipherWithScorer(lines, s)
+}
+
+// DecryptRepeatingKeyXorWithModel is DecryptRepeatingKeyXor, judging the candidates with the named model
+func DecryptRepeatingKeyXorWithModel(b []byte, model string) (Plaintext, Key, error) {
+	s, err := ScorerByName(model)
+	if err != nil {
+		return nil, nil, err
+	}
+	return DecryptRepeatingKeyXorWithScorer(b, s)
+}
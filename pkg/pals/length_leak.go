@@ -0,0 +1,199 @@
+package pals
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"math"
+)
+
+// LengthDist is the probability of each Ciphertext length
+type LengthDist map[int]float64
+
+// LengthModel gives the Ciphertext lengths a mode can produce for a Plaintext
+type LengthModel func(plain []byte) LengthDist
+
+// CBCLength is the length of a PKCS padded AES_CBC (or any CBC) Ciphertext with the given block size
+func CBCLength(blockSize int) LengthModel {
+	return func(plain []byte) LengthDist {
+		return LengthDist{(len(plain)/blockSize + 1) * blockSize: 1}
+	}
+}
+
+// StreamLength is the length of a CTR or other stream cipher Ciphertext
+func StreamLength() LengthModel {
+	return func(plain []byte) LengthDist {
+		return LengthDist{len(plain): 1}
+	}
+}
+
+// Compressed compresses the Plaintext with flate before it is encrypted under m. Like MeasuredLength, it
+// gives no lengths at all if compression fails, rather than the length of a truncated stream.
+func Compressed(m LengthModel) LengthModel {
+	return func(plain []byte) LengthDist {
+		var buf bytes.Buffer
+		w, err := flate.NewWriter(&buf, flate.BestCompression)
+		if err != nil {
+			return LengthDist{}
+		}
+		if _, err := w.Write(plain); err != nil {
+			return LengthDist{}
+		}
+		if err := w.Close(); err != nil {
+			return LengthDist{}
+		}
+		return m(buf.Bytes())
+	}
+}
+
+// MeasuredLength encrypts the Plaintext and measures the result, for modes that have no simpler model
+func MeasuredLength(encrypt EncryptionFn) LengthModel {
+	return func(plain []byte) LengthDist {
+		c, err := encrypt(append([]byte{}, plain...))
+		if err != nil {
+			return LengthDist{}
+		}
+		return LengthDist{len(c): 1}
+	}
+}
+
+// Bucketed pads the Plaintext up to a multiple of bucket bytes before it is encrypted under m. Like
+// MeasuredLength, it gives no lengths at all for a bucket size PadToBucket refuses.
+func Bucketed(m LengthModel, bucket int) LengthModel {
+	return func(plain []byte) LengthDist {
+		padded, err := PadToBucket(plain, bucket)
+		if err != nil {
+			return LengthDist{}
+		}
+		return m(padded)
+	}
+}
+
+// RandomlyPadded appends between 0 and maxPad bytes, chosen uniformly, before the Plaintext is encrypted under m
+func RandomlyPadded(m LengthModel, maxPad int) LengthModel {
+	return func(plain []byte) LengthDist {
+		dist := LengthDist{}
+		for pad := 0; pad <= maxPad; pad++ {
+			for l, p := range m(append(append([]byte{}, plain...), make([]byte, pad)...)) {
+				dist[l] += p / float64(maxPad+1)
+			}
+		}
+		return dist
+	}
+}
+
+// PadToBucket appends 0x80 and then zeroes up to a multiple of bucket bytes, so the receiver can strip
+// the padding by removing the zeroes and the 0x80 before them. bucket must be at least 1.
+func PadToBucket(plain []byte, bucket int) ([]byte, error) {
+	if bucket <= 0 {
+		return nil, fmt.Errorf("bucket size %d must be at least 1", bucket)
+	}
+	padded := append(append([]byte{}, plain...), 0x80)
+	if r := len(padded) % bucket; r != 0 {
+		padded = append(padded, make([]byte, bucket-r)...)
+	}
+	return padded, nil
+}
+
+// LengthPosterior returns the probability of each candidate Plaintext given the Ciphertext lengths observed for it.
+// A nil prior is uniform.
+func LengthPosterior(candidates [][]byte, prior []float64, model LengthModel, observed ...int) ([]float64, error) {
+	prior, err := normalizedPrior(candidates, prior)
+	if err != nil {
+		return nil, err
+	}
+	posterior := make([]float64, len(candidates))
+	var total float64
+	for i, c := range candidates {
+		dist := model(c)
+		p := prior[i]
+		for _, l := range observed {
+			p *= dist[l]
+		}
+		posterior[i] = p
+		total += p
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("no candidate can produce the observed lengths %v", observed)
+	}
+	for i := range posterior {
+		posterior[i] /= total
+	}
+	return posterior, nil
+}
+
+// LengthLeakReport measures how much a single Ciphertext length gives away about which candidate was sent
+type LengthLeakReport struct {
+	// PriorBits is the entropy of the candidates before the length is seen
+	PriorBits float64
+	// LeakedBits is the mutual information between the candidate and the length
+	LeakedBits float64
+	// Distinct is the number of different lengths the candidates produce
+	Distinct int
+	// MeanLength is the expected Ciphertext length, the cost of a countermeasure
+	MeanLength float64
+}
+
+func (r LengthLeakReport) String() string {
+	return fmt.Sprintf("%.2f of %.2f bits leaked, %d distinct lengths, mean length %.1f", r.LeakedBits, r.PriorBits, r.Distinct, r.MeanLength)
+}
+
+// MeasureLengthLeak reports how much model leaks about candidates, drawn according to prior (uniform if nil)
+func MeasureLengthLeak(candidates [][]byte, prior []float64, model LengthModel) (LengthLeakReport, error) {
+	prior, err := normalizedPrior(candidates, prior)
+	if err != nil {
+		return LengthLeakReport{}, err
+	}
+	var r LengthLeakReport
+	// joint probability of each candidate and length
+	joint := make([]LengthDist, len(candidates))
+	lengths := LengthDist{}
+	for i, c := range candidates {
+		joint[i] = LengthDist{}
+		for l, p := range model(c) {
+			joint[i][l] = prior[i] * p
+			lengths[l] += prior[i] * p
+			r.MeanLength += prior[i] * p * float64(l)
+		}
+		if prior[i] > 0 {
+			r.PriorBits -= prior[i] * math.Log2(prior[i])
+		}
+	}
+	r.Distinct = len(lengths)
+	for i := range candidates {
+		for l, p := range joint[i] {
+			if p > 0 {
+				r.LeakedBits += p * math.Log2(p/(prior[i]*lengths[l]))
+			}
+		}
+	}
+	return r, nil
+}
+
+func normalizedPrior(candidates [][]byte, prior []float64) ([]float64, error) {
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no candidates")
+	}
+	if prior == nil {
+		prior = make([]float64, len(candidates))
+		for i := range prior {
+			prior[i] = 1 / float64(len(candidates))
+		}
+		return prior, nil
+	}
+	if len(prior) != len(candidates) {
+		return nil, fmt.Errorf("%d priors for %d candidates", len(prior), len(candidates))
+	}
+	var total float64
+	for _, p := range prior {
+		total += p
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("priors sum to %f", total)
+	}
+	normalized := make([]float64, len(prior))
+	for i, p := range prior {
+		normalized[i] = p / total
+	}
+	return normalized, nil
+}
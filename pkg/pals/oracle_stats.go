@@ -0,0 +1,185 @@
+package pals
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrQueryBudgetExceeded is returned by an instrumented oracle once its query budget is spent
+var ErrQueryBudgetExceeded = errors.New("oracle query budget exceeded")
+
+// LatencyBuckets are the upper bounds of the OracleStats latency histogram; slower queries land in a final overflow bucket
+var LatencyBuckets = []time.Duration{
+	time.Microsecond,
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+}
+
+// OracleStats counts and times the queries made through the oracle functions it wraps.
+// A zero OracleStats is ready to use, with no budget and no tracing.
+//
+// Attacks built around an oracle struct take it as that struct's Stats field; those that take the oracle as a
+// function, like BreakRandomAccessCTR, take it as AttackOptions.Stats. The MT19937 seed searches query
+// nothing, they try seeds offline and count them in Progress.CandidatesTried instead.
+type OracleStats struct {
+	// Budget is the maximum number of queries allowed, or 0 for no limit
+	Budget int
+	// Trace, if set, receives one line per query and response
+	Trace io.Writer
+
+	Queries      int
+	Errors       int
+	TotalLatency time.Duration
+	Histogram    []int
+
+	mu sync.Mutex
+}
+
+// WrapEncryption returns an EncryptionFn that records every call to f
+func (s *OracleStats) WrapEncryption(f EncryptionFn) EncryptionFn {
+	return func(plain []byte) (Ciphertext, error) {
+		if err := s.spend(); err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		c, err := f(plain)
+		s.record(time.Since(start), err)
+		s.trace("encrypt %x -> %x", plain, c)
+		return c, err
+	}
+}
+
+// WrapValidation returns a ValidationFn that records every call to f
+func (s *OracleStats) WrapValidation(f ValidationFn) ValidationFn {
+	return func(cipher, IV []byte) (bool, error) {
+		if err := s.spend(); err != nil {
+			return false, err
+		}
+		start := time.Now()
+		valid, err := f(cipher, IV)
+		s.record(time.Since(start), err)
+		s.trace("validate %x iv %x -> %v", cipher, IV, valid)
+		return valid, err
+	}
+}
+
+// WrapLength returns a LengthFn that records every call to f
+func (s *OracleStats) WrapLength(f LengthFn) LengthFn {
+	return func(payload []byte) (int, error) {
+		if err := s.spend(); err != nil {
+			return 0, err
+		}
+		start := time.Now()
+		n, err := f(payload)
+		s.record(time.Since(start), err)
+		s.trace("length %x -> %d", payload, n)
+		return n, err
+	}
+}
+
+// WrapEdit returns an EditFn that records every call to f
+func (s *OracleStats) WrapEdit(f EditFn) EditFn {
+	return func(ciphertext Ciphertext, newtext Plaintext, offset int) (Ciphertext, error) {
+		if err := s.spend(); err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		c, err := f(ciphertext, newtext, offset)
+		s.record(time.Since(start), err)
+		s.trace("edit %x at %d -> %x", newtext, offset, c)
+		return c, err
+	}
+}
+
+// WrapLeaker returns a PlaintextLeaker that records every call to l
+func (s *OracleStats) WrapLeaker(l PlaintextLeaker) PlaintextLeaker {
+	return LeakFn(func(c Ciphertext) (Plaintext, error) {
+		if err := s.spend(); err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		p, err := l.LeakPlaintext(c)
+		s.record(time.Since(start), err)
+		s.trace("leak %x -> %x", c, p)
+		return p, err
+	})
+}
+
+// MeanLatency returns the average time spent per query
+func (s *OracleStats) MeanLatency() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Queries == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Queries)
+}
+
+func (s *OracleStats) String() string {
+	// snapshot under the lock, since the counters may still be written by a running attack
+	s.mu.Lock()
+	queries, errs, total := s.Queries, s.Errors, s.TotalLatency
+	histogram := append([]int(nil), s.Histogram...)
+	s.mu.Unlock()
+	var mean time.Duration
+	if queries > 0 {
+		mean = total / time.Duration(queries)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d queries, %d errors, mean latency %s\n", queries, errs, mean)
+	for i, n := range histogram {
+		if i < len(LatencyBuckets) {
+			fmt.Fprintf(&sb, "  <= %-8s %d\n", LatencyBuckets[i], n)
+		} else {
+			fmt.Fprintf(&sb, "   > %-8s %d\n", LatencyBuckets[len(LatencyBuckets)-1], n)
+		}
+	}
+	return sb.String()
+}
+
+func (s *OracleStats) spend() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Budget > 0 && s.Queries >= s.Budget {
+		return ErrQueryBudgetExceeded
+	}
+	s.Queries++
+	return nil
+}
+
+func (s *OracleStats) record(latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Histogram == nil {
+		s.Histogram = make([]int, len(LatencyBuckets)+1)
+	}
+	if err != nil {
+		s.Errors++
+	}
+	s.TotalLatency += latency
+	bucket := len(LatencyBuckets)
+	for i, upper := range LatencyBuckets {
+		if latency <= upper {
+			bucket = i
+			break
+		}
+	}
+	s.Histogram[bucket]++
+}
+
+func (s *OracleStats) trace(format string, a ...interface{}) {
+	if s.Trace == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.Trace, format+"\n", a...)
+}
@@ -0,0 +1,197 @@
+package pals
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// TranscriptVersion is the transcript file format written by OracleRecorder
+const TranscriptVersion = 1
+
+// ErrUnseenQuery is returned by an OracleReplayer asked a query that is not in its transcript
+var ErrUnseenQuery = errors.New("query not found in oracle transcript")
+
+// oracles a transcript entry can come from
+const (
+	encryptOracle  = "encrypt"
+	validateOracle = "validate"
+)
+
+// TranscriptEntry is a single oracle query and its response
+type TranscriptEntry struct {
+	Oracle     string `json:"oracle"`
+	Query      []byte `json:"query"`
+	IV         []byte `json:"iv,omitempty"`
+	Ciphertext []byte `json:"ciphertext,omitempty"`
+	Valid      bool   `json:"valid,omitempty"`
+	Err        string `json:"err,omitempty"`
+}
+
+func (e TranscriptEntry) key() string {
+	return transcriptKey(e.Oracle, e.Query, e.IV)
+}
+
+func transcriptKey(oracle string, query, IV []byte) string {
+	return fmt.Sprintf("%s:%x:%x", oracle, query, IV)
+}
+
+func (e TranscriptEntry) err() error {
+	if e.Err == "" {
+		return nil
+	}
+	return errors.New(e.Err)
+}
+
+// Transcript is the versioned, on-disk record of an attack's oracle queries
+type Transcript struct {
+	Version int               `json:"version"`
+	Entries []TranscriptEntry `json:"entries"`
+}
+
+// Save writes the transcript as JSON, gzipped if the filename ends in .gz
+func (t *Transcript) Save(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if strings.HasSuffix(filename, ".gz") {
+		gz := gzip.NewWriter(f)
+		if err := json.NewEncoder(gz).Encode(t); err != nil {
+			return err
+		}
+		return gz.Close()
+	}
+	return json.NewEncoder(f).Encode(t)
+}
+
+// LoadTranscript reads a transcript written by Save
+func LoadTranscript(filename string) (*Transcript, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(filename, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	var t Transcript
+	if err := json.NewDecoder(r).Decode(&t); err != nil {
+		return nil, err
+	}
+	if t.Version != TranscriptVersion {
+		return nil, fmt.Errorf("transcript %s has version %d, want %d", filename, t.Version, TranscriptVersion)
+	}
+	return &t, nil
+}
+
+// OracleRecorder captures the queries and responses of the oracle functions it wraps.
+// Repeated queries are only recorded once, since the oracles are deterministic.
+type OracleRecorder struct {
+	Transcript Transcript
+
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func NewOracleRecorder() *OracleRecorder {
+	return &OracleRecorder{Transcript: Transcript{Version: TranscriptVersion}, seen: make(map[string]bool)}
+}
+
+// WrapEncryption returns an EncryptionFn that records every call to f
+func (r *OracleRecorder) WrapEncryption(f EncryptionFn) EncryptionFn {
+	return func(plain []byte) (Ciphertext, error) {
+		c, err := f(plain)
+		e := TranscriptEntry{Oracle: encryptOracle, Query: append([]byte{}, plain...), Ciphertext: append([]byte{}, c...)}
+		if err != nil {
+			e.Err = err.Error()
+		}
+		r.add(e)
+		return c, err
+	}
+}
+
+// WrapValidation returns a ValidationFn that records every call to f
+func (r *OracleRecorder) WrapValidation(f ValidationFn) ValidationFn {
+	return func(cipher, IV []byte) (bool, error) {
+		valid, err := f(cipher, IV)
+		e := TranscriptEntry{Oracle: validateOracle, Query: append([]byte{}, cipher...), IV: append([]byte{}, IV...), Valid: valid}
+		if err != nil {
+			e.Err = err.Error()
+		}
+		r.add(e)
+		return valid, err
+	}
+}
+
+// Save writes the recorded transcript to filename
+func (r *OracleRecorder) Save(filename string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Transcript.Save(filename)
+}
+
+func (r *OracleRecorder) add(e TranscriptEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.seen[e.key()] {
+		return
+	}
+	r.seen[e.key()] = true
+	r.Transcript.Entries = append(r.Transcript.Entries, e)
+}
+
+// OracleReplayer answers oracle queries from a transcript, without access to the Key.
+// Any query missing from the transcript fails with ErrUnseenQuery.
+type OracleReplayer struct {
+	entries map[string]TranscriptEntry
+}
+
+func NewOracleReplayer(t *Transcript) *OracleReplayer {
+	r := &OracleReplayer{entries: make(map[string]TranscriptEntry)}
+	for _, e := range t.Entries {
+		r.entries[e.key()] = e
+	}
+	return r
+}
+
+// LoadOracleReplayer reads a transcript from filename and replays it
+func LoadOracleReplayer(filename string) (*OracleReplayer, error) {
+	t, err := LoadTranscript(filename)
+	if err != nil {
+		return nil, err
+	}
+	return NewOracleReplayer(t), nil
+}
+
+func (r *OracleReplayer) EncryptionFn() EncryptionFn {
+	return func(plain []byte) (Ciphertext, error) {
+		e, ok := r.entries[transcriptKey(encryptOracle, plain, nil)]
+		if !ok {
+			return nil, fmt.Errorf("%w: encrypt %x", ErrUnseenQuery, plain)
+		}
+		return append(Ciphertext{}, e.Ciphertext...), e.err()
+	}
+}
+
+func (r *OracleReplayer) ValidationFn() ValidationFn {
+	return func(cipher, IV []byte) (bool, error) {
+		e, ok := r.entries[transcriptKey(validateOracle, cipher, IV)]
+		if !ok {
+			return false, fmt.Errorf("%w: validate %x iv %x", ErrUnseenQuery, cipher, IV)
+		}
+		return e.Valid, e.err()
+	}
+}
@@ -0,0 +1,90 @@
+package pals
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInterrupted matches the error returned by an attack that was cancelled or ran past its deadline
+var ErrInterrupted = errors.New("attack interrupted")
+
+// InterruptedError is returned alongside the partial result of an attack that stopped early.
+// It matches ErrInterrupted as well as the context error that stopped it.
+type InterruptedError struct {
+	Cause    error
+	Progress Progress
+}
+
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("%s interrupted after %d bytes and %d candidates: %s", e.Progress.Attack, e.Progress.BytesRecovered, e.Progress.CandidatesTried, e.Cause)
+}
+
+func (e *InterruptedError) Unwrap() error {
+	return e.Cause
+}
+
+func (e *InterruptedError) Is(target error) bool {
+	return target == ErrInterrupted
+}
+
+// Progress is a snapshot of how far a long-running attack has got
+type Progress struct {
+	Attack          string
+	BytesRecovered  int
+	BlocksDone      int
+	BlocksTotal     int
+	CandidatesTried int
+	Elapsed         time.Duration
+	ETA             time.Duration
+}
+
+type ProgressFn func(Progress)
+
+// AttackOptions configure the Context variants of the attacks
+type AttackOptions struct {
+	// Progress, if set, is called as the attack makes progress
+	Progress ProgressFn
+	// Checkpoint, if set, saves the attack's state as it goes and resumes from a previous run's state
+	Checkpoint *Checkpointer
+	// Scorer, if set, judges candidate Plaintexts in place of DefaultScorer
+	Scorer Scorer
+	// Stats, if set, counts the queries of attacks that take their oracle as a function, such as an EditFn
+	Stats *OracleStats
+}
+
+// progressTracker fills in timing for an attack's Progress events and turns context errors into InterruptedErrors
+type progressTracker struct {
+	ctx   context.Context
+	fn    ProgressFn
+	start time.Time
+	last  Progress
+}
+
+func newProgressTracker(ctx context.Context, attack string, opts AttackOptions) *progressTracker {
+	return &progressTracker{ctx: ctx, fn: opts.Progress, start: time.Now(), last: Progress{Attack: attack}}
+}
+
+// report records p, estimating the time remaining from the fraction of work done out of total
+func (t *progressTracker) report(p Progress, done, total int) {
+	p.Attack = t.last.Attack
+	p.Elapsed = time.Since(t.start)
+	if done > 0 && total > done {
+		p.ETA = time.Duration(float64(p.Elapsed) / float64(done) * float64(total-done))
+	}
+	t.last = p
+	if t.fn != nil {
+		t.fn(p)
+	}
+}
+
+// interrupted returns an InterruptedError if the attack's context is done
+func (t *progressTracker) interrupted() error {
+	select {
+	case <-t.ctx.Done():
+		return &InterruptedError{Cause: t.ctx.Err(), Progress: t.last}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,380 @@
+package pals
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Scorer rates how much a Plaintext looks like what the solvers expect to find. Lower is better.
+type Scorer interface {
+	Score(text []byte) float64
+}
+
+// ScorerFunc adapts a plain function to a Scorer
+type ScorerFunc func(text []byte) float64
+
+func (f ScorerFunc) Score(text []byte) float64 {
+	return f(text)
+}
+
+// LetterFrequencyScorer is the original score: a 1000 point penalty for every byte that is not a letter
+// or a space, plus the squared distance of the letter frequencies from english
+var LetterFrequencyScorer Scorer = ScorerFunc(getScore)
+
+// DefaultScorer is used by the solvers when no Scorer is given
+var DefaultScorer = LetterFrequencyScorer
+
+func scorerOrDefault(s Scorer) Scorer {
+	if s == nil {
+		return DefaultScorer
+	}
+	return s
+}
+
+// chi-squared categories beyond the 26 letters
+const (
+	chiSpace = 26 + iota
+	chiPunctuation
+	chiOther
+	chiCategories
+)
+
+// share of english text taken by spaces and by other printable characters
+const (
+	englishSpaceFreq       = 0.17
+	englishPunctuationFreq = 0.03
+	englishOtherFreq       = 0.0001
+)
+
+// ChiSquaredScorer is Pearson's chi-squared statistic of the text against english, counting letters
+// case-insensitively along with spaces, other printable characters and everything else
+type ChiSquaredScorer struct{}
+
+func (ChiSquaredScorer) Score(text []byte) float64 {
+	if len(text) == 0 {
+		return math.Inf(1)
+	}
+	var observed [chiCategories]float64
+	for _, c := range text {
+		switch {
+		case c >= 'a' && c <= 'z':
+			observed[c-'a']++
+		case c >= 'A' && c <= 'Z':
+			observed[c-'A']++
+		case c == ' ':
+			observed[chiSpace]++
+		case IsPrintable(c):
+			observed[chiPunctuation]++
+		default:
+			observed[chiOther]++
+		}
+	}
+	expected := englishCategoryFreqs()
+	var chi float64
+	for i, o := range observed {
+		e := expected[i] * float64(len(text))
+		chi += (o - e) * (o - e) / e
+	}
+	return chi
+}
+
+var (
+	categoryFreqsOnce sync.Once
+	categoryFreqs     [chiCategories]float64
+)
+
+func englishCategoryFreqs() [chiCategories]float64 {
+	categoryFreqsOnce.Do(func() {
+		letters := 1 - englishSpaceFreq - englishPunctuationFreq - englishOtherFreq
+		for l, f := range getLetterFreqMapForEnglish() {
+			categoryFreqs[l[0]-'a'] = f / 100 * letters
+		}
+		categoryFreqs[chiSpace] = englishSpaceFreq
+		categoryFreqs[chiPunctuation] = englishPunctuationFreq
+		categoryFreqs[chiOther] = englishOtherFreq
+	})
+	return categoryFreqs
+}
+
+// PrintableScorer is the fraction of bytes that are not printable ASCII. It tells text from noise,
+// but not one text from another.
+type PrintableScorer struct{}
+
+func (PrintableScorer) Score(text []byte) float64 {
+	return 1 - printableRatio(text)
+}
+
+// DictionaryScorer is the fraction of the text not covered by dictionary words or the spacing and
+// punctuation between them. Words are matched case-insensitively.
+type DictionaryScorer struct {
+	Words map[string]bool
+}
+
+// NewDictionaryScorer builds a DictionaryScorer from a list of words
+func NewDictionaryScorer(words []string) DictionaryScorer {
+	d := DictionaryScorer{Words: make(map[string]bool, len(words))}
+	for _, w := range words {
+		d.Words[strings.ToLower(w)] = true
+	}
+	return d
+}
+
+func (d DictionaryScorer) Score(text []byte) float64 {
+	if len(text) == 0 {
+		return 1
+	}
+	var covered, start int
+	for i := 0; i <= len(text); i++ {
+		if i < len(text) && isLetter(text[i]) {
+			continue
+		}
+		if i > start && d.Words[strings.ToLower(string(text[start:i]))] {
+			covered += i - start
+		}
+		if i < len(text) && IsPrintable(text[i]) {
+			covered++
+		}
+		start = i + 1
+	}
+	return 1 - float64(covered)/float64(len(text))
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// NGramModel is a byte n-gram language model. It scores text by the mean negative log10 probability of
+// each byte given the n-1 bytes before it, so it is comparable across texts of different lengths. Contexts
+// never seen in training back off to shorter ones, at a penalty, down to the frequency of the byte alone.
+type NGramModel struct {
+	N     int
+	Total float64
+	// Counts is the number of times each n-gram was seen in training
+	Counts map[string]float64
+	// UTF8 models expect valid UTF-8, and charge every byte of an invalid sequence as an unseen byte
+	UTF8 bool
+
+	once sync.Once
+	// orders[k] counts the k-grams, taken from the ends of the n-grams; orders[0] holds the total
+	orders []map[string]float64
+	floor  float64
+
+	unigramsOnce sync.Once
+	// unigrams is the model columnScorer scores with, built the first time it is needed
+	unigrams *NGramModel
+}
+
+// ngramBackoff is the log10 penalty for each step back to a shorter context
+const ngramBackoff = 0.4
+
+// TrainNGramModel counts every n-gram of the corpus
+func TrainNGramModel(corpus []byte, n int) (*NGramModel, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("n-gram length must be at least 1, got %d", n)
+	}
+	m := &NGramModel{N: n, Counts: make(map[string]float64)}
+	for i := 0; i+n <= len(corpus); i++ {
+		m.Counts[string(corpus[i:i+n])]++
+		m.Total++
+	}
+	if m.Total == 0 {
+		return nil, fmt.Errorf("corpus of %d bytes has no %d-grams", len(corpus), n)
+	}
+	return m, nil
+}
+
+// Prune drops the n-grams seen fewer than min times, to keep a model small enough to embed.
+// Total is unchanged, so the n-grams that are left keep their probabilities. Like any change to Counts,
+// it must not run alongside Score.
+func (m *NGramModel) Prune(min float64) {
+	for g, c := range m.Counts {
+		if c < min {
+			delete(m.Counts, g)
+		}
+	}
+	// the shorter orders are summed from Counts, so work them out again on the next Score
+	m.once, m.orders = sync.Once{}, nil
+	m.unigramsOnce, m.unigrams = sync.Once{}, nil
+}
+
+func (m *NGramModel) init() {
+	m.once.Do(func() {
+		m.orders = make([]map[string]float64, m.N+1)
+		m.orders[0] = map[string]float64{"": m.Total}
+		for k := 1; k <= m.N; k++ {
+			m.orders[k] = make(map[string]float64)
+		}
+		for g, c := range m.Counts {
+			for k := 1; k <= m.N; k++ {
+				m.orders[k][g[m.N-k:]] += c
+			}
+		}
+		m.floor = -math.Log10(0.01 / m.Total)
+	})
+}
+
+// cost is the negative log10 probability of the last byte of text given the bytes before it
+func (m *NGramModel) cost(text []byte) float64 {
+	var penalty float64
+	for k := len(text); k >= 1; k-- {
+		g := text[len(text)-k:]
+		if c := m.orders[k][string(g)]; c > 0 {
+			ctx := m.orders[k-1][string(g[:k-1])]
+			p := c / ctx
+			if ctx < c {
+				p = 1
+			}
+			return penalty - math.Log10(p)
+		}
+		penalty += ngramBackoff
+	}
+	return penalty + m.floor
+}
+
+func (m *NGramModel) Score(text []byte) float64 {
+	m.init()
+	if len(text) == 0 {
+		return m.floor
+	}
+	var s float64
+	for i := range text {
+		start := i + 1 - m.N
+		if start < 0 {
+			start = 0
+		}
+		s += m.cost(text[start : i+1])
+	}
+	if m.UTF8 {
+		s += float64(invalidUTF8(text)) * m.floor
+	}
+	return s / float64(len(text))
+}
+
+// invalidUTF8 counts the bytes of text that are not part of a valid UTF-8 sequence. A sequence cut off
+// at either end of the text, as it is in a column or a window of a longer text, is not counted.
+func invalidUTF8(text []byte) int {
+	start := 0
+	for start < len(text) && start < utf8.UTFMax-1 && !utf8.RuneStart(text[start]) {
+		start++
+	}
+	var invalid int
+	for i := start; i < len(text); {
+		r, size := utf8.DecodeRune(text[i:])
+		if r == utf8.RuneError && size == 1 {
+			if !utf8.FullRune(text[i:]) {
+				break
+			}
+			invalid++
+		}
+		i += size
+	}
+	return invalid
+}
+
+// Unigrams is the byte frequency model implied by the n-gram counts
+func (m *NGramModel) Unigrams() *NGramModel {
+	u := &NGramModel{N: 1, Total: m.Total, Counts: make(map[string]float64), UTF8: m.UTF8}
+	for g, c := range m.Counts {
+		u.Counts[g[:1]] += c
+	}
+	return u
+}
+
+// columnScorer is the Scorer to use on bytes that were not adjacent in the Plaintext, such as a column of
+// repeating-key XOR: n-gram models fall back to their byte frequencies
+func columnScorer(s Scorer) Scorer {
+	if m, ok := s.(*NGramModel); ok && m.N > 1 {
+		m.unigramsOnce.Do(func() { m.unigrams = m.Unigrams() })
+		return m.unigrams
+	}
+	return s
+}
+
+// WriteTo writes the model as a header line, "ngram <n> <total>" and then "utf8" if the model is of
+// UTF-8 text, followed by one line per n-gram
+// holding the hex encoded n-gram and its count, most frequent first
+func (m *NGramModel) WriteTo(w io.Writer) (int64, error) {
+	grams := make([]string, 0, len(m.Counts))
+	for g := range m.Counts {
+		grams = append(grams, g)
+	}
+	sort.Slice(grams, func(i, j int) bool {
+		if m.Counts[grams[i]] != m.Counts[grams[j]] {
+			return m.Counts[grams[i]] > m.Counts[grams[j]]
+		}
+		return grams[i] < grams[j]
+	})
+	bw := bufio.NewWriter(w)
+	var written int64
+	header := fmt.Sprintf("ngram %d %g", m.N, m.Total)
+	if m.UTF8 {
+		header += " utf8"
+	}
+	n, err := fmt.Fprintln(bw, header)
+	written += int64(n)
+	if err != nil {
+		return written, err
+	}
+	for _, g := range grams {
+		n, err := fmt.Fprintf(bw, "%x %g\n", g, m.Counts[g])
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, bw.Flush()
+}
+
+// ReadNGramModel reads a model written by WriteTo
+func ReadNGramModel(r io.Reader) (*NGramModel, error) {
+	s := bufio.NewScanner(r)
+	if !s.Scan() {
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("empty n-gram model")
+	}
+	m := &NGramModel{Counts: make(map[string]float64)}
+	header := strings.Fields(s.Text())
+	if len(header) < 3 || len(header) > 4 || header[0] != "ngram" || (len(header) == 4 && header[3] != "utf8") {
+		return nil, fmt.Errorf("bad n-gram model header %q", s.Text())
+	}
+	var err error
+	if m.N, err = strconv.Atoi(header[1]); err != nil || m.N < 1 {
+		return nil, fmt.Errorf("bad n-gram length in header %q", s.Text())
+	}
+	if m.Total, err = strconv.ParseFloat(header[2], 64); err != nil {
+		return nil, fmt.Errorf("bad total in header %q: %w", s.Text(), err)
+	}
+	m.UTF8 = len(header) == 4
+	for line := 2; s.Scan(); line++ {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: want an n-gram and a count, got %q", line, s.Text())
+		}
+		g, err := hex.DecodeString(fields[0])
+		if err != nil || len(g) != m.N {
+			return nil, fmt.Errorf("line %d: bad %d-gram %q", line, m.N, fields[0])
+		}
+		c, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		m.Counts[string(g)] = c
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if m.Total <= 0 {
+		return nil, fmt.Errorf("n-gram model has a total of %g", m.Total)
+	}
+	return m, nil
+}
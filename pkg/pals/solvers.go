@@ -1,21 +1,13 @@
 package pals
 
 import (
-	"log"
+	"math"
 	"regexp"
 	"strings"
 
 	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
 )
 
-func (d Plaintext) score() float64 {
-	if d == nil {
-		// return a high score for uninitialized Plain
-		return float64(1e10)
-	}
-	return getScore([]byte(d))
-}
-
 // SolveSingleByteXorCipherHex examines the input XORed against a single character, and returns the most likely original text and Key, based on english character frequency
 func SolveSingleByteXorCipherHex(h utils.HexEncoded) (Plaintext, Key, error) {
 	return SolveSingleByteXorCipher(h.GetBytes())
@@ -23,22 +15,31 @@ func SolveSingleByteXorCipherHex(h utils.HexEncoded) (Plaintext, Key, error) {
 
 // SolveSingleByteXorCipher examines the input XORed against a single character, and returns the most likely original text and Key, based on english character frequency
 func SolveSingleByteXorCipher(hBytes []byte) (Plaintext, Key, error) {
+	return SolveSingleByteXorCipherWithScorer(hBytes, nil)
+}
+
+// SolveSingleByteXorCipherWithScorer is SolveSingleByteXorCipher, judging the candidates with s (DefaultScorer if nil)
+func SolveSingleByteXorCipherWithScorer(hBytes []byte, s Scorer) (Plaintext, Key, error) {
+	res, resultKey, _, err := solveSingleByteXor(hBytes, scorerOrDefault(s))
+	return res, resultKey, err
+}
+
+func solveSingleByteXor(hBytes []byte, s Scorer) (Plaintext, Key, float64, error) {
 	var res Plaintext
 	var resultKey Key
-	var newScore float64
+	best := math.Inf(1)
 	for i := 0; i < 256; i++ {
 		t, err := utils.SingleByteXor(hBytes, byte(i))
 		if err != nil {
-			log.Fatal(err)
+			return nil, nil, 0, err
 		}
-		tprime := Plaintext(t)
-		newScore = tprime.score()
-		if newScore < res.score() {
-			res = tprime
+		if newScore := s.Score(t); res == nil || newScore < best {
+			res = Plaintext(t)
 			resultKey = []byte{byte(i)}
+			best = newScore
 		}
 	}
-	return res, resultKey, nil
+	return res, resultKey, best, nil
 }
 
 func getLetterFreqMapForEnglish() map[string]float64 {
@@ -73,14 +74,12 @@ func getLetterFreqMapForEnglish() map[string]float64 {
 	return m
 }
 
+var nonAlphabetical = regexp.MustCompile("[^a-zA-Z ]")
+
 func getScore(text []byte) float64 {
 	// lower score is more likely to be english
 	var s float64
-	a, err := regexp.Compile("[^a-zA-Z ]")
-	if err != nil {
-		log.Fatal(err)
-	}
-	alphabetical := a.ReplaceAllString(string(text), "")
+	alphabetical := nonAlphabetical.ReplaceAllString(string(text), "")
 	// 1000 point penalty for every non alphabetical character other than space
 	score := float64(len(string(text))-len(alphabetical)) * 1000
 	lowerText := strings.ToLower(string(alphabetical))
@@ -97,14 +96,22 @@ func getScore(text []byte) float64 {
 }
 
 func DetectSingleByteXorCipher(lines []string) (Plaintext, error) {
+	return DetectSingleByteXorCipherWithScorer(lines, nil)
+}
+
+// DetectSingleByteXorCipherWithScorer is DetectSingleByteXorCipher, judging the candidates with s (DefaultScorer if nil)
+func DetectSingleByteXorCipherWithScorer(lines []string, s Scorer) (Plaintext, error) {
+	s = scorerOrDefault(s)
 	var res Plaintext
+	best := math.Inf(1)
 	for _, h := range lines {
-		s, _, err := SolveSingleByteXorCipherHex(utils.HexEncoded{HexString: h})
+		p, _, score, err := solveSingleByteXor(utils.HexEncoded{HexString: h}.GetBytes(), s)
 		if err != nil {
-			return s, err
+			return p, err
 		}
-		if s.score() < res.score() {
-			res = s
+		if res == nil || score < best {
+			res = p
+			best = score
 		}
 	}
 	return res, nil
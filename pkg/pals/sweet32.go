@@ -0,0 +1,260 @@
+package pals
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/padding"
+	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
+)
+
+const feistelRounds = 8
+
+// Feistel is a toy block cipher with a block size of 2 to 8 bytes, standing in for 3DES and Blowfish.
+// Narrower blocks collide sooner, which makes birthday attacks on it fast enough to run in tests.
+type Feistel struct {
+	blockSize int
+	keys      [feistelRounds]uint32
+}
+
+// NewFeistel derives the round keys from k
+func NewFeistel(k Key, blockSize int) (*Feistel, error) {
+	if blockSize < 2 || blockSize > 8 || blockSize%2 != 0 {
+		return nil, fmt.Errorf("Feistel block size must be 2, 4, 6 or 8 bytes, got %d", blockSize)
+	}
+	f := &Feistel{blockSize: blockSize}
+	h := sha256.Sum256(k)
+	for i := range f.keys {
+		f.keys[i] = binary.BigEndian.Uint32(h[4*(i%8):])
+	}
+	return f, nil
+}
+
+func (f *Feistel) BlockSize() int {
+	return f.blockSize
+}
+
+func (f *Feistel) Encrypt(dst, src []byte) {
+	l, r := f.split(src)
+	for _, k := range f.keys {
+		l, r = r, l^f.round(r, k)
+	}
+	f.join(dst, l, r)
+}
+
+func (f *Feistel) Decrypt(dst, src []byte) {
+	l, r := f.split(src)
+	for i := len(f.keys) - 1; i >= 0; i-- {
+		l, r = r^f.round(l, f.keys[i]), l
+	}
+	f.join(dst, l, r)
+}
+
+func (f *Feistel) halfMask() uint32 {
+	return uint32(uint64(1)<<(4*f.blockSize) - 1)
+}
+
+func (f *Feistel) round(x, k uint32) uint32 {
+	x = (x ^ k) * 0x9e3779b1
+	x ^= x >> 15
+	x *= 0x85ebca77
+	x ^= x >> 13
+	return x & f.halfMask()
+}
+
+func (f *Feistel) split(b []byte) (uint32, uint32) {
+	half := f.blockSize / 2
+	var l, r uint32
+	for i := 0; i < half; i++ {
+		l = l<<8 | uint32(b[i])
+		r = r<<8 | uint32(b[half+i])
+	}
+	return l, r
+}
+
+func (f *Feistel) join(dst []byte, l, r uint32) {
+	half := f.blockSize / 2
+	for i := half - 1; i >= 0; i-- {
+		dst[i], dst[half+i] = byte(l), byte(r)
+		l, r = l>>8, r>>8
+	}
+}
+
+// CBCEncryptBlock pads and encrypts plain with any block cipher, chaining blocks like AES_CBC
+func CBCEncryptBlock(b cipher.Block, iv IV, plain Plaintext) (Ciphertext, error) {
+	bs := b.BlockSize()
+	if len(iv) != bs {
+		return nil, fmt.Errorf("IV of %d bytes does not match block size %d", len(iv), bs)
+	}
+	padded := padding.PKCSPadding(append([]byte{}, plain...), bs)
+	e := make(Ciphertext, len(padded))
+	prev := []byte(iv)
+	for i := 0; i < len(padded); i += bs {
+		x, err := utils.FixedXor(padded[i:i+bs], prev)
+		if err != nil {
+			return nil, err
+		}
+		b.Encrypt(e[i:i+bs], x)
+		prev = e[i : i+bs]
+	}
+	return e, nil
+}
+
+// CollisionFinder remembers CBC Ciphertext blocks of up to 8 bytes and reports when a block repeats. A collision
+// only needs the block before each copy, and which block of its record each copy was, so that is all that is
+// kept: blocks are stored as integers rather than slices, and tracking millions of them costs a few dozen
+// bytes each.
+type CollisionFinder struct {
+	seen map[uint64]blockRef
+}
+
+// blockRef is where a block was seen: the block before it (or the IV) and its index within its record
+type blockRef struct {
+	previous uint64
+	index    uint32
+}
+
+func NewCollisionFinder(sizeHint int) *CollisionFinder {
+	return &CollisionFinder{seen: make(map[uint64]blockRef, sizeHint)}
+}
+
+// Add records block, the index-th block of its record, preceded by previous. If an equal block was seen
+// before it returns that block's predecessor and index. The earlier block is kept, so every later copy
+// of a block is matched against the first.
+func (f *CollisionFinder) Add(block, previous []byte, index int) (uint64, int, bool) {
+	key := blockKey(block)
+	if earlier, ok := f.seen[key]; ok {
+		return earlier.previous, int(earlier.index), true
+	}
+	f.seen[key] = blockRef{previous: blockKey(previous), index: uint32(index)}
+	return 0, 0, false
+}
+
+// Len is the number of distinct blocks seen
+func (f *CollisionFinder) Len() int {
+	return len(f.seen)
+}
+
+func blockKey(block []byte) uint64 {
+	var k uint64
+	for _, b := range block {
+		k = k<<8 | uint64(b)
+	}
+	return k
+}
+
+// keyBlock is the inverse of blockKey
+func keyBlock(k uint64, size int) []byte {
+	block := make([]byte, size)
+	for i := size - 1; i >= 0; i-- {
+		block[i] = byte(k)
+		k >>= 8
+	}
+	return block
+}
+
+// Sweet32 recovers a secret that is encrypted over and over in a long-lived CBC session with a small block
+// size. When two Ciphertext blocks collide, the Plaintexts behind them differ by the XOR of the blocks that
+// precede them; if one Plaintext is known, the other falls out. Records are not kept, only their blocks.
+type Sweet32 struct {
+	Blocksize int
+	// Known is the Plaintext of every record, with anything in the secret's place
+	Known Plaintext
+	// SecretOffset and SecretLen locate the secret in every record
+	SecretOffset int
+	SecretLen    int
+	// Blocks is the number of Ciphertext blocks observed
+	Blocks int
+
+	finder    *CollisionFinder
+	padded    Plaintext
+	recovered map[int][]byte
+}
+
+// Observe adds a record to the attack, returning whether it completed the secret
+func (a *Sweet32) Observe(rec CBCRecord) (bool, error) {
+	bs := a.Blocksize
+	if bs <= 0 {
+		return false, fmt.Errorf("block size %d must be positive", bs)
+	}
+	if len(rec.IV) != bs || len(rec.Ciphertext)%bs != 0 {
+		return false, fmt.Errorf("record does not match block size %d", bs)
+	}
+	if a.finder == nil {
+		a.finder = NewCollisionFinder(0)
+		a.recovered = map[int][]byte{}
+		a.padded = padding.PKCSPadding(append([]byte{}, a.Known...), bs)
+	}
+	previous := []byte(rec.IV)
+	for i := 0; i*bs < len(rec.Ciphertext); i++ {
+		if i*bs >= len(a.padded) {
+			break
+		}
+		a.Blocks++
+		block := rec.Ciphertext[i*bs : (i+1)*bs]
+		if earlierPrevious, j, ok := a.finder.Add(block, previous, i); ok {
+			a.collide(i, blockKey(previous), j, earlierPrevious)
+		}
+		previous = block
+	}
+	return a.Done(), nil
+}
+
+// collide uses equal blocks i and j, preceded by the blocks prevI and prevJ, if exactly one of them is secret
+func (a *Sweet32) collide(i int, prevI uint64, j int, prevJ uint64) {
+	if a.isSecret(i) == a.isSecret(j) {
+		return
+	}
+	if a.isSecret(j) {
+		i, prevI, j, prevJ = j, prevJ, i, prevI
+	}
+	if _, ok := a.recovered[i]; ok {
+		return
+	}
+	// P_i XOR C_{i-1} == P_j XOR C_{j-1}
+	bs := a.Blocksize
+	x := keyBlock(prevI^prevJ, bs)
+	a.recovered[i] = utils.FlexibleXor(x, a.padded[j*bs:(j+1)*bs])
+}
+
+// isSecret reports whether block i holds any of the secret
+func (a *Sweet32) isSecret(i int) bool {
+	start, end := i*a.Blocksize, (i+1)*a.Blocksize
+	return start < a.SecretOffset+a.SecretLen && end > a.SecretOffset
+}
+
+// Done reports whether every block of the secret has been recovered
+func (a *Sweet32) Done() bool {
+	if a.Blocksize <= 0 {
+		return false
+	}
+	for i := a.SecretOffset / a.Blocksize; i*a.Blocksize < a.SecretOffset+a.SecretLen; i++ {
+		if _, ok := a.recovered[i]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Secret returns the secret, with zeroes in the blocks not yet recovered
+func (a *Sweet32) Secret() Plaintext {
+	bs := a.Blocksize
+	if bs <= 0 {
+		// Observe refuses every record, so nothing was recovered
+		return make(Plaintext, a.SecretLen)
+	}
+	var b bytes.Buffer
+	first := a.SecretOffset / bs
+	for i := first; i*bs < a.SecretOffset+a.SecretLen; i++ {
+		block, ok := a.recovered[i]
+		if !ok {
+			block = make([]byte, bs)
+		}
+		b.Write(block)
+	}
+	start := a.SecretOffset - first*bs
+	return b.Bytes()[start : start+a.SecretLen]
+}
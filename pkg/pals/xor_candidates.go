@@ -0,0 +1,167 @@
+package pals
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
+)
+
+// XorCandidate is one guess at the Key of an XOR cipher, with the Plaintext it gives and that Plaintext's score
+type XorCandidate struct {
+	Plaintext Plaintext
+	Key       Key
+	Score     float64
+}
+
+// SolveSingleByteXorCipherTopN is SolveSingleByteXorCipher, returning the best n Keys rather than only
+// the best one, judged by s (DefaultScorer if nil), best first. n <= 0 returns all 256.
+func SolveSingleByteXorCipherTopN(hBytes []byte, n int, s Scorer) ([]XorCandidate, error) {
+	s = scorerOrDefault(s)
+	candidates := make([]XorCandidate, 0, 256)
+	for i := 0; i < 256; i++ {
+		t, err := utils.SingleByteXor(hBytes, byte(i))
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, XorCandidate{Plaintext: t, Key: Key{byte(i)}, Score: s.Score(t)})
+	}
+	sortCandidates(candidates)
+	if n > 0 && n < len(candidates) {
+		candidates = candidates[:n]
+	}
+	return candidates, nil
+}
+
+// BeamOptions configure DecryptRepeatingKeyXorTopN
+type BeamOptions struct {
+	// Scorer judges the Plaintexts, DefaultScorer if nil
+	Scorer Scorer
+	// PerColumn is the number of candidates kept for each byte of the Key, defaultPerColumn if 0 or less
+	PerColumn int
+	// Width is the number of partial Keys kept after each byte, defaultBeamWidth if 0 or less
+	Width int
+	// Keysizes, if set, are tried in place of the guessed Keysizes. Each must be positive.
+	Keysizes []int
+}
+
+const (
+	defaultPerColumn = 4
+	defaultBeamWidth = 32
+)
+
+// DecryptRepeatingKeyXorTopN is DecryptRepeatingKeyXor, returning the best n (Plaintext, Key) pairs.
+// For each likely Keysize, the best few bytes for every column are combined a byte at a time in a beam
+// search, where each partial Key is judged by the runs of Plaintext it decrypts, and the finished Keys are
+// ranked by the score of the whole Plaintext. Keys that give the same Plaintext, as a Key and its
+// repetition do, are only returned once. n <= 0 returns every Key found.
+func DecryptRepeatingKeyXorTopN(b []byte, n int, opts BeamOptions) ([]XorCandidate, error) {
+	s := scorerOrDefault(opts.Scorer)
+	perColumn := opts.PerColumn
+	if perColumn <= 0 {
+		perColumn = defaultPerColumn
+	}
+	width := opts.Width
+	if width <= 0 {
+		width = defaultBeamWidth
+	}
+	if width < n {
+		width = n
+	}
+	Keysizes := opts.Keysizes
+	for _, Keysize := range Keysizes {
+		if Keysize <= 0 {
+			return nil, fmt.Errorf("Keysize %d must be positive", Keysize)
+		}
+	}
+	if Keysizes == nil {
+		var err error
+		if Keysizes, err = guessKeysize(b); err != nil {
+			return nil, err
+		}
+	}
+	var all []XorCandidate
+	for _, Keysize := range Keysizes {
+		found, err := beamSearchKey(b, Keysize, perColumn, width, s)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, found...)
+	}
+	sortCandidates(all)
+	var res []XorCandidate
+	seen := map[string]bool{}
+	for _, c := range all {
+		if seen[string(c.Plaintext)] {
+			continue
+		}
+		seen[string(c.Plaintext)] = true
+		res = append(res, c)
+		if n > 0 && len(res) == n {
+			break
+		}
+	}
+	return res, nil
+}
+
+// beamSearchKey returns the Keys of the given size left in the beam, scored on the whole Plaintext
+func beamSearchKey(b []byte, Keysize, perColumn, width int, s Scorer) ([]XorCandidate, error) {
+	t := transpose(chunk(b, Keysize), Keysize)
+	beam := []XorCandidate{{Key: Key{}}}
+	for i := 0; i < Keysize; i++ {
+		column, err := SolveSingleByteXorCipherTopN(t[i], perColumn, columnScorer(s))
+		if err != nil {
+			return nil, err
+		}
+		var next []XorCandidate
+		for _, partial := range beam {
+			for _, c := range column {
+				k := append(append(Key{}, partial.Key...), c.Key[0])
+				next = append(next, XorCandidate{Key: k, Score: scorePartialKey(b, k, Keysize, s)})
+			}
+		}
+		sortCandidates(next)
+		if len(next) > width {
+			next = next[:width]
+		}
+		beam = next
+	}
+	for i := range beam {
+		p, err := RepeatingKeyXorBytes(b, beam[i].Key)
+		if err != nil {
+			return nil, err
+		}
+		beam[i].Plaintext = p
+		beam[i].Score = s.Score(p)
+	}
+	return beam, nil
+}
+
+// scorePartialKey scores the runs of Plaintext that the first bytes of a Key of length Keysize decrypt,
+// weighting each run by its length
+func scorePartialKey(b []byte, partial Key, Keysize int, s Scorer) float64 {
+	var total float64
+	var count int
+	for start := 0; start < len(b); start += Keysize {
+		end := start + len(partial)
+		if end > len(b) {
+			end = len(b)
+		}
+		run := make([]byte, end-start)
+		for j := range run {
+			run[j] = b[start+j] ^ partial[j]
+		}
+		total += s.Score(run) * float64(len(run))
+		count += len(run)
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / float64(count)
+}
+
+func sortCandidates(c []XorCandidate) {
+	sort.SliceStable(c, func(i, j int) bool {
+		return c[i].Score < c[j].Score
+	})
+}
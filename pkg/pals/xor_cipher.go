@@ -2,9 +2,11 @@ package pals
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"strings"
 
 	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
@@ -47,6 +49,18 @@ func chunk(b []byte, chunkSize int) [][]byte {
 }
 
 func DecryptRepeatingKeyXor(b []byte) (Plaintext, Key, error) {
+	return DecryptRepeatingKeyXorContext(context.Background(), b, AttackOptions{})
+}
+
+// DecryptRepeatingKeyXorWithScorer is DecryptRepeatingKeyXor, judging the candidates with s (DefaultScorer if nil)
+func DecryptRepeatingKeyXorWithScorer(b []byte, s Scorer) (Plaintext, Key, error) {
+	return DecryptRepeatingKeyXorContext(context.Background(), b, AttackOptions{Scorer: s})
+}
+
+// DecryptRepeatingKeyXorContext is DecryptRepeatingKeyXor, stopping with the best guess so far and an InterruptedError when ctx is done
+func DecryptRepeatingKeyXorContext(ctx context.Context, b []byte, opts AttackOptions) (Plaintext, Key, error) {
+	tracker := newProgressTracker(ctx, "DecryptRepeatingKeyXor", opts)
+	s := scorerOrDefault(opts.Scorer)
 	Keysizes, err := guessKeysize(b)
 	if err != nil {
 		return nil, nil, err
@@ -54,15 +68,20 @@ func DecryptRepeatingKeyXor(b []byte) (Plaintext, Key, error) {
 	// fmt.Printf("Best guesses for Keysize are %d\n", Keysizes)
 	var res Plaintext
 	var resKey Key
+	var candidatesTried int
+	best := math.Inf(1)
 	for i := 0; i < len(Keysizes); i++ {
-		r, k, err := DecryptRepeatingKeyXorWithKeysize(b, Keysizes[i])
+		r, k, err := decryptRepeatingKeyXorWithKeysize(tracker, b, Keysizes[i], s)
 		if err != nil {
-			return nil, nil, err
+			return res, resKey, err
 		}
-		if r.score() < res.score() {
+		if score := s.Score(r); res == nil || score < best {
 			res = r
 			resKey = k
+			best = score
 		}
+		candidatesTried += 256 * Keysizes[i]
+		tracker.report(Progress{BytesRecovered: len(res), BlocksDone: i + 1, BlocksTotal: len(Keysizes), CandidatesTried: candidatesTried}, i+1, len(Keysizes))
 	}
 	return res, resKey, nil
 }
@@ -81,11 +100,18 @@ func transpose(b [][]byte, Keysize int) [][]byte {
 }
 
 func DecryptRepeatingKeyXorWithKeysize(b []byte, Keysize int) (Plaintext, Key, error) {
+	return decryptRepeatingKeyXorWithKeysize(newProgressTracker(context.Background(), "DecryptRepeatingKeyXorWithKeysize", AttackOptions{}), b, Keysize, DefaultScorer)
+}
+
+func decryptRepeatingKeyXorWithKeysize(tracker *progressTracker, b []byte, Keysize int, s Scorer) (Plaintext, Key, error) {
 	blocks := chunk(b, Keysize)
 	t := transpose(blocks, Keysize)
 	Key := make([]string, Keysize)
 	for i := 0; i < Keysize; i++ {
-		_, k, err := SolveSingleByteXorCipher(t[i])
+		if err := tracker.interrupted(); err != nil {
+			return nil, nil, err
+		}
+		_, k, err := SolveSingleByteXorCipherWithScorer(t[i], columnScorer(s))
 		if err != nil {
 			return nil, nil, err
 		}
@@ -100,8 +126,20 @@ func DecryptRepeatingKeyXorWithKeysize(b []byte, Keysize int) (Plaintext, Key, e
 	return hplain, decryptionKey, nil
 }
 
+// number of Keysizes the repeating-key XOR solvers try
+const keysizeGuesses = 3
+
+// guessKeysize returns the likeliest Keysizes by Hamming distance, best first
 func guessKeysize(b []byte) ([]int, error) {
-	return guessKeysizeAveraged(b, 4)
+	candidates := KeysizesByHamming(b, defaultMaxKeysize)
+	if len(candidates) == 0 {
+		return nil, errors.New("Ciphertext is too short to guess a Keysize")
+	}
+	var Keysizes []int
+	for i := 0; i < len(candidates) && i < keysizeGuesses; i++ {
+		Keysizes = append(Keysizes, candidates[i].Keysize)
+	}
+	return Keysizes, nil
 }
 
 func guessKeysizeBasic(b []byte) (int, error) {
@@ -123,56 +161,6 @@ func guessKeysizeBasic(b []byte) (int, error) {
 	return KeyGuess, nil
 }
 
-func getKeysFromMap(m map[int]float64) []int {
-	Keys := make([]int, 0, len(m))
-	for k := range m {
-		Keys = append(Keys, k)
-	}
-	return Keys
-}
-
-func guessKeysizeAveraged(b []byte, numBlocks int) ([]int, error) {
-	KeyGuessesMap := make(map[int]float64)
-	var highestScoringKeysizeInMap int
-	if numBlocks < 2 {
-		return nil, errors.New("Need at least 2 blocks to compare")
-	}
-	for Keysize := 1; Keysize < 40; Keysize++ {
-		var newScore int
-		for i := 0; i < (numBlocks - 1); i++ {
-			s, err := hemmingDistanceBytes(b[Keysize*i:Keysize*(i+1)], b[Keysize*(i+1):Keysize*(i+2)])
-			if err != nil {
-				log.Fatal(err)
-				return nil, err
-			}
-			newScore += s
-		}
-		normalized := float64(newScore) / float64(Keysize) / float64(numBlocks-1)
-		// fmt.Printf("Keysize of %d has score of %f\n", Keysize, normalized)
-		NumberOfKeyGuessesToReturn := 3
-		if len(KeyGuessesMap) < NumberOfKeyGuessesToReturn {
-			// fmt.Printf("Initializing by adding Key %b with score %g\n", Keysize, normalized)
-			KeyGuessesMap[Keysize] = normalized
-		} else {
-			if normalized < KeyGuessesMap[highestScoringKeysizeInMap] {
-				// fmt.Printf("%g is lower than %g so adding %b and removing %b\n", normalized, KeyGuessesMap[highestScoringKeysizeInMap], Keysize, highestScoringKeysizeInMap)
-				delete(KeyGuessesMap, highestScoringKeysizeInMap)
-				KeyGuessesMap[Keysize] = normalized
-			}
-		}
-		var newhighestScoringKeysizeInMap float64
-		for k, v := range KeyGuessesMap {
-			if v > newhighestScoringKeysizeInMap {
-				// fmt.Printf("%g is higher than %g so setting %b to highest Key in map\n", v, newhighestScoringKeysizeInMap, k)
-				newhighestScoringKeysizeInMap = v
-				highestScoringKeysizeInMap = k
-			}
-		}
-		// fmt.Printf("highestScoringKeysizeInMap is %b at %g\n", highestScoringKeysizeInMap, KeyGuessesMap[highestScoringKeysizeInMap])
-	}
-	return getKeysFromMap(KeyGuessesMap), nil
-}
-
 // HemmingDistance returns the number of differing bits in two equal length strings
 func HemmingDistance(s1, s2 string) (int, error) {
 	return hemmingDistanceBytes([]byte(s1), []byte(s2))
@@ -0,0 +1,325 @@
+package pals
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// ErrNoFormatMatched is returned when no file format hypothesis decrypts to a file that checks out
+var ErrNoFormatMatched = errors.New("no file format and Key decrypt to a valid file")
+
+// XorScheme is the way a Key is stretched into a keystream
+type XorScheme int
+
+const (
+	// RepeatingXor repeats the Key, as RepeatingKeyXor does. A single byte Key is a Key of length 1.
+	RepeatingXor XorScheme = iota
+	// RollingXor XORs each Key byte with the low byte of its position in the file
+	RollingXor
+	// IncrementingXor adds the low byte of its position in the file to each Key byte
+	IncrementingXor
+)
+
+func (s XorScheme) String() string {
+	switch s {
+	case RepeatingXor:
+		return "repeating"
+	case RollingXor:
+		return "rolling"
+	case IncrementingXor:
+		return "incrementing"
+	}
+	return "unknown"
+}
+
+// keystream is the byte the Key byte k is stretched into at position i
+func (s XorScheme) keystream(k byte, i int) byte {
+	switch s {
+	case RollingXor:
+		return k ^ byte(i)
+	case IncrementingXor:
+		return k + byte(i)
+	}
+	return k
+}
+
+// keyByte is the Key byte that XORs p into c at position i
+func (s XorScheme) keyByte(c, p byte, i int) byte {
+	switch s {
+	case RollingXor:
+		return c ^ p ^ byte(i)
+	case IncrementingXor:
+		return (c ^ p) - byte(i)
+	}
+	return c ^ p
+}
+
+// XorWithScheme XORs b with the keystream the scheme makes from the Key. It both encrypts and decrypts.
+// An empty Key makes no keystream, and b is returned as it is.
+func XorWithScheme(b []byte, k Key, s XorScheme) []byte {
+	out := make([]byte, len(b))
+	if len(k) == 0 {
+		copy(out, b)
+		return out
+	}
+	for i := range b {
+		out[i] = b[i] ^ s.keystream(k[i%len(k)], i)
+	}
+	return out
+}
+
+// FormatCrib is a run of bytes every file of a format holds at a fixed place. A negative Offset counts
+// back from the end of the file.
+type FormatCrib struct {
+	Offset int
+	Bytes  []byte
+}
+
+// FileFormat is a hypothesis about what a file is: the bytes it must hold, the byte it mostly holds, and
+// a check that a decryption is a valid file of the format
+type FileFormat struct {
+	Name  string
+	Cribs []FormatCrib
+	// Common is the most frequent byte of files of the format, used to guess Key bytes no crib covers:
+	// 0 for formats with long runs of zeros
+	Common byte
+	Check  func(p []byte) bool
+}
+
+// FileFormats are the formats DecryptXorFileFormat tries by default
+var FileFormats = []FileFormat{
+	{
+		Name: "png",
+		Cribs: []FormatCrib{
+			// signature, then the IHDR chunk, which always comes first and is 13 bytes long
+			{0, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")},
+			// the empty IEND chunk and its CRC
+			{-12, []byte("\x00\x00\x00\x00IEND\xaeB`\x82")},
+		},
+		Check: checkPNG,
+	},
+	{
+		Name: "zip",
+		Cribs: []FormatCrib{
+			{0, []byte("PK\x03\x04")},
+			// the end of central directory record of a single disk archive with no comment
+			{-22, []byte("PK\x05\x06\x00\x00\x00\x00")},
+		},
+		Check: checkZip,
+	},
+	{
+		Name: "gzip",
+		// magic and the deflate method
+		Cribs: []FormatCrib{{0, []byte("\x1f\x8b\x08")}},
+		Check: checkGzip,
+	},
+	{
+		Name: "elf64",
+		Cribs: []FormatCrib{
+			// magic, 64 bit, little endian, version 1, System V ABI and padding
+			{0, []byte("\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00")},
+			{20, []byte("\x01\x00\x00\x00")},
+			// header size and program header entry size
+			{52, []byte("\x40\x00\x38\x00")},
+		},
+		Check: checkELF(elf.ELFCLASS64),
+	},
+	{
+		Name: "elf32",
+		Cribs: []FormatCrib{
+			{0, []byte("\x7fELF\x01\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00")},
+			{20, []byte("\x01\x00\x00\x00")},
+			{40, []byte("\x34\x00\x20\x00")},
+		},
+		Check: checkELF(elf.ELFCLASS32),
+	},
+	{
+		Name:   "pdf",
+		Cribs:  []FormatCrib{{0, []byte("%PDF-1.")}},
+		Common: ' ',
+		Check: func(p []byte) bool {
+			tail := p
+			if len(tail) > pdfTrailerWindow {
+				tail = tail[len(tail)-pdfTrailerWindow:]
+			}
+			return bytes.HasPrefix(p, []byte("%PDF-1.")) && bytes.Contains(tail, []byte("%%EOF"))
+		},
+	},
+}
+
+// the %%EOF marker must be this close to the end of a PDF
+const pdfTrailerWindow = 32
+
+// checkPNG walks the chunks, checking the CRC of each, and wants IEND to end the file
+func checkPNG(p []byte) bool {
+	const signature = 8
+	for i := signature; i+12 <= len(p); {
+		n := int(binary.BigEndian.Uint32(p[i:]))
+		if n < 0 || i+12+n > len(p) {
+			return false
+		}
+		typeAndData := p[i+4 : i+8+n]
+		if crc32.ChecksumIEEE(typeAndData) != binary.BigEndian.Uint32(p[i+8+n:]) {
+			return false
+		}
+		i += 12 + n
+		if string(typeAndData[:4]) == "IEND" {
+			return i == len(p)
+		}
+	}
+	return false
+}
+
+// checkZip reads every file of the archive, which checks their CRCs. The cribs alone make an empty
+// archive, so there must be at least one file.
+func checkZip(p []byte) bool {
+	r, err := zip.NewReader(bytes.NewReader(p), int64(len(p)))
+	if err != nil || len(r.File) == 0 {
+		return false
+	}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			return false
+		}
+		_, err = io.Copy(io.Discard, rc)
+		rc.Close()
+		if err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// checkGzip decompresses the file, which checks its CRC and length
+func checkGzip(p []byte) bool {
+	r, err := gzip.NewReader(bytes.NewReader(p))
+	if err != nil {
+		return false
+	}
+	_, err = io.Copy(io.Discard, r)
+	return err == nil
+}
+
+func checkELF(class elf.Class) func(p []byte) bool {
+	return func(p []byte) bool {
+		f, err := elf.NewFile(bytes.NewReader(p))
+		if err != nil {
+			return false
+		}
+		return f.Class == class
+	}
+}
+
+// FormatOptions configure DecryptXorFileFormat
+type FormatOptions struct {
+	// Formats are the hypotheses tried, FileFormats if nil
+	Formats []FileFormat
+	// Schemes are the ways the Key may be stretched, all of them if nil
+	Schemes []XorScheme
+	// MaxKeysize is the longest Key tried, defaultMaxKeysize if 0
+	MaxKeysize int
+}
+
+// FormatRecovery is a decryption that checked out as a valid file
+type FormatRecovery struct {
+	// Format is the name of the format hypothesis that succeeded
+	Format    string
+	Scheme    XorScheme
+	Key       Key
+	Plaintext Plaintext
+	// CribBytes is the number of Key bytes that came from the format's cribs; the rest are guessed
+	// from the most common byte of their column
+	CribBytes int
+}
+
+// the most common byte of each column is counted over at most this many bytes
+const formatSampleSize = 1 << 16
+
+// DecryptXorFileFormat recovers the Key of an XORed binary file, which DecryptRepeatingKeyXor can't do
+// since it looks for english. For each format, scheme and Keysize, shortest first, it reads Key bytes off
+// the format's cribs, giving up on the Keysize if two cribs want different bytes at the same place in the
+// Key. The Key bytes no crib covers are guessed from runs of the format's common byte, usually zero, as
+// the byte that appears most often at that place. The first Key whose decryption passes the format's
+// check is returned, along with the hypothesis that found it.
+func DecryptXorFileFormat(b []byte, opts FormatOptions) (FormatRecovery, error) {
+	formats := opts.Formats
+	if formats == nil {
+		formats = FileFormats
+	}
+	schemes := opts.Schemes
+	if schemes == nil {
+		schemes = []XorScheme{RepeatingXor, RollingXor, IncrementingXor}
+	}
+	maxKeysize := keysizeLimit(opts.MaxKeysize)
+	sample := b
+	if len(sample) > formatSampleSize {
+		sample = sample[:formatSampleSize]
+	}
+	for Keysize := 1; Keysize <= maxKeysize && Keysize <= len(b); Keysize++ {
+		for _, s := range schemes {
+			for _, f := range formats {
+				k, fromCribs, ok := formatKey(b, sample, f, s, Keysize)
+				if !ok {
+					continue
+				}
+				p := XorWithScheme(b, k, s)
+				if f.Check != nil && !f.Check(p) {
+					continue
+				}
+				return FormatRecovery{Format: f.Name, Scheme: s, Key: k, Plaintext: p, CribBytes: fromCribs}, nil
+			}
+		}
+	}
+	return FormatRecovery{}, ErrNoFormatMatched
+}
+
+// formatKey works out a Key of the given size from the format's cribs, and from the most common byte of
+// the sample at each place the cribs leave open. It fails if the cribs disagree or don't fit in the file.
+func formatKey(b, sample []byte, f FileFormat, s XorScheme, Keysize int) (Key, int, bool) {
+	k := make(Key, Keysize)
+	known := make([]bool, Keysize)
+	var fromCribs int
+	for _, crib := range f.Cribs {
+		offset := crib.Offset
+		if offset < 0 {
+			offset += len(b)
+		}
+		if offset < 0 || offset+len(crib.Bytes) > len(b) {
+			return nil, 0, false
+		}
+		for j, p := range crib.Bytes {
+			i := offset + j
+			kb := s.keyByte(b[i], p, i)
+			if known[i%Keysize] {
+				if k[i%Keysize] != kb {
+					return nil, 0, false
+				}
+				continue
+			}
+			k[i%Keysize], known[i%Keysize] = kb, true
+			fromCribs++
+		}
+	}
+	for j := range k {
+		if known[j] {
+			continue
+		}
+		var counts [256]int
+		for i := j; i < len(sample); i += Keysize {
+			counts[s.keyByte(sample[i], f.Common, i)]++
+		}
+		for x := range counts {
+			if counts[x] > counts[k[j]] {
+				k[j] = byte(x)
+			}
+		}
+	}
+	return k, fromCribs, true
+}
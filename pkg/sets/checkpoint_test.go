@@ -0,0 +1,154 @@
+package sets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
+	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
+)
+
+// cancelAfter returns a context and AttackOptions whose Progress cancels the context once enough candidates were tried
+func cancelAfter(candidates int, cp *pals.Checkpointer) (context.Context, pals.AttackOptions, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := pals.AttackOptions{Checkpoint: cp, Progress: func(p pals.Progress) {
+		if p.CandidatesTried >= candidates {
+			cancel()
+		}
+	}}
+	return ctx, opts, cancel
+}
+
+func TestResumeCBCPadding(t *testing.T) {
+	encrypt, iv, err := padAndEncryptFromSet()
+	if err != nil {
+		t.Errorf("padAndEncrypt(f) threw an error: %s", err)
+		return
+	}
+	cp := &pals.Checkpointer{Path: filepath.Join(t.TempDir(), "padding.json")}
+	oracle := pals.CBCPaddingOracle{IV: iv, Ciphertext: encrypt, ValidationFn: pals.GetValidationFnForOracle(utils.FixedKey)}
+	ctx, opts, cancel := cancelAfter(2000, cp)
+	defer cancel()
+	_, err = oracle.DecryptCBCPaddingContext(ctx, opts)
+	if !errors.Is(err, pals.ErrInterrupted) {
+		t.Errorf("DecryptCBCPaddingContext returned %v, want an interruption", err)
+		return
+	}
+	if _, err := os.Stat(cp.Path); err != nil {
+		t.Errorf("DecryptCBCPaddingContext did not leave a checkpoint: %s", err)
+		return
+	}
+
+	resumed := &pals.OracleStats{}
+	oracle.Stats = resumed
+	got, err := oracle.DecryptCBCPaddingContext(context.Background(), pals.AttackOptions{Checkpoint: cp})
+	if err != nil {
+		t.Errorf("resumed DecryptCBCPaddingContext threw an error: %s", err)
+		return
+	}
+	if want := "000000Now that the party is jumping"; string(got) != want {
+		t.Errorf("resumed DecryptCBCPaddingContext returned %q, want %q", got, want)
+	}
+	if _, err := os.Stat(cp.Path); !os.IsNotExist(err) {
+		t.Errorf("resumed DecryptCBCPaddingContext left its checkpoint behind")
+	}
+	full := &pals.OracleStats{}
+	oracle.Stats = full
+	if _, err := oracle.DecryptCBCPadding(); err != nil {
+		t.Errorf("DecryptCBCPadding threw an error: %s", err)
+		return
+	}
+	if resumed.Queries >= full.Queries {
+		t.Errorf("resumed DecryptCBCPaddingContext made %d queries, want fewer than the %d of a full run", resumed.Queries, full.Queries)
+	}
+}
+
+func TestCBCPaddingWrappedInterruption(t *testing.T) {
+	encrypt, iv, err := padAndEncryptFromSet()
+	if err != nil {
+		t.Errorf("padAndEncrypt(f) threw an error: %s", err)
+		return
+	}
+	cp := &pals.Checkpointer{Path: filepath.Join(t.TempDir(), "padding.json")}
+	// an oracle that is itself interrupted, and says so with some context, before a single byte is found:
+	// only the interruption saves a checkpoint
+	oracle := pals.CBCPaddingOracle{IV: iv, Ciphertext: encrypt, ValidationFn: func(c, iv []byte) (bool, error) {
+		return false, fmt.Errorf("remote oracle: %w", &pals.InterruptedError{Cause: context.Canceled})
+	}}
+	_, err = oracle.DecryptCBCPaddingContext(context.Background(), pals.AttackOptions{Checkpoint: cp})
+	if !errors.Is(err, pals.ErrInterrupted) {
+		t.Errorf("DecryptCBCPaddingContext returned %v, want an interruption", err)
+		return
+	}
+	if _, err := os.Stat(cp.Path); err != nil {
+		t.Errorf("DecryptCBCPaddingContext did not save a checkpoint after a wrapped interruption: %s", err)
+	}
+}
+
+func TestResumeRecoverMTSeed(t *testing.T) {
+	known := utils.FillByteSlice(14, 'A')
+	seed := uint16(50000)
+	c, err := mersenneEncrypt(append([]byte("random"), known...), seed)
+	if err != nil {
+		t.Errorf("mersenneEncrypt threw an error: %s", err)
+		return
+	}
+	cp := &pals.Checkpointer{Path: filepath.Join(t.TempDir(), "seed.json"), Every: 1024}
+	ctx, opts, cancel := cancelAfter(8192, cp)
+	defer cancel()
+	_, err = pals.RecoverMTSeedContext(ctx, c, known, opts)
+	if !errors.Is(err, pals.ErrInterrupted) {
+		t.Errorf("RecoverMTSeedContext returned %v, want an interruption", err)
+		return
+	}
+	var first pals.Progress
+	opts = pals.AttackOptions{Checkpoint: cp, Progress: func(p pals.Progress) {
+		if first.Attack == "" {
+			first = p
+		}
+	}}
+	key, err := pals.RecoverMTSeedContext(context.Background(), c, known, opts)
+	if err != nil {
+		t.Errorf("resumed RecoverMTSeedContext threw an error: %s", err)
+		return
+	}
+	if string(key) != string(pals.KeyForMTSeed(seed)) {
+		t.Errorf("resumed RecoverMTSeedContext found Key %v, want %v", key, pals.KeyForMTSeed(seed))
+	}
+	if first.CandidatesTried < 8192 {
+		t.Errorf("resumed RecoverMTSeedContext started from seed %d, want at least 8192", first.CandidatesTried)
+	}
+}
+
+func TestResumeRecoverMTTimeSeed(t *testing.T) {
+	now := time.Now().Unix()
+	plain := utils.FillByteSlice(12, 'A')
+	token, err := mersenneEncrypt(plain, uint16(now-300))
+	if err != nil {
+		t.Errorf("mersenneEncrypt threw an error: %s", err)
+		return
+	}
+	cp := &pals.Checkpointer{Path: filepath.Join(t.TempDir(), "token.json"), Every: 16}
+	ctx, opts, cancel := cancelAfter(32, cp)
+	defer cancel()
+	_, err = pals.RecoverMTTimeSeedContext(ctx, token, plain, now, 600, opts)
+	if !errors.Is(err, pals.ErrInterrupted) {
+		t.Errorf("RecoverMTTimeSeedContext returned %v, want an interruption", err)
+		return
+	}
+	// by the time the search resumes, the original window has slid out of reach of a fresh search
+	later := now + 3600
+	got, err := pals.RecoverMTTimeSeedContext(context.Background(), token, plain, later, 600, pals.AttackOptions{Checkpoint: cp})
+	if err != nil {
+		t.Errorf("resumed RecoverMTTimeSeedContext threw an error: %s", err)
+		return
+	}
+	if got != now-300 {
+		t.Errorf("resumed RecoverMTTimeSeedContext found %d, want %d", got, now-300)
+	}
+}
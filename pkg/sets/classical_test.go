@@ -0,0 +1,262 @@
+package sets
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/classical"
+)
+
+// letterAccuracy is the fraction of letters of want that got matches
+func letterAccuracy(got, want []byte) float64 {
+	var right, total int
+	for i := range want {
+		if (want[i]|0x20) < 'a' || (want[i]|0x20) > 'z' {
+			continue
+		}
+		total++
+		if i < len(got) && got[i] == want[i] {
+			right++
+		}
+	}
+	return float64(right) / float64(total)
+}
+
+func TestClassicalRoundTrip(t *testing.T) {
+	plain := []byte(FunkyMusicUnpadded[:200])
+	affine, err := classical.NewAffine(5, 8)
+	if err != nil {
+		t.Errorf("NewAffine threw an error: %s", err)
+		return
+	}
+	vigenere, err := classical.NewVigenere("LEMON")
+	if err != nil {
+		t.Errorf("NewVigenere threw an error: %s", err)
+		return
+	}
+	autokey, err := classical.NewAutokey("QUEEN")
+	if err != nil {
+		t.Errorf("NewAutokey threw an error: %s", err)
+		return
+	}
+	substitution, err := classical.NewSubstitution("QWERTYUIOPASDFGHJKLZXCVBNM")
+	if err != nil {
+		t.Errorf("NewSubstitution threw an error: %s", err)
+		return
+	}
+	for _, c := range []classical.Cipher{classical.Caesar{Shift: 3}, affine, vigenere, autokey, substitution} {
+		e := c.Encrypt(plain)
+		if string(e) == string(plain) || string(c.Decrypt(e)) != string(plain) {
+			t.Errorf("%T did not round trip: %q", c, c.Decrypt(e))
+		}
+	}
+	if got := string(vigenere.Encrypt([]byte("Attack at dawn!"))); got != "Lxfopv ef rnhr!" {
+		t.Errorf("Vigenere(LEMON) encrypted %q, want %q", got, "Lxfopv ef rnhr!")
+	}
+	if got := string(autokey.Encrypt([]byte("attack at dawn"))); got != "qnxepk tm dcgn" {
+		t.Errorf("Autokey(QUEEN) encrypted %q, want %q", got, "qnxepk tm dcgn")
+	}
+	if _, err := classical.NewAffine(13, 1); err == nil {
+		t.Errorf("NewAffine accepted a multiplier with no inverse")
+	}
+	if _, err := classical.NewSubstitution("ABCDEFGHIJKLMNOPQRSTUVWXYA"); err == nil {
+		t.Errorf("NewSubstitution accepted a repeated letter")
+	}
+	// Keys the constructors refuse pass text through rather than panic or garble it
+	var letters classical.Substitution
+	copy(letters.Alphabet[:], "QWERTYUIOPASDFGHJKLZXCVBNM")
+	refused := []classical.Cipher{classical.Vigenere{}, classical.Autokey{}, classical.Affine{}, classical.Affine{A: 13, B: 1},
+		classical.Substitution{}, letters}
+	for _, c := range refused {
+		if e, d := c.Encrypt(plain), c.Decrypt(plain); string(e) != string(plain) || string(d) != string(plain) {
+			t.Errorf("%#v changed the text: %q, %q", c, e, d)
+		}
+	}
+}
+
+func TestClassicalSolvers(t *testing.T) {
+	plain := []byte(FunkyMusicUnpadded[:600])
+
+	caesar, got := classical.SolveCaesar(classical.Caesar{Shift: 11}.Encrypt(plain), nil)
+	if caesar.Shift != 11 || string(got) != string(plain) {
+		t.Errorf("SolveCaesar found the shift %d", caesar.Shift)
+	}
+
+	affine, _ := classical.NewAffine(7, 3)
+	gotAffine, got := classical.SolveAffine(affine.Encrypt(plain), nil)
+	if gotAffine != affine || string(got) != string(plain) {
+		t.Errorf("SolveAffine found %+v, want %+v", gotAffine, affine)
+	}
+
+	vigenere, _ := classical.NewVigenere("VANILLA")
+	c := vigenere.Encrypt(plain)
+	if lens := classical.VigenereKeylens(c, 0); lens[0]%7 != 0 {
+		t.Errorf("VigenereKeylens ranked %d first, want a multiple of 7", lens[0])
+	}
+	gotVigenere, got := classical.SolveVigenere(c, 0, nil)
+	if gotVigenere.KeyString() != "VANILLA" || string(got) != string(plain) {
+		t.Errorf("SolveVigenere found the Key %q", gotVigenere.KeyString())
+	}
+
+	autokey, _ := classical.NewAutokey("ICE")
+	gotAutokey, got := classical.SolveAutokey(autokey.Encrypt(plain), 0, nil)
+	if gotAutokey.PrimerString() != "ICE" || string(got) != string(plain) {
+		t.Errorf("SolveAutokey found the Primer %q", gotAutokey.PrimerString())
+	}
+
+	substitution, _ := classical.NewSubstitution("PHQGIUMEAYLNOFDXJKRCVSTZWB")
+	_, got = classical.SolveSubstitution(substitution.Encrypt(plain), classical.SubstitutionOptions{Rand: rand.New(rand.NewSource(1))})
+	// letters that never appear can't be recovered, so judge the text rather than the Key. The lyrics are
+	// far from the prose the quadgrams were trained on, and a few swaps such as m for r score as well as the truth.
+	if acc := letterAccuracy(got, plain); acc < 0.85 {
+		t.Errorf("SolveSubstitution got %.2f of the letters right: %q", acc, got[:100])
+	}
+}
+
+func TestIndexOfCoincidence(t *testing.T) {
+	plain := []byte(FunkyMusicUnpadded)
+	english := classical.IndexOfCoincidence(plain)
+	vigenere, _ := classical.NewVigenere("TERMINATORX")
+	flattened := classical.IndexOfCoincidence(vigenere.Encrypt(plain))
+	if english < 1.5 || flattened > 1.3 {
+		t.Errorf("IndexOfCoincidence is %.2f for english and %.2f for Vigenere", english, flattened)
+	}
+	if got := classical.IndexOfCoincidence(classical.Caesar{Shift: 5}.Encrypt(plain)); got != english {
+		t.Errorf("IndexOfCoincidence changed under Caesar from %.2f to %.2f", english, got)
+	}
+}
+
+func TestTranspositionCiphers(t *testing.T) {
+	plain := []byte("WEAREDISCOVEREDFLEEATONCE")
+	padded, err := classical.NewColumnar("ZEBRAS", 'X')
+	if err != nil {
+		t.Errorf("NewColumnar threw an error: %s", err)
+		return
+	}
+	if got := string(padded.Encrypt(plain)); got != "EVLNXACDTXESEAXROFOXDEECXWIREE" {
+		t.Errorf("padded Columnar(ZEBRAS) encrypted %q", got)
+	}
+	irregular, _ := classical.NewColumnar("ZEBRAS", 0)
+	if got := string(irregular.Encrypt(plain)); got != "EVLNACDTESEAROFODEECWIREE" {
+		t.Errorf("Columnar(ZEBRAS) encrypted %q", got)
+	}
+	second, _ := classical.NewColumnar("STRIPE", 0)
+	double := classical.DoubleTransposition{First: irregular, Second: second}
+	if got := string(double.Encrypt(plain)); got != "CAEENSOIAEDRLEFWEDREEVTOC" {
+		t.Errorf("DoubleTransposition(ZEBRAS, STRIPE) encrypted %q", got)
+	}
+	rails, err := classical.NewRailFence(3)
+	if err != nil {
+		t.Errorf("NewRailFence threw an error: %s", err)
+		return
+	}
+	if got := string(rails.Encrypt([]byte("WEAREDISCOVEREDRUNATONCE"))); got != "WECRUOERDSOEERNTNEAIVDAC" {
+		t.Errorf("RailFence(3) encrypted %q", got)
+	}
+	long := []byte(FunkyMusicUnpadded[:200])
+	for _, c := range []classical.Cipher{padded, irregular, double, rails} {
+		if got := c.Decrypt(c.Encrypt(long)); string(got[:len(long)]) != string(long) {
+			t.Errorf("%T did not round trip: %q", c, got)
+		}
+	}
+	refused := []classical.Cipher{classical.Columnar{}, classical.Columnar{Pad: 'X'},
+		classical.Columnar{Order: []int{0, 0}}, classical.Columnar{Order: []int{1, -1}}, classical.Columnar{Order: []int{0, 2}}}
+	for _, c := range refused {
+		if e, d := c.Encrypt(plain), c.Decrypt(plain); string(e) != string(plain) || string(d) != string(plain) {
+			t.Errorf("%#v changed the text: %q, %q", c, e, d)
+		}
+	}
+	if _, err := classical.NewRailFence(1); err == nil {
+		t.Errorf("NewRailFence accepted a single rail")
+	}
+}
+
+func TestTranspositionSolvers(t *testing.T) {
+	plain := []byte(FunkyMusicUnpadded[:300])
+
+	rails, _ := classical.NewRailFence(5)
+	gotRails, got := classical.SolveRailFence(rails.Encrypt(plain), 0, nil)
+	if gotRails != rails || string(got) != string(plain) {
+		t.Errorf("SolveRailFence found %d rails", gotRails.Rails)
+	}
+
+	for _, key := range []string{"CRYPTO", "TRANSPOSED"} {
+		columnar, _ := classical.NewColumnar(key, 0)
+		_, got := classical.SolveColumnar(columnar.Encrypt(plain), classical.TranspositionOptions{})
+		if string(got) != string(plain) {
+			t.Errorf("SolveColumnar did not find the Key %s: %q", key, got[:60])
+		}
+	}
+
+	first, _ := classical.NewColumnar("ZEBRA", 0)
+	second, _ := classical.NewColumnar("FOX", 0)
+	double := classical.DoubleTransposition{First: first, Second: second}
+	_, got = classical.SolveDoubleTransposition(double.Encrypt(plain), classical.TranspositionOptions{MaxKeylen: 5})
+	if string(got) != string(plain) {
+		t.Errorf("SolveDoubleTransposition did not find the Keys ZEBRA and FOX: %q", got[:60])
+	}
+}
+
+func TestHillCipher(t *testing.T) {
+	hill, err := classical.NewHillFromString("GYBNQKURP")
+	if err != nil {
+		t.Errorf("NewHillFromString threw an error: %s", err)
+		return
+	}
+	if got := string(hill.Encrypt([]byte("ACT"))); got != "POH" {
+		t.Errorf("Hill(GYBNQKURP) encrypted ACT to %q, want POH", got)
+	}
+	if got := string(hill.Decrypt([]byte("POH"))); got != "ACT" {
+		t.Errorf("Hill(GYBNQKURP) decrypted POH to %q, want ACT", got)
+	}
+	plain := []byte(FunkyMusicUnpadded[:200])
+	if got := hill.Decrypt(hill.Encrypt(plain)); string(got[:len(plain)]) != string(plain) {
+		t.Errorf("Hill did not round trip: %q", got)
+	}
+	for _, key := range [][][]int{nil, {{1, 2, 3}, {4, 5, 6}}, {{2, 4}, {1, 2}}} {
+		c := classical.Hill{Key: key}
+		if e, d := c.Encrypt(plain), c.Decrypt(plain); string(e) != string(plain) || string(d) != string(plain) {
+			t.Errorf("Hill with the Key %v changed the text: %q, %q", key, e, d)
+		}
+	}
+	for _, singular := range [][][]int{{{2, 4}, {1, 2}}, {{2, 0}, {0, 1}}, {{13, 0}, {0, 1}}} {
+		if _, err := classical.NewHill(singular); !errors.Is(err, classical.ErrSingularMatrix) {
+			t.Errorf("NewHill(%v) returned %v, want ErrSingularMatrix", singular, err)
+		}
+	}
+	if _, err := classical.NewHill([][]int{{1, 2}, {3}}); err == nil {
+		t.Errorf("NewHill accepted a matrix that is not square")
+	}
+}
+
+func TestHillAttacks(t *testing.T) {
+	plain := []byte(FunkyMusicUnpadded[:600])
+	for _, key := range []string{"HILL", "GYBNQKURP"} {
+		hill, _ := classical.NewHillFromString(key)
+		c := hill.Encrypt(plain)
+		n := len(hill.Key)
+
+		recovered, err := classical.RecoverHill(plain[:60], c, n)
+		if err != nil {
+			t.Errorf("RecoverHill threw an error: %s", err)
+			return
+		}
+		if fmt.Sprint(recovered.Key) != fmt.Sprint(hill.Key) {
+			t.Errorf("RecoverHill found %v, want %v", recovered.Key, hill.Key)
+		}
+
+		solved, got, err := classical.SolveHill(c, n, classical.HillOptions{})
+		if err != nil {
+			t.Errorf("SolveHill threw an error: %s", err)
+			return
+		}
+		if fmt.Sprint(solved.Key) != fmt.Sprint(hill.Key) || string(got[:len(plain)]) != string(plain) {
+			t.Errorf("SolveHill found %v, want %v: %q", solved.Key, hill.Key, got[:60])
+		}
+	}
+	if _, err := classical.RecoverHill([]byte("aaaaaaaa"), []byte("bbbbbbbb"), 2); !errors.Is(err, classical.ErrSingularMatrix) {
+		t.Errorf("RecoverHill returned %v for a Plaintext with no independent blocks", err)
+	}
+}
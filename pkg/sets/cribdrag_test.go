@@ -0,0 +1,118 @@
+package sets
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
+	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
+)
+
+func challenge19Session(t *testing.T) ([][]byte, *pals.CribSession) {
+	filename := "../../challenges/challenge19.txt"
+	lines, err := utils.ScanFile(filename)
+	if err != nil {
+		t.Fatalf("ScanFile(%q) threw an error: %s", filename, err)
+	}
+	var plaintexts [][]byte
+	var ciphertexts []pals.Ciphertext
+	for _, l := range lines {
+		decoded, err := utils.ParseBase64(l)
+		if err != nil {
+			t.Fatalf("ParseBase64 threw an error: %s", err)
+		}
+		c, err := pals.CTR{Plaintext: decoded}.Encrypt(utils.FixedKey)
+		if err != nil {
+			t.Fatalf("Encrypt threw an error: %s", err)
+		}
+		plaintexts = append(plaintexts, decoded)
+		ciphertexts = append(ciphertexts, c)
+	}
+	return plaintexts, pals.NewCribSession(ciphertexts)
+}
+
+func TestCribDrag(t *testing.T) {
+	plaintexts, s := challenge19Session(t)
+	// line 4 is "I have passed with a nod of the head"
+	crib := []byte(" with a nod ")
+	placements, err := s.Drag(4, crib)
+	if err != nil {
+		t.Errorf("Drag threw an error: %s", err)
+		return
+	}
+	want := bytes.Index(plaintexts[4], crib)
+	if placements[0].Offset != want {
+		t.Errorf("Drag ranked offset %d first, want %d", placements[0].Offset, want)
+	}
+	for i, implied := range placements[0].Implied {
+		if i == 4 || implied == nil {
+			continue
+		}
+		if !bytes.Equal(implied, plaintexts[i][want:want+len(implied)]) {
+			t.Errorf("Drag implied %q for line %d, want %q", implied, i, plaintexts[i][want:want+len(implied)])
+		}
+	}
+	// any Scorer can rank the placements
+	s.Scorer = pals.EnglishQuadgrams()
+	placements, err = s.Drag(4, crib)
+	if err != nil {
+		t.Errorf("Drag threw an error: %s", err)
+		return
+	}
+	if placements[0].Offset != want {
+		t.Errorf("Drag with the quadgram model ranked offset %d first, want %d", placements[0].Offset, want)
+	}
+}
+
+func TestCribSessionLockAndSave(t *testing.T) {
+	plaintexts, s := challenge19Session(t)
+	if err := s.Lock(4, 0, plaintexts[4]); err != nil {
+		t.Errorf("Lock threw an error: %s", err)
+		return
+	}
+	if err := s.Lock(0, 0, []byte("much too long to fit on the first line of the poem")); err == nil {
+		t.Errorf("Lock accepted a crib past the end of the Ciphertext")
+	}
+	filename := filepath.Join(t.TempDir(), "session.json")
+	if err := s.Save(filename); err != nil {
+		t.Errorf("Save threw an error: %s", err)
+		return
+	}
+	loaded, err := pals.LoadCribSession(filename)
+	if err != nil {
+		t.Errorf("LoadCribSession threw an error: %s", err)
+		return
+	}
+	got, known := loaded.Plaintexts()
+	for i, p := range plaintexts {
+		for j := range p {
+			if j < len(plaintexts[4]) != known[i][j] {
+				t.Errorf("byte %d of line %d known=%t after locking line 4", j, i, known[i][j])
+				return
+			}
+			if known[i][j] && got[i][j] != p[j] {
+				t.Errorf("line %d decrypted to %q, want %q", i, got[i], p)
+				return
+			}
+		}
+	}
+	// a Ciphertext longer than the Keystream would make Plaintexts index past its end
+	loaded.Keystream, loaded.Known = loaded.Keystream[:10], loaded.Known[:10]
+	corrupt := filepath.Join(t.TempDir(), "corrupt.json")
+	if err := loaded.Save(corrupt); err != nil {
+		t.Errorf("Save threw an error: %s", err)
+		return
+	}
+	if _, err := pals.LoadCribSession(corrupt); err == nil {
+		t.Errorf("LoadCribSession accepted Ciphertexts longer than the Keystream")
+	}
+	if loaded, err = pals.LoadCribSession(filename); err != nil {
+		t.Errorf("LoadCribSession threw an error: %s", err)
+		return
+	}
+	loaded.Unlock(0, 10)
+	if _, known = loaded.Plaintexts(); known[0][9] || !known[0][10] {
+		t.Errorf("Unlock(0, 10) did not forget exactly the first 10 bytes")
+	}
+}
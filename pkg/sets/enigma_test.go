@@ -0,0 +1,167 @@
+package sets
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/enigma"
+)
+
+// enigmaPlaintext is the letters of the song, in upper case, as an Enigma operator would key them
+func enigmaPlaintext(n int) []byte {
+	var p []byte
+	for _, b := range []byte(strings.ToUpper(FunkyMusicUnpadded)) {
+		if b >= 'A' && b <= 'Z' && len(p) < n {
+			p = append(p, b)
+		}
+	}
+	return p
+}
+
+func TestEnigmaTestVectors(t *testing.T) {
+	s := enigma.Settings{Rotors: [3]string{"I", "II", "III"}, Reflector: "B"}
+	got, err := s.Encrypt([]byte("AAAAA"))
+	if err != nil {
+		t.Errorf("Encrypt threw an error: %s", err)
+		return
+	}
+	if string(got) != "BDZGO" {
+		t.Errorf("I-II-III at AAA encrypted AAAAA to %s, want BDZGO", got)
+	}
+
+	// the middle rotor turns at E, and then turns itself and the left rotor on the next key press
+	s.Positions, _ = enigma.ParseLetters("ADU")
+	m, _ := enigma.New(s)
+	for _, want := range []string{"ADV", "AEW", "BFX", "BFY"} {
+		m.Encrypt([]byte("A"))
+		if got := enigma.FormatLetters(m.Positions()); got != want {
+			t.Errorf("rotors stepped to %s, want %s", got, want)
+		}
+	}
+
+	// Operation Barbarossa, 1941
+	barbarossa := enigma.Settings{Rotors: [3]string{"II", "IV", "V"}, Reflector: "B", Plugboard: "AV BS CG DL FU HZ IN KM OW RX"}
+	barbarossa.Rings, _ = enigma.ParseLetters("BUL")
+	barbarossa.Positions, _ = enigma.ParseLetters("BLA")
+	got, _ = barbarossa.Encrypt([]byte("EDPUD NRGYS ZRCXN UYTPO MRMBO FKTBZ REZKM LXLVE FGUEY SIOZV EQMIK UBPMM YLKLT TDEIS MDICA GYKUA CTCDO MOHWX MUUIA UBSTS LRNBZ SZWNR FXWFY SSXJZ VIJHI DISHP RKLKA YUPAD TXQSP INQMA TLPIF SVKDA SCTAC DPBOP VHJK"))
+	want := "AUFKL XABTE ILUNG XVONX KURTI NOWAX KURTI NOWAX NORDW ESTLX SEBEZ XSEBE ZXUAF FLIEG ERSTR ASZER IQTUN GXDUB ROWKI XDUBR OWKIX OPOTS CHKAX OPOTS CHKAX UMXEI NSAQT DREIN ULLXU HRANG ETRET ENXAN GRIFF XINFX RGTX"
+	if string(got) != want {
+		t.Errorf("Barbarossa message decrypted to %s", got)
+	}
+
+	for _, bad := range []enigma.Settings{
+		{Rotors: [3]string{"I", "I", "III"}, Reflector: "B"},
+		{Rotors: [3]string{"I", "II", "IX"}, Reflector: "B"},
+		{Rotors: [3]string{"I", "II", "III"}, Reflector: "B", Plugboard: "AB AC"},
+	} {
+		if _, err := enigma.New(bad); err == nil {
+			t.Errorf("New accepted %s", bad)
+		}
+	}
+}
+
+// solveStops runs SolvePlugboard on every stop in turn, and returns the first whose decryption starts with the crib
+func solveStops(t *testing.T, c, crib []byte, stops []enigma.Stop) (enigma.Settings, []byte, bool) {
+	for _, stop := range stops {
+		s, solved, err := enigma.SolvePlugboard(c, stop.Settings, 0)
+		if err != nil {
+			t.Errorf("SolvePlugboard threw an error: %s", err)
+			return s, nil, false
+		}
+		if strings.HasPrefix(string(solved), string(crib)) {
+			return s, solved, true
+		}
+	}
+	return enigma.Settings{}, nil, false
+}
+
+func TestEnigmaBombe(t *testing.T) {
+	plain := enigmaPlaintext(400)
+	key := enigma.Settings{Rotors: [3]string{"III", "I", "II"}, Reflector: "B", Plugboard: "AV BS CG DL FU HZ IN KM OW RX"}
+	key.Positions, _ = enigma.ParseLetters("QEK")
+	c, err := key.Encrypt(plain)
+	if err != nil {
+		t.Errorf("Encrypt threw an error: %s", err)
+		return
+	}
+
+	crib := plain[:30]
+	found := false
+	for _, offset := range enigma.CribOffsets(c, crib) {
+		found = found || offset == 0
+	}
+	if !found {
+		t.Errorf("CribOffsets ruled out the crib's true offset")
+	}
+
+	stops, err := enigma.Bombe(c, crib, 0, enigma.BombeOptions{Rotors: []string{"I", "II", "III"}})
+	if err != nil {
+		t.Errorf("Bombe threw an error: %s", err)
+		return
+	}
+	if len(stops) > 10 {
+		t.Errorf("Bombe stopped %d times for a 30 letter crib", len(stops))
+	}
+	s, solved, ok := solveStops(t, c, crib, stops)
+	if !ok {
+		t.Errorf("no stop of %d decrypted to the crib", len(stops))
+		return
+	}
+	if s.Rotors != key.Rotors || s.Positions != key.Positions {
+		t.Errorf("the crib decrypted under %s, want %s", s, key)
+	}
+	if string(solved) != string(plain) {
+		t.Errorf("SolvePlugboard decrypted %s", solved[:60])
+	}
+}
+
+func TestEnigmaBombeRings(t *testing.T) {
+	plain := enigmaPlaintext(400)
+	key := enigma.Settings{Rotors: [3]string{"III", "I", "II"}, Reflector: "B", Plugboard: "AV BS CG DL FU HZ IN KM OW RX"}
+	key.Positions, _ = enigma.ParseLetters("QEK")
+	// the right ring is left at A, so the right rotor turns the middle one at the same letter of the crib
+	// whatever rings the bombe assumes
+	key.Rings, _ = enigma.ParseLetters("DFA")
+	c, err := key.Encrypt(plain)
+	if err != nil {
+		t.Errorf("Encrypt threw an error: %s", err)
+		return
+	}
+	crib := plain[:30]
+
+	// with the rings known, the bombe finds the key itself
+	stops, err := enigma.Bombe(c, crib, 0, enigma.BombeOptions{Rotors: []string{"I", "II", "III"}, Rings: key.Rings})
+	if err != nil {
+		t.Errorf("Bombe threw an error: %s", err)
+		return
+	}
+	s, solved, ok := solveStops(t, c, crib, stops)
+	if !ok {
+		t.Errorf("no stop of %d with rings %s decrypted to the crib", len(stops), enigma.FormatLetters(key.Rings))
+		return
+	}
+	if s.Positions != key.Positions || string(solved) != string(plain) {
+		t.Errorf("the crib decrypted under %s to %s, want %s", s, solved[:60], key)
+	}
+
+	// with the rings assumed AAA, it stops at the positions off by the ring settings. About 300 letters in,
+	// the middle rotor turns the left one under the true rings but not under AAA, so only the text before
+	// that is used to solve the plugboard.
+	stops, err = enigma.Bombe(c, crib, 0, enigma.BombeOptions{Rotors: []string{"I", "II", "III"}})
+	if err != nil {
+		t.Errorf("Bombe threw an error: %s", err)
+		return
+	}
+	s, _, ok = solveStops(t, c[:250], crib, stops)
+	if !ok {
+		t.Errorf("no stop of %d with rings AAA decrypted to the crib", len(stops))
+		return
+	}
+	var want [3]int
+	for i := range want {
+		want[i] = (key.Positions[i] - key.Rings[i] + 26) % 26
+	}
+	if s.Rotors != key.Rotors || s.Positions != want {
+		t.Errorf("with rings AAA the crib decrypted under %s, want positions %s", s, enigma.FormatLetters(want))
+	}
+}
@@ -0,0 +1,67 @@
+package sets
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
+	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
+)
+
+func TestAnalyzeCiphertextFile(t *testing.T) {
+	filename := "../../challenges/challenge8.txt"
+	reports, err := pals.AnalyzeCiphertextFile(filename)
+	if err != nil {
+		t.Errorf("AnalyzeCiphertextFile(%q) threw an error: %s", filename, err)
+		return
+	}
+	top := reports[0]
+	if top.Line != 133 || top.Mode().Mode != pals.ECB {
+		t.Errorf("AnalyzeCiphertextFile(%q) ranked line %d (%s) first, want line 133 (ECB)", filename, top.Line, top.Mode().Mode)
+	}
+	if top.Encoding != pals.Hex || top.Blocksize != 16 {
+		t.Errorf("AnalyzeCiphertextFile(%q) reported encoding %s and blocksize %d, want hex and 16", filename, top.Encoding, top.Blocksize)
+	}
+	if len(top.RepeatedBlocks) != 1 || top.RepeatedBlocks[0].Count != 4 {
+		t.Errorf("AnalyzeCiphertextFile(%q) reported repeated blocks %v, want one block repeated 4 times", filename, top.RepeatedBlocks)
+	}
+	if reports[1].Mode().Mode == pals.ECB {
+		t.Errorf("AnalyzeCiphertextFile(%q) guessed ECB for line %d too", filename, reports[1].Line)
+	}
+}
+
+func TestAnalyzeCiphertextModes(t *testing.T) {
+	filename := "../../challenges/challenge7.txt"
+	lines, err := utils.ScanFile(filename)
+	if err != nil {
+		t.Errorf("ScanFile(%q) threw an error: %s", filename, err)
+		return
+	}
+	var b64 []byte
+	for _, l := range lines {
+		b64 = append(b64, l+"\n"...)
+	}
+	r := pals.AnalyzeCiphertext(b64)
+	if r.Encoding != pals.Base64 || len(r.Ciphertext) != 2880 {
+		t.Errorf("AnalyzeCiphertext(%q) decoded %d bytes as %s, want 2880 bytes of base64", filename, len(r.Ciphertext), r.Encoding)
+	}
+	if len(r.BlockEntropy) != 2880/16 {
+		t.Errorf("AnalyzeCiphertext(%q) returned %d block entropies, want %d", filename, len(r.BlockEntropy), 2880/16)
+	}
+	if s := r.String(); !strings.Contains(s, "per block:") || !strings.Contains(s, "length mod: %16=0 %8=0") {
+		t.Errorf("AnalyzeCiphertext(%q) report is missing the block entropies or length moduli:\n%s", filename, s)
+	}
+
+	c, err := pals.CTR{Plaintext: []byte(FunkyMusicUnpadded[:101])}.Encrypt(utils.GenerateKey())
+	if err != nil {
+		t.Errorf("CTR Encrypt threw an error: %s", err)
+		return
+	}
+	r = pals.AnalyzeCiphertext(c)
+	if r.Encoding != pals.Raw || r.Mode().Mode != pals.Stream {
+		t.Errorf("AnalyzeCiphertext(CTR) guessed %s encoded %s, want raw encoded Stream", r.Encoding, r.Mode().Mode)
+	}
+	if s := r.String(); r.Blocksize == 1 && strings.Contains(s, "per block:") {
+		t.Errorf("AnalyzeCiphertext(CTR) report shows block entropies for single byte blocks:\n%s", s)
+	}
+}
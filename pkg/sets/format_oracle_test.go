@@ -0,0 +1,63 @@
+package sets
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
+)
+
+func TestFormatOracleKeyValueCTR(t *testing.T) {
+	input := []byte("hello")
+	c, err := encryptUserDataCTR(input)
+	if err != nil {
+		t.Errorf("encryptUserDataCTR threw an error: %s", err)
+		return
+	}
+	stats := &pals.OracleStats{}
+	o := pals.FormatOracle{Mode: pals.Stream, Ciphertext: c, Predicate: pals.KeyValuePredicate, Query: parsesUserDataCTR, Stats: stats}
+	res, err := o.Decrypt()
+	if err != nil {
+		t.Errorf("FormatOracle.Decrypt threw an error: %s", err)
+		return
+	}
+	want, _ := getUserData(input)
+	if !res.Exploitable() || !bytes.Equal(res.Plaintext, want) {
+		t.Errorf("FormatOracle.Decrypt recovered %q (%d of %d bytes resolved), want %q", res.Plaintext, res.Resolved(), len(want), want)
+	}
+	if stats.Queries != res.Queries {
+		t.Errorf("FormatOracle.Decrypt counted %d queries, but the oracle saw %d", res.Queries, stats.Queries)
+	}
+}
+
+func TestAssessFormatPredicates(t *testing.T) {
+	sample := []byte(`{"admin":false}`)
+	exploitable := map[string]map[pals.AESMode]bool{
+		"ASCII":     {pals.Stream: false, pals.CBC: false},
+		"UTF-8":     {pals.Stream: false, pals.CBC: false},
+		"key=value": {pals.Stream: true, pals.CBC: true},
+		// trailing bytes of a CBC block can't be cut off, and leave the JSON unparseable
+		"JSON": {pals.Stream: true, pals.CBC: false},
+	}
+	for _, p := range pals.FormatPredicates() {
+		for _, mode := range []pals.AESMode{pals.Stream, pals.CBC} {
+			r, err := pals.AssessFormatPredicate(p, mode, sample)
+			if err != nil {
+				t.Errorf("AssessFormatPredicate(%s, %s) threw an error: %s", p.Name, mode, err)
+				continue
+			}
+			t.Log(r)
+			if r.Exploitable != exploitable[p.Name][mode] {
+				t.Errorf("AssessFormatPredicate(%s, %s) reported exploitable=%t", p.Name, mode, r.Exploitable)
+			}
+		}
+	}
+	r, err := pals.AssessFormatPredicate(pals.ASCIIPredicate, pals.Stream, sample)
+	if err != nil {
+		t.Errorf("AssessFormatPredicate threw an error: %s", err)
+		return
+	}
+	if r.BitsPerByte != 1 {
+		t.Errorf("ASCII predicate leaked %.2f bits per byte, want the top bit only", r.BitsPerByte)
+	}
+}
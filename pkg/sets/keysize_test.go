@@ -0,0 +1,97 @@
+package sets
+
+import (
+	"testing"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
+	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
+)
+
+var keysizeEstimators = []struct {
+	name string
+	f    func(b []byte, maxKeysize int) []pals.KeysizeCandidate
+}{
+	{"Hamming", pals.KeysizesByHamming},
+	{"IoC", pals.KeysizesByIoC},
+	{"Kasiski", pals.KeysizesByKasiski},
+}
+
+// rankOf is the position of the first candidate that is keysize or a multiple of it, or -1
+func rankOf(candidates []pals.KeysizeCandidate, keysize int) int {
+	for i, c := range candidates {
+		if c.Keysize%keysize == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestKeysizeEstimators(t *testing.T) {
+	challenge6, err := utils.ReadBase64File("../../challenges/challenge6.txt")
+	if err != nil {
+		t.Errorf("ReadBase64File threw an error: %s", err)
+		return
+	}
+	ice, err := pals.RepeatingKeyXorBytes([]byte(FunkyMusicUnpadded[:240]), []byte("ICE ICE BABY"))
+	if err != nil {
+		t.Errorf("RepeatingKeyXorBytes threw an error: %s", err)
+		return
+	}
+	for _, e := range keysizeEstimators {
+		for _, c := range []struct {
+			name    string
+			b       []byte
+			keysize int
+			max     int
+		}{
+			{"challenge 6", challenge6, 29, 0},
+			{"ICE ICE BABY", ice, 12, 0},
+			{"challenge 6 up to 100", challenge6, 29, 100},
+		} {
+			got := e.f(c.b, c.max)
+			rank := rankOf(got, c.keysize)
+			t.Logf("%s on %s: Keysize %d ranked %d of %d", e.name, c.name, c.keysize, rank, len(got))
+			if rank < 0 || rank >= 3 {
+				t.Errorf("%s ranked Keysize %d of %s at %d", e.name, c.keysize, c.name, rank)
+			}
+			for i := 1; i < len(got); i++ {
+				if got[i].Score < got[i-1].Score {
+					t.Errorf("%s candidates are out of order at %d", e.name, i)
+				}
+			}
+			limit := c.max
+			if limit == 0 {
+				limit = 40
+			}
+			if len(got) == 0 || got[len(got)-1].Keysize > limit {
+				t.Errorf("%s tried %d Keysizes, up to %d", e.name, len(got), limit)
+			}
+		}
+	}
+}
+
+func TestKeysizeEstimatorsShortInput(t *testing.T) {
+	for _, e := range keysizeEstimators {
+		var previous int
+		for _, l := range []int{0, 1, 2, 5, 17, 60} {
+			got := e.f([]byte(FunkyMusicUnpadded[:l]), 0)
+			for _, c := range got {
+				// Kasiski only needs a repeat, not two whole blocks
+				if (e.name == "Kasiski" && c.Keysize >= l) || (e.name != "Kasiski" && 2*c.Keysize > l) {
+					t.Errorf("%s scored Keysize %d for %d bytes", e.name, c.Keysize, l)
+				}
+			}
+			if e.name != "Kasiski" && len(got) < previous {
+				t.Errorf("%s returned %d candidates for %d bytes, fewer than for a shorter input", e.name, len(got), l)
+			}
+			previous = len(got)
+		}
+	}
+	if _, _, err := pals.DecryptRepeatingKeyXor([]byte{1}); err == nil {
+		t.Errorf("DecryptRepeatingKeyXor accepted a single byte")
+	}
+	got, _, err := pals.DecryptRepeatingKeyXor([]byte("short"))
+	if err != nil || len(got) != 5 {
+		t.Errorf("DecryptRepeatingKeyXor(%q) == %q, %v", "short", got, err)
+	}
+}
@@ -0,0 +1,106 @@
+package sets
+
+import (
+	"crypto/aes"
+	"math"
+	"testing"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
+	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
+)
+
+func paddingOracleCandidates(t *testing.T) [][]byte {
+	var candidates [][]byte
+	for _, s := range paddingOracleStrings {
+		p, err := utils.ParseBase64(s)
+		if err != nil {
+			t.Fatalf("ParseBase64 threw an error: %s", err)
+		}
+		candidates = append(candidates, p)
+	}
+	return candidates
+}
+
+func TestLengthPosterior(t *testing.T) {
+	candidates := paddingOracleCandidates(t)
+	c, _, err := padAndEncryptFromSet()
+	if err != nil {
+		t.Errorf("padAndEncryptFromSet threw an error: %s", err)
+		return
+	}
+	posterior, err := pals.LengthPosterior(candidates, nil, pals.CBCLength(aes.BlockSize), len(c))
+	if err != nil {
+		t.Errorf("LengthPosterior threw an error: %s", err)
+		return
+	}
+	// padAndEncryptFromSet always sends the first string
+	if posterior[0] == 0 {
+		t.Errorf("LengthPosterior ruled out the string that was sent")
+	}
+	var total float64
+	for i, p := range posterior {
+		total += p
+		if p > 0 && (len(candidates[i])/aes.BlockSize+1)*aes.BlockSize != len(c) {
+			t.Errorf("LengthPosterior gave %.2f to candidate %d, which can't produce %d bytes", p, i, len(c))
+		}
+	}
+	if math.Abs(total-1) > 1e-9 {
+		t.Errorf("LengthPosterior sums to %f, want 1", total)
+	}
+
+	// the model matches what CTR actually produces
+	measured := pals.MeasuredLength(func(plain []byte) (pals.Ciphertext, error) {
+		return pals.CTR{Plaintext: plain}.Encrypt(utils.FixedKey)
+	})
+	posterior, err = pals.LengthPosterior(candidates, nil, measured, len(candidates[3]))
+	if err != nil {
+		t.Errorf("LengthPosterior threw an error: %s", err)
+		return
+	}
+	if posterior[3] != 1 {
+		t.Errorf("LengthPosterior(CTR) gave %.2f to the only candidate of that length, want 1", posterior[3])
+	}
+
+	// random padding hides a single length, but not many of them
+	noisy := pals.RandomlyPadded(pals.StreamLength(), 15)
+	one, _ := pals.LengthPosterior(candidates, nil, noisy, len(candidates[3])+7)
+	many, _ := pals.LengthPosterior(candidates, nil, noisy, len(candidates[3])+7, len(candidates[3]), len(candidates[3])+15)
+	if one[3] >= many[3] || many[3] < 0.99 {
+		t.Errorf("LengthPosterior gave candidate 3 %.2f from one noisy length and %.2f from three", one[3], many[3])
+	}
+}
+
+func TestLengthLeakCountermeasure(t *testing.T) {
+	candidates := paddingOracleCandidates(t)
+	for _, model := range []struct {
+		name   string
+		m      pals.LengthModel
+		padded pals.LengthModel
+	}{
+		{"CBC", pals.CBCLength(aes.BlockSize), pals.Bucketed(pals.CBCLength(aes.BlockSize), 64)},
+		{"CTR", pals.StreamLength(), pals.Bucketed(pals.StreamLength(), 64)},
+		// padding before compression would just be compressed away, so pad the compressed text
+		{"compressed CTR", pals.Compressed(pals.StreamLength()), pals.Compressed(pals.Bucketed(pals.StreamLength(), 64))},
+	} {
+		leak, err := pals.MeasureLengthLeak(candidates, nil, model.m)
+		if err != nil {
+			t.Errorf("MeasureLengthLeak threw an error: %s", err)
+			return
+		}
+		padded, err := pals.MeasureLengthLeak(candidates, nil, model.padded)
+		if err != nil {
+			t.Errorf("MeasureLengthLeak threw an error: %s", err)
+			return
+		}
+		t.Logf("%s: %s; bucketed: %s", model.name, leak, padded)
+		if leak.LeakedBits <= 0 || leak.LeakedBits > leak.PriorBits+1e-9 {
+			t.Errorf("%s leaks %.2f of %.2f bits", model.name, leak.LeakedBits, leak.PriorBits)
+		}
+		if padded.LeakedBits >= leak.LeakedBits {
+			t.Errorf("padding %s to buckets leaks %.2f bits, no less than %.2f", model.name, padded.LeakedBits, leak.LeakedBits)
+		}
+	}
+	if _, err := pals.PadToBucket([]byte("attack at dawn"), 0); err == nil {
+		t.Errorf("PadToBucket accepted a bucket size of 0")
+	}
+}
@@ -0,0 +1,111 @@
+package sets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
+	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
+)
+
+func TestOracleStatsECBAppend(t *testing.T) {
+	parsed, err := utils.ParseBase64(Base64EncodedString)
+	if err != nil {
+		t.Errorf("ParseBase64(%q) threw an error: %s", Base64EncodedString, err)
+		return
+	}
+	stats := &pals.OracleStats{}
+	oracle := pals.EncryptionOracle{Encrypt: appendAndEncrypt(parsed), Mode: pals.ECBAppend, Stats: stats}
+	_, err = oracle.Decrypt()
+	if err != nil {
+		t.Errorf("oracle.Decrypt threw an error: %s", err)
+		return
+	}
+	// one map of 256 guesses plus the lookup for every byte of every block, and a little overhead
+	blocks := len(parsed)/16 + 2
+	if stats.Queries == 0 || stats.Queries > blocks*16*257+100 {
+		t.Errorf("DecryptECBAppend made %d queries, want at most %d", stats.Queries, blocks*16*257+100)
+	}
+	var bucketed int
+	for _, n := range stats.Histogram {
+		bucketed += n
+	}
+	if bucketed != stats.Queries {
+		t.Errorf("OracleStats histogram holds %d queries, want %d", bucketed, stats.Queries)
+	}
+}
+
+func TestOracleStatsBudget(t *testing.T) {
+	parsed, err := utils.ParseBase64(Base64EncodedString)
+	if err != nil {
+		t.Errorf("ParseBase64(%q) threw an error: %s", Base64EncodedString, err)
+		return
+	}
+	stats := &pals.OracleStats{Budget: 100}
+	oracle := pals.EncryptionOracle{Encrypt: appendAndEncrypt(parsed), Mode: pals.ECBAppend, Stats: stats}
+	_, err = oracle.Decrypt()
+	if !errors.Is(err, pals.ErrQueryBudgetExceeded) {
+		t.Errorf("oracle.Decrypt returned error %v, want %v", err, pals.ErrQueryBudgetExceeded)
+	}
+	if stats.Queries != 100 {
+		t.Errorf("OracleStats counted %d queries, want the budget of 100", stats.Queries)
+	}
+}
+
+func TestOracleStatsCBCPadding(t *testing.T) {
+	encrypt, iv, err := padAndEncryptFromSet()
+	if err != nil {
+		t.Errorf("padAndEncrypt(f) threw an error: %s", err)
+		return
+	}
+	var trace bytes.Buffer
+	stats := &pals.OracleStats{Trace: &trace}
+	oracle := pals.CBCPaddingOracle{IV: iv, Ciphertext: encrypt, ValidationFn: pals.GetValidationFnForOracle(utils.FixedKey), Stats: stats}
+	_, err = oracle.Decrypt()
+	if err != nil {
+		t.Errorf("oracle.Decrypt(f) threw an error: %s", err)
+		return
+	}
+	if stats.Queries > 256*len(encrypt) {
+		t.Errorf("DecryptCBCPadding made %d queries, want at most %d", stats.Queries, 256*len(encrypt))
+	}
+	if lines := bytes.Count(trace.Bytes(), []byte("\n")); lines != stats.Queries {
+		t.Errorf("OracleStats traced %d queries, want %d", lines, stats.Queries)
+	}
+}
+
+func TestOracleStatsRandomAccessCTR(t *testing.T) {
+	plain := []byte("a short secret for the edit oracle")
+	c, err := pals.CTR{Plaintext: plain}.Encrypt(utils.FixedKey)
+	if err != nil {
+		t.Errorf("CTR.Encrypt threw an error: %s", err)
+		return
+	}
+	stats := &pals.OracleStats{}
+	got, err := pals.BreakRandomAccessCTRContext(context.Background(), c, editFnForKey(utils.FixedKey), pals.AttackOptions{Stats: stats})
+	if err != nil {
+		t.Errorf("BreakRandomAccessCTRContext threw an error: %s", err)
+		return
+	}
+	if !bytes.Equal(got, plain) {
+		t.Errorf("BreakRandomAccessCTRContext got %q, want %q", got, plain)
+	}
+	if stats.Queries < len(plain) || stats.Queries > 256*len(plain) {
+		t.Errorf("BreakRandomAccessCTR made %d queries, want between %d and %d", stats.Queries, len(plain), 256*len(plain))
+	}
+}
+
+func TestOracleStatsKeyIV(t *testing.T) {
+	stats := &pals.OracleStats{}
+	oracle := pals.KeyIVOracle{Encrypt: encryptCBCWithKeyIV, Leaker: pals.LeakFromError(decryptCBCWithKeyIV), Blocksize: 16, Stats: stats}
+	if _, err := oracle.RecoverKey(); err != nil {
+		t.Errorf("RecoverKey threw an error: %s", err)
+		return
+	}
+	// one encryption and one forged message to the receiver
+	if stats.Queries != 2 {
+		t.Errorf("RecoverKey made %d queries, want 2", stats.Queries)
+	}
+}
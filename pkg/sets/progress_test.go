@@ -0,0 +1,81 @@
+package sets
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
+	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
+)
+
+func TestDecryptECBAppendCancellation(t *testing.T) {
+	parsed, err := utils.ParseBase64(Base64EncodedString)
+	if err != nil {
+		t.Errorf("ParseBase64(%q) threw an error: %s", Base64EncodedString, err)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopAfter := 20
+	opts := pals.AttackOptions{Progress: func(p pals.Progress) {
+		if p.BytesRecovered >= stopAfter {
+			cancel()
+		}
+	}}
+	oracle := pals.EncryptionOracle{Encrypt: appendAndEncrypt(parsed), Mode: pals.ECBAppend}
+	partial, err := oracle.DecryptECBAppendContext(ctx, opts)
+	if !errors.Is(err, pals.ErrInterrupted) || !errors.Is(err, context.Canceled) {
+		t.Errorf("DecryptECBAppendContext returned error %v, want an interruption by %v", err, context.Canceled)
+		return
+	}
+	if len(partial) != stopAfter || !strings.HasPrefix(string(parsed), string(partial)) {
+		t.Errorf("DecryptECBAppendContext returned partial result %q, want the first %d bytes of %q", partial, stopAfter, parsed)
+	}
+}
+
+func TestDecryptCBCPaddingProgress(t *testing.T) {
+	encrypt, iv, err := padAndEncryptFromSet()
+	if err != nil {
+		t.Errorf("padAndEncrypt(f) threw an error: %s", err)
+		return
+	}
+	var events []pals.Progress
+	opts := pals.AttackOptions{Progress: func(p pals.Progress) { events = append(events, p) }}
+	oracle := pals.CBCPaddingOracle{IV: iv, Ciphertext: encrypt, ValidationFn: pals.GetValidationFnForOracle(utils.FixedKey)}
+	_, err = oracle.DecryptCBCPaddingContext(context.Background(), opts)
+	if err != nil {
+		t.Errorf("DecryptCBCPaddingContext threw an error: %s", err)
+		return
+	}
+	if len(events) != len(encrypt) {
+		t.Errorf("DecryptCBCPaddingContext reported %d progress events, want one per byte (%d)", len(events), len(encrypt))
+		return
+	}
+	for i, p := range events {
+		if p.BytesRecovered != i+1 || p.BlocksTotal != len(encrypt)/16 {
+			t.Errorf("progress event %d was %+v, want %d bytes recovered of %d blocks", i, p, i+1, len(encrypt)/16)
+			return
+		}
+	}
+	if last := events[len(events)-1]; last.ETA != 0 || last.CandidatesTried == 0 {
+		t.Errorf("final progress event was %+v, want no time remaining and some candidates tried", last)
+	}
+}
+
+func TestRecoverMTSeedDeadline(t *testing.T) {
+	c, err := mersenneEncrypt(utils.FillByteSlice(20, 'A'), 65535)
+	if err != nil {
+		t.Errorf("mersenneEncrypt threw an error: %s", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	_, err = pals.RecoverMTSeedContext(ctx, c, utils.FillByteSlice(20, 'A'), pals.AttackOptions{})
+	if !errors.Is(err, pals.ErrInterrupted) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RecoverMTSeedContext returned error %v, want an interruption by %v", err, context.DeadlineExceeded)
+	}
+}
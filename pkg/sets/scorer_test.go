@@ -0,0 +1,259 @@
+package sets
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
+	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
+)
+
+var scorers = []struct {
+	name string
+	s    pals.Scorer
+}{
+	{"letterfrequency", pals.LetterFrequencyScorer},
+	{"chisquared", pals.ChiSquaredScorer{}},
+	{"bigrams", pals.EnglishBigrams()},
+	{"quadgrams", pals.EnglishQuadgrams()},
+	{"printable", pals.PrintableScorer{}},
+	{"dictionary", pals.EnglishWords()},
+}
+
+// shortSnippets cuts the Plaintexts of challenge 20 into pieces of n bytes
+func shortSnippets(t testing.TB, n int) [][]byte {
+	lines, err := utils.ScanFile("../../challenges/challenge20.txt")
+	if err != nil {
+		t.Fatalf("ScanFile threw an error: %s", err)
+	}
+	var snippets [][]byte
+	for _, l := range lines {
+		p, err := utils.ParseBase64(l)
+		if err != nil {
+			t.Fatalf("ParseBase64 threw an error: %s", err)
+		}
+		for i := 0; i+n <= len(p); i += n {
+			snippets = append(snippets, p[i:i+n])
+		}
+	}
+	return snippets
+}
+
+// singleByteXorAccuracy is the fraction of snippets whose single-byte XOR Key the scorer recovers
+func singleByteXorAccuracy(t testing.TB, s pals.Scorer, snippets [][]byte) float64 {
+	var correct int
+	for i, p := range snippets {
+		k := byte(i*37 + 1)
+		c, err := utils.SingleByteXor(p, k)
+		if err != nil {
+			t.Fatalf("SingleByteXor threw an error: %s", err)
+		}
+		got, _, err := pals.SolveSingleByteXorCipherWithScorer(c, s)
+		if err != nil {
+			t.Fatalf("SolveSingleByteXorCipherWithScorer threw an error: %s", err)
+		}
+		if bytes.Equal(got, p) {
+			correct++
+		}
+	}
+	return float64(correct) / float64(len(snippets))
+}
+
+func TestScorersOnShortInputs(t *testing.T) {
+	snippets := shortSnippets(t, 8)
+	accuracy := make(map[string]float64)
+	for _, sc := range scorers {
+		accuracy[sc.name] = singleByteXorAccuracy(t, sc.s, snippets)
+		t.Logf("%s: %.1f%% of %d snippets", sc.name, 100*accuracy[sc.name], len(snippets))
+	}
+	// chi-squared needs more text than this to say much, so only the n-gram models are expected to do better
+	for _, name := range []string{"bigrams", "quadgrams"} {
+		if accuracy[name] <= accuracy["letterfrequency"] {
+			t.Errorf("%s solved %.2f of short inputs, no better than the letter frequency score's %.2f", name, accuracy[name], accuracy["letterfrequency"])
+		}
+	}
+}
+
+func TestDecryptRepeatingKeyXorWithScorer(t *testing.T) {
+	lines, err := utils.ReadBase64File("../../challenges/challenge6.txt")
+	if err != nil {
+		t.Errorf("ReadBase64File threw an error: %s", err)
+		return
+	}
+	for _, sc := range scorers[:4] {
+		got, gotKey, err := pals.DecryptRepeatingKeyXorWithScorer(lines, sc.s)
+		if err != nil {
+			t.Errorf("DecryptRepeatingKeyXorWithScorer threw an error: %s", err)
+			return
+		}
+		if string(gotKey) != "Terminator X: Bring the noise" || string(got) != FunkyMusicUnpadded {
+			t.Errorf("DecryptRepeatingKeyXorWithScorer(%s) found the Key %q", sc.name, gotKey)
+		}
+	}
+}
+
+func TestNGramModelRoundTrip(t *testing.T) {
+	m, err := pals.TrainNGramModel([]byte(FunkyMusicUnpadded), 3)
+	if err != nil {
+		t.Errorf("TrainNGramModel threw an error: %s", err)
+		return
+	}
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Errorf("WriteTo threw an error: %s", err)
+		return
+	}
+	read, err := pals.ReadNGramModel(&buf)
+	if err != nil {
+		t.Errorf("ReadNGramModel threw an error: %s", err)
+		return
+	}
+	text := []byte("Play that funky music")
+	if read.N != 3 || len(read.Counts) != len(m.Counts) || read.Score(text) != m.Score(text) {
+		t.Errorf("ReadNGramModel read a %d-gram model of %d n-grams, want 3 and %d", read.N, len(read.Counts), len(m.Counts))
+	}
+	if m.Score(text) >= m.Score([]byte("Xqzj vkw gyfpb qomx")) {
+		t.Errorf("a model trained on the lyrics prefers gibberish to the lyrics")
+	}
+}
+
+func TestNGramModelPruneAfterScore(t *testing.T) {
+	m, err := pals.TrainNGramModel([]byte(FunkyMusicUnpadded), 3)
+	if err != nil {
+		t.Errorf("TrainNGramModel threw an error: %s", err)
+		return
+	}
+	fresh, _ := pals.TrainNGramModel([]byte(FunkyMusicUnpadded), 3)
+	text := []byte("Play that funky music")
+	m.Score(text)
+	m.Prune(2)
+	fresh.Prune(2)
+	if got, want := m.Score(text), fresh.Score(text); got != want {
+		t.Errorf("a model pruned after scoring scores %f, want %f as if pruned first", got, want)
+	}
+}
+
+func TestEmbeddedModelsAreNotShared(t *testing.T) {
+	text := []byte("Play that funky music")
+	want := pals.EnglishQuadgrams().Score(text)
+	m := pals.EnglishQuadgrams()
+	m.Prune(1e9)
+	m.UTF8 = true
+	if got := pals.EnglishQuadgrams().Score(text); got != want {
+		t.Errorf("after a caller pruned its model EnglishQuadgrams scores %f, want %f", got, want)
+	}
+	s, err := pals.ScorerByName("english")
+	if err != nil {
+		t.Errorf("ScorerByName threw an error: %s", err)
+		return
+	}
+	if got := s.Score(text); got != want {
+		t.Errorf("after a caller pruned its model ScorerByName(\"english\") scores %f, want %f", got, want)
+	}
+}
+
+func BenchmarkSingleByteXorScorers(b *testing.B) {
+	for _, n := range []int{8, 16, 32} {
+		snippets := shortSnippets(b, n)
+		for _, sc := range scorers {
+			b.Run(fmt.Sprintf("%s/%d", sc.name, n), func(b *testing.B) {
+				var accuracy float64
+				for i := 0; i < b.N; i++ {
+					accuracy = singleByteXorAccuracy(b, sc.s, snippets)
+				}
+				b.ReportMetric(100*accuracy, "%correct")
+			})
+		}
+	}
+}
+
+var languageSamples = map[string]string{
+	"german":  "Über die Brücke gingen wir langsam nach Hause, während es draußen schon dunkel wurde.",
+	"spanish": "El niño pequeño corrió por la calle mientras su madre le gritaba que volviera a casa.",
+	"french":  "Après le déjeuner, nous sommes allés à la bibliothèque pour étudier jusqu'à ce soir.",
+	"go":      "func (b *Buffer) Len() int {\n\treturn len(b.buf) - b.off\n}\n",
+	"json":    `{"name": "example", "version": "1.0.2", "private": true, "dependencies": {"left-pad": "^1.3.0"}}`,
+	"base64":  "U29tZSBzZWNyZXQgZGF0YSB0aGF0IHdhcyBlbmNvZGVkIGJlZm9yZSBlbmNyeXB0aW9u",
+}
+
+func TestScorerByName(t *testing.T) {
+	for name, sample := range languageSamples {
+		c, err := utils.SingleByteXor([]byte(sample), 0x5c)
+		if err != nil {
+			t.Errorf("SingleByteXor threw an error: %s", err)
+			return
+		}
+		got, key, err := pals.SolveSingleByteXorCipherWithModel(c, name)
+		if err != nil {
+			t.Errorf("SolveSingleByteXorCipherWithModel(%s) threw an error: %s", name, err)
+			continue
+		}
+		if string(got) != sample {
+			t.Errorf("SolveSingleByteXorCipherWithModel(%s) found the Key %x, want 5c", name, key)
+		}
+		legacy, _, _ := pals.SolveSingleByteXorCipher(c)
+		t.Logf("%s: letter frequency score solved it: %v", name, string(legacy) == sample)
+	}
+	if _, err := pals.ScorerByName("klingon"); err == nil {
+		t.Errorf("ScorerByName accepted a model that doesn't exist")
+	}
+	for _, name := range pals.Models() {
+		if _, err := pals.ScorerByName(name); err != nil {
+			t.Errorf("ScorerByName(%q) threw an error: %s", name, err)
+		}
+	}
+}
+
+// the top n-grams of a language model should be words, not the decoration of its training text
+func TestLanguageModelTopNGrams(t *testing.T) {
+	for _, name := range []string{"english", "german", "french", "spanish"} {
+		s, err := pals.ScorerByName(name)
+		if err != nil {
+			t.Errorf("ScorerByName(%q) threw an error: %s", name, err)
+			continue
+		}
+		m, ok := s.(*pals.NGramModel)
+		if !ok {
+			t.Errorf("ScorerByName(%q) is a %T, not an NGramModel", name, s)
+			continue
+		}
+		grams := make([]string, 0, len(m.Counts))
+		for g := range m.Counts {
+			grams = append(grams, g)
+		}
+		sort.Slice(grams, func(i, j int) bool {
+			return m.Counts[grams[i]] > m.Counts[grams[j]]
+		})
+		for _, g := range grams[:5] {
+			for _, b := range []byte(g) {
+				// bytes of 0x80 and up are part of a UTF-8 letter such as é
+				if !(b == ' ' || (b|0x20 >= 'a' && b|0x20 <= 'z') || b >= 0x80) {
+					t.Errorf("%s model's top n-gram %q (%g) is not letters or space", name, g, m.Counts[g])
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestDecryptRepeatingKeyXorGerman(t *testing.T) {
+	plain := strings.Repeat(languageSamples["german"]+" Die Straßen waren leer, und nur ein alter Hund lief uns hinterher, bis wir die Tür öffneten. ", 3)
+	key := []byte("Schlüssel")
+	c, err := pals.RepeatingKeyXorBytes([]byte(plain), key)
+	if err != nil {
+		t.Errorf("RepeatingKeyXorBytes threw an error: %s", err)
+		return
+	}
+	got, gotKey, err := pals.DecryptRepeatingKeyXorWithModel(c, "german")
+	if err != nil {
+		t.Errorf("DecryptRepeatingKeyXorWithModel threw an error: %s", err)
+		return
+	}
+	// a Key guessed at a multiple of its length decrypts just as well
+	if len(gotKey)%len(key) != 0 || !bytes.Equal(gotKey, pals.RepeatBytesToLegnth(key, len(gotKey))) || string(got) != plain {
+		t.Errorf("DecryptRepeatingKeyXorWithModel(german) found the Key %q, want %q", gotKey, key)
+	}
+}
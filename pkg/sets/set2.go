@@ -185,3 +185,21 @@ func modifyCiphertextForAdmin(Ciphertext []byte) ([]byte, error) {
 	chunks[chunkToFlip] = flippedCiphertext
 	return bytes.Join(chunks, nil), nil
 }
+
+// learnProfiles builds a Codebook from the profiles of the given emails, whose Plaintext the attacker can work out
+func learnProfiles(emails []string) (*pals.Codebook, error) {
+	cb, err := pals.NewCodebook(aes.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+	for _, email := range emails {
+		c, err := encryptedProfileFor([]byte(email))
+		if err != nil {
+			return nil, err
+		}
+		if err := cb.Learn(pals.Plaintext(profileFor([]byte(email)).encode()), c); err != nil {
+			return nil, err
+		}
+	}
+	return cb, nil
+}
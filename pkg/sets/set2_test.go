@@ -2,7 +2,10 @@ package sets
 
 import (
 	"crypto/aes"
+	"crypto/des"
+	"fmt"
 	"math/rand"
+	"strings"
 	"testing"
 	"time"
 
@@ -118,6 +121,21 @@ func TestDecryptOracle(t *testing.T) {
 		t.Errorf("DecryptOracle(f) returned incorrect Plaintext: got:\n %q \n want \n %q", Plaintext, want)
 	}
 }
+
+// a secret shorter than a block leaves the guesses for its later bytes a block short of the one being read
+func TestDecryptOracleShortSecret(t *testing.T) {
+	for _, secret := range []string{"N", "Now t", "Now that the p"} {
+		oracle := pals.EncryptionOracle{Encrypt: appendAndEncrypt([]byte(secret)), Mode: pals.ECBAppend}
+		Plaintext, err := oracle.Decrypt()
+		if err != nil {
+			t.Errorf("DecryptOracle(f) threw an error: %s", err)
+			continue
+		}
+		if string(Plaintext) != secret {
+			t.Errorf("DecryptOracle(f) returned incorrect Plaintext: got %q, want %q", Plaintext, secret)
+		}
+	}
+}
 func TestParseCookie(t *testing.T) {
 	in := "foo=bar&baz=qux&zap=zazzle"
 	got := parseCookie(in)
@@ -243,3 +261,144 @@ func TestCBCBitflipping(t *testing.T) {
 		t.Errorf("DetectAdminString incorrectly missed the admin string for: %s", in)
 	}
 }
+
+func TestECBCodebook(t *testing.T) {
+	victims := []string{"alice@example.com", "bob@example.com", "carol@example.com", "alice@example.com", "dave@elsewhere.org"}
+	var corpus []pals.Ciphertext
+	for _, v := range victims {
+		c, err := encryptedProfileFor([]byte(v))
+		if err != nil {
+			t.Errorf("encryptedProfileFor threw an error: %s", err)
+			return
+		}
+		corpus = append(corpus, c)
+	}
+	// every alignment of the fixed tail, and of a guessed domain
+	var emails []string
+	for n := 0; n < aes.BlockSize; n++ {
+		emails = append(emails, string(getBytesOfLen(n)), string(getBytesOfLen(n))+"@example.com")
+	}
+	cb, err := learnProfiles(emails)
+	if err != nil {
+		t.Errorf("learnProfiles threw an error: %s", err)
+		return
+	}
+	decrypted, err := cb.DecryptAll(corpus)
+	if err != nil {
+		t.Errorf("DecryptAll threw an error: %s", err)
+		return
+	}
+	for i, d := range decrypted {
+		want := padding.PKCSPadding([]byte(profileFor([]byte(victims[i])).encode()), aes.BlockSize)
+		for j, b := range d.Blocks {
+			if b != nil && string(b) != string(want[j*aes.BlockSize:(j+1)*aes.BlockSize]) {
+				t.Errorf("block %d of %q decrypted to %q", j, victims[i], b)
+			}
+		}
+		if d.Blocks[len(d.Blocks)-1] == nil {
+			t.Errorf("the last block of %q was not decrypted: %s", victims[i], d)
+		}
+		// only the block holding the name is unknown to the attacker
+		if strings.HasSuffix(victims[i], "@example.com") && d.Known() != len(d.Blocks)-1 {
+			t.Errorf("decrypted %d of %d blocks of %q: %s", d.Known(), len(d.Blocks), victims[i], d)
+		}
+	}
+
+	stats := cb.BlockStats(corpus)
+	var unknown *pals.BlockFrequency
+	for i := range stats {
+		if stats[i].Plaintext == nil {
+			unknown = &stats[i]
+			break
+		}
+	}
+	// alice appears twice, so her name block is the most frequent unknown
+	if unknown == nil || unknown.Count != 2 || unknown.Messages != 2 || unknown.Positions[0] != 0 {
+		t.Errorf("BlockStats got the most frequent unknown block %+v", unknown)
+		return
+	}
+	if err := cb.Add(unknown.Block, []byte("email=alice@exam")); err != nil {
+		t.Errorf("Add threw an error: %s", err)
+	}
+	if d, _ := cb.Decrypt(corpus[0]); !d.Complete() {
+		t.Errorf("a guessed block did not complete %s", d)
+	}
+	if _, err := pals.NewCodebook(0); err == nil {
+		t.Errorf("NewCodebook accepted a block size of 0")
+	}
+
+	c, err := encryptedProfileFor([]byte("AAAA"))
+	if err != nil {
+		t.Errorf("encryptedProfileFor threw an error: %s", err)
+		return
+	}
+	if err := cb.Learn(pals.Plaintext("email=AAAA&uid=10&role=admin"), c); err == nil {
+		t.Errorf("Learn accepted a pair that conflicts with the codebook")
+	}
+}
+
+func TestECBColumnFrequencyAttack(t *testing.T) {
+	aux, err := pals.ReadDistribution("testdata/countries.csv")
+	if err != nil {
+		t.Errorf("ReadDistribution threw an error: %s", err)
+		return
+	}
+	column, truth, err := pals.SimulateColumn(aux, 20000, utils.FixedKey, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Errorf("SimulateColumn threw an error: %s", err)
+		return
+	}
+	var csv strings.Builder
+	csv.WriteString("id,country\n")
+	for i, c := range column {
+		fmt.Fprintf(&csv, "%d,%x\n", i, c)
+	}
+	read, err := pals.ReadEncryptedColumn(strings.NewReader(csv.String()), "country")
+	if err != nil {
+		t.Errorf("ReadEncryptedColumn threw an error: %s", err)
+		return
+	}
+	r := pals.FrequencyAttack(read, aux, aes.BlockSize)
+	acc := pals.MeasureColumnAccuracy(r, read, truth)
+	t.Log(acc)
+	// close populations swap ranks by chance, but well separated values and those alone at their length don't
+	if acc.RowRate() < 0.7 {
+		t.Errorf("FrequencyAttack recovered %s", acc)
+	}
+	for _, country := range []string{"Indonesia", "United States of America", "Russian Federation", "Democratic Republic of the Congo"} {
+		c, err := pals.NewAESECB(pals.Plaintext(country)).Encrypt(utils.FixedKey)
+		if err != nil {
+			t.Errorf("Encrypt threw an error: %s", err)
+			return
+		}
+		if got, _ := r.Decrypt(c); string(got) != country {
+			t.Errorf("FrequencyAttack decrypted %q as %q", country, got)
+		}
+	}
+}
+
+// with 8 byte blocks, a 5 and a 9 letter country pad to different lengths, and can't be confused
+func TestECBColumnFrequencyAttackBlocksize(t *testing.T) {
+	block, err := des.NewCipher([]byte("8BYTEKEY"))
+	if err != nil {
+		t.Errorf("des.NewCipher threw an error: %s", err)
+		return
+	}
+	encrypt := func(v string) pals.Ciphertext {
+		p := padding.PKCSPadding([]byte(v), des.BlockSize)
+		c := make([]byte, len(p))
+		for i := 0; i < len(p); i += des.BlockSize {
+			block.Encrypt(c[i:], p[i:])
+		}
+		return c
+	}
+	aux := pals.Distribution{"India": 1428, "Indonesia": 277}
+	// the column is skewed against the public distribution, so ranks would pair the values up wrong
+	column := []pals.Ciphertext{encrypt("India"), encrypt("Indonesia"), encrypt("Indonesia")}
+	r := pals.FrequencyAttack(column, aux, des.BlockSize)
+	for _, country := range []string{"India", "Indonesia"} {
+		if got, _ := r.Decrypt(encrypt(country)); string(got) != country {
+			t.Errorf("FrequencyAttack decrypted %q as %q with 8 byte blocks", country, got)
+		}
+	}
+}
@@ -3,7 +3,6 @@ package sets
 import (
 	"bytes"
 	"crypto/rand"
-	"encoding/binary"
 	"fmt"
 	mathRand "math/rand"
 	"regexp"
@@ -184,6 +183,84 @@ func TestBreakCTRStatistically(t *testing.T) {
 	}
 }
 
+func TestBreakFixedNonceCTR(t *testing.T) {
+	filename := "../../challenges/challenge20.txt"
+	lines, err := utils.ScanFile(filename)
+	if err != nil {
+		t.Errorf("ScanFile threw an error: %s", err)
+		return
+	}
+	key := utils.GenerateKey()
+	var plaintexts [][]byte
+	var ciphertexts []pals.Ciphertext
+	for _, line := range lines {
+		decoded, err := utils.ParseBase64(line)
+		if err != nil {
+			t.Errorf("ParseBase64(%q) threw an error: %s", filename, err)
+			return
+		}
+		c, err := pals.CTR{Plaintext: decoded}.Encrypt(key)
+		if err != nil {
+			t.Errorf("Encrypt(%q) threw an error: %s", filename, err)
+			return
+		}
+		plaintexts = append(plaintexts, decoded)
+		ciphertexts = append(ciphertexts, c)
+	}
+	// line 26 is the longest, and ends in "observe the whole scenery"
+	crib := pals.Crib{Index: 26, Offset: 93, Text: []byte("observe the whole scenery")}
+	got, err := pals.BreakFixedNonceCTR(ciphertexts, pals.FixedNonceOptions{Refine: true, Cribs: []pals.Crib{crib}})
+	if err != nil {
+		t.Errorf("BreakFixedNonceCTR threw an error: %s", err)
+		return
+	}
+	quadgrams, err := pals.BreakFixedNonceCTR(ciphertexts, pals.FixedNonceOptions{Refine: true, Scorer: pals.EnglishQuadgrams()})
+	if err != nil {
+		t.Errorf("BreakFixedNonceCTR threw an error: %s", err)
+		return
+	}
+	var covered, correct, correctQuadgrams int
+	for i, p := range plaintexts {
+		for j := range p {
+			if len(column(plaintexts, j)) < 5 {
+				continue
+			}
+			covered++
+			if got.Plaintexts[i][j] == p[j] {
+				correct++
+			}
+			if quadgrams.Plaintexts[i][j] == p[j] {
+				correctQuadgrams++
+			}
+		}
+	}
+	// well past the length of the shortest line, every column covered by a handful of lines should come out right
+	if float64(correct) < 0.98*float64(covered) {
+		t.Errorf("BreakFixedNonceCTR recovered %d of %d bytes in well-covered columns, want 98%%", correct, covered)
+	}
+	if float64(correctQuadgrams) < 0.98*float64(covered) {
+		t.Errorf("BreakFixedNonceCTR with the quadgram model recovered %d of %d bytes in well-covered columns, want 98%%", correctQuadgrams, covered)
+	}
+	if !strings.HasSuffix(string(got.Plaintexts[26]), string(crib.Text)) || got.Confidence[117] != 1 {
+		t.Errorf("BreakFixedNonceCTR ignored the crib: %q", got.Plaintexts[26])
+	}
+	// the crib reveals the Keystream under the end of the second longest line as well
+	if want := plaintexts[46][93:]; !strings.HasSuffix(string(got.Plaintexts[46]), string(want)) {
+		t.Errorf("BreakFixedNonceCTR didn't extend the crib to other lines: got %q, want it to end in %q", got.Plaintexts[46], want)
+	}
+}
+
+// column returns byte i of every line long enough to have one
+func column(lines [][]byte, i int) []byte {
+	var col []byte
+	for _, l := range lines {
+		if len(l) > i {
+			col = append(col, l[i])
+		}
+	}
+	return col
+}
+
 func TestImplementMersenneTwisterRNG(t *testing.T) {
 	m := mersenne.New()
 	unseededSum := 0
@@ -278,7 +355,6 @@ func TestMT19937Encryption(t *testing.T) {
 }
 
 func TestBreakMT19937Encryption(t *testing.T) {
-	const MersenneSeedSpace = 65536
 	base := bytes.Repeat(utils.ByteA, 14)
 	randomBytes := make([]byte, mathRand.Intn(5)+5)
 	_, err := rand.Read(randomBytes)
@@ -286,40 +362,21 @@ func TestBreakMT19937Encryption(t *testing.T) {
 		t.Errorf("rand.Read threw an error: %s", err)
 		return
 	}
-
-	c, err := mersenneEncrypt(append(randomBytes, base...), uint16(mathRand.Intn(MersenneSeedSpace)))
+	seed := uint16(mathRand.Intn(pals.MTSeedSpace))
+	c, err := mersenneEncrypt(append(randomBytes, base...), seed)
 	if err != nil {
 		t.Errorf("encryptMT threw an error: %s", err)
 		return
 	}
 
-	randomByteCount := len(c) - len(base)
-	merseeneValueSlice := utils.FlexibleXor(c[randomByteCount:len(c)], base)
-	var success bool
-
-	// try all the possible Keys until we find one that generates the known sequence in merseeneValueSlice
-	for i := 0; i < MersenneSeedSpace; i++ {
-		m := mersenne.New()
-		m.Seed(i)
-
-		size := len(c) / pals.MersenneStreamBlockSize
-		if len(c)%pals.MersenneStreamBlockSize > 0 {
-			size++
-		}
-
-		comparison := make([]byte, size*pals.MersenneStreamBlockSize)
-		numbersNeeded := size * pals.MersenneStreamBlockSize / mersenneNumberBytes
-
-		for i := 0; i < numbersNeeded; i++ {
-			binary.LittleEndian.PutUint32(comparison[(i*mersenneNumberBytes):], m.Uint32())
-		}
-		if string(merseeneValueSlice) == string(comparison[randomByteCount:len(c)]) {
-			success = true
-			break
-		}
+	// try all the possible Keys until we find one that generates the known sequence at the end of the Ciphertext
+	key, err := pals.RecoverMTSeed(c, base)
+	if err != nil {
+		t.Errorf("RecoverMTSeed threw an error: %s", err)
+		return
 	}
-	if !success {
-		t.Errorf("Key not found!\n")
+	if string(key) != string(pals.KeyForMTSeed(seed)) {
+		t.Errorf("RecoverMTSeed found Key %v, want %v", key, pals.KeyForMTSeed(seed))
 	}
 }
 
@@ -329,19 +386,17 @@ func tokenOracle() (pals.Ciphertext, error) {
 }
 
 func isTokenForRecentTime(token string) (bool, error) {
-	now := int(time.Now().Unix())
+	now := time.Now().Unix()
 	sampleText := bytes.Repeat(utils.ByteA, len(token)) // we know the oracle is just encrypting byteA repeated
 	window := 10 * 60                                   // check the last 10 minutes
-	for i := now; i > now-window; i-- {
-		c, err := mersenneEncrypt(sampleText, uint16(i))
-		if err != nil {
-			return false, err
-		}
-		if string(c) == token {
-			return true, nil
-		}
+	_, err := pals.RecoverMTTimeSeed(pals.Ciphertext(token), sampleText, now, window)
+	if err == pals.ErrSeedNotFound {
+		return false, nil
 	}
-	return false, nil
+	if err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 func TestGeneratePasswordResetToken(t *testing.T) {
@@ -360,3 +415,49 @@ func TestGeneratePasswordResetToken(t *testing.T) {
 		t.Errorf("Password Reset Token not identified.")
 	}
 }
+
+func TestBEASTChainedIV(t *testing.T) {
+	s, err := pals.NewCBCSession(utils.FixedKey)
+	if err != nil {
+		t.Errorf("NewCBCSession threw an error: %s", err)
+		return
+	}
+	secret, err := beastOracle(s).Decrypt()
+	if err != nil {
+		t.Errorf("BEASTOracle.Decrypt threw an error: %s", err)
+		return
+	}
+	if string(secret) != beastSecret {
+		t.Errorf("BEASTOracle.Decrypt = %q, want %q", secret, beastSecret)
+	}
+}
+
+func TestDetectPredictableIVs(t *testing.T) {
+	s, err := pals.NewCBCSession(utils.FixedKey)
+	if err != nil {
+		t.Errorf("NewCBCSession threw an error: %s", err)
+		return
+	}
+	var chained, random []pals.CBCRecord
+	for i := 0; i < 5; i++ {
+		c, iv, err := s.Encrypt([]byte("record"))
+		if err != nil {
+			t.Errorf("Encrypt threw an error: %s", err)
+			return
+		}
+		chained = append(chained, pals.CBCRecord{IV: iv, Ciphertext: c})
+		cbc := pals.AES_CBC{Plaintext: []byte("record")}
+		c, err = cbc.Encrypt(utils.FixedKey)
+		if err != nil {
+			t.Errorf("Encrypt threw an error: %s", err)
+			return
+		}
+		random = append(random, pals.CBCRecord{IV: cbc.IV, Ciphertext: c})
+	}
+	if r := pals.DetectPredictableIVs(chained); r.Chained != 4 || !r.Predictable() {
+		t.Errorf("DetectPredictableIVs(chained) = %s, want 4 chained IVs", r)
+	}
+	if r := pals.DetectPredictableIVs(random); r.Predictable() {
+		t.Errorf("DetectPredictableIVs(random) = %s, want no predictable IVs", r)
+	}
+}
@@ -1,30 +1,19 @@
 package sets
 
 import (
-	"fmt"
-
 	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
 	"github.com/nadavoosh/go_crypto_pals/pkg/sha1"
 	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
 )
 
 func breakRandomAccessReadWriteAESCTR(c pals.Ciphertext, key pals.Key) (pals.Plaintext, error) {
-	var p pals.Plaintext
-	for offset := 0; offset < len(c); offset++ {
-		for i := 0; i < 256; i++ {
-			ciphertextCopy := make([]byte, len(c))
-			_ = copy(ciphertextCopy, c)
-			newCiphertext, err := pals.EditCTR(ciphertextCopy, key, []byte{byte(i)}, offset)
-			if err != nil {
-				return nil, err
-			}
-			if c[offset] == newCiphertext[offset] {
-				p = append(p, byte(i))
-				break
-			}
-		}
+	return pals.BreakRandomAccessCTR(c, editFnForKey(key))
+}
+
+func editFnForKey(key pals.Key) pals.EditFn {
+	return func(ciphertext pals.Ciphertext, newtext pals.Plaintext, offset int) (pals.Ciphertext, error) {
+		return pals.EditCTR(ciphertext, key, newtext, offset)
 	}
-	return p, nil
 }
 
 func encryptUserDataCTR(input []byte) (pals.Ciphertext, error) {
@@ -46,6 +35,16 @@ func detectAdminStringCTR(e pals.Ciphertext) (bool, error) {
 	return detectAdminString(plain), nil
 }
 
+// parsesUserDataCTR decrypts and only reports whether the result still parses as key=value pairs
+func parsesUserDataCTR(e, _ []byte) (bool, error) {
+	a := pals.CTR{Ciphertext: e}
+	plain, err := a.Decrypt(utils.FixedKey)
+	if err != nil {
+		return false, err
+	}
+	return pals.KeyValuePredicate.Valid(plain), nil
+}
+
 func encryptCBCWithKeyIV(input []byte) (pals.Ciphertext, error) {
 	d := pals.AES_CBC{Plaintext: input}
 	c, err := d.EncryptWithKeyIV(utils.FixedKey)
@@ -56,7 +55,7 @@ func decryptCBCWithKeyIV(e pals.Ciphertext) (pals.Plaintext, error) {
 	d := pals.AES_CBC{Ciphertext: e}
 	c, err := d.DecryptWithKeyIV(utils.FixedKey)
 	if !utils.IsAllAscii(c) {
-		return nil, fmt.Errorf("Error, invalid values found in user input: %s", c)
+		return nil, &pals.InvalidPlaintextError{Plaintext: c}
 	}
 	return c, err
 }
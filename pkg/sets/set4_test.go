@@ -2,11 +2,13 @@ package sets
 
 import (
 	"bytes"
+	"crypto/cipher"
+	"crypto/des"
 	// "fmt"
-	"regexp"
 	"strings"
 	"testing"
 
+	"github.com/nadavoosh/go_crypto_pals/pkg/padding"
 	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
 	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
 )
@@ -63,32 +65,92 @@ func TestCTRBitflipping(t *testing.T) {
 }
 
 func TestKeyRecoveryfromCBCwithIVEqualToKey(t *testing.T) {
-	data := []byte("NADAVRECCANADAVRECCANADAVRECCA")
-	c, err := encryptCBCWithKeyIV(data)
+	oracle := pals.KeyIVOracle{Encrypt: encryptCBCWithKeyIV, Leaker: pals.LeakFromError(decryptCBCWithKeyIV)}
+	key, err := oracle.RecoverKey()
 	if err != nil {
-		t.Errorf("encryptUserDataCBCWithKeyIV threw an error: %s", err)
+		t.Errorf("RecoverKey threw an error: %s", err)
 		return
 	}
-	blocksize := 16
-	// Modify the message (you are now the attacker):
-	// C_1, C_2, C_3 -> C_1, 0, C_1
-	attackerMessage := append(append(c[:blocksize], bytes.Repeat([]byte{0}, blocksize)...), c[:blocksize]...)
-	// Decrypt the message (you are now the receiver) and raise the appropriate error if high-ASCII is found
-	_, err = decryptCBCWithKeyIV(attackerMessage)
-	if err == nil {
-		t.Errorf("SkipTestKeyRecoveryfromCBCwithIVEqualToKey didn't work")
-	}
-	re1 := regexp.MustCompile(`Error, invalid values found in user input: (.*?)$`)
-	result_slice := re1.FindStringSubmatch(err.Error())
-	// P'_1 XOR P'_3
-	res := []byte(result_slice[1])
-	key, err := utils.FixedXor(res[:blocksize], res[blocksize*2:blocksize*3])
+	if string(key) != string(utils.FixedKey) {
+		t.Errorf("TestKeyRecoveryfromCBCwithIVEqualToKey didn't work")
+	}
+}
+
+func TestDetectKeyAsIV(t *testing.T) {
+	oracle := pals.KeyIVOracle{Encrypt: encryptCBCWithKeyIV, Leaker: pals.LeakFromError(decryptCBCWithKeyIV)}
+	isKeyIV, err := oracle.DetectKeyAsIV()
 	if err != nil {
-		t.Errorf("utils.FixedXor threw an error: %s", err)
+		t.Errorf("DetectKeyAsIV threw an error: %s", err)
 		return
 	}
-	if string(key) != string(utils.FixedKey) {
-		t.Errorf("SkipTestKeyRecoveryfromCBCwithIVEqualToKey didn't work")
+	if !isKeyIV {
+		t.Errorf("DetectKeyAsIV missed a Key=IV sender")
+	}
+	randomIV := func(input []byte) (pals.Ciphertext, error) {
+		d := pals.AES_CBC{Plaintext: input}
+		return d.Encrypt(utils.FixedKey)
+	}
+	oracle.Encrypt = randomIV
+	isKeyIV, err = oracle.DetectKeyAsIV()
+	if err != nil {
+		t.Errorf("DetectKeyAsIV threw an error: %s", err)
+		return
+	}
+	if isKeyIV {
+		t.Errorf("DetectKeyAsIV flagged a random IV sender")
+	}
+	d := pals.AES_CBC{Plaintext: []byte("NADAVRECCA")}
+	if _, err := d.EncryptWithKeyIV(utils.FixedKey); err != nil || !d.UsesKeyAsIV(utils.FixedKey) {
+		t.Errorf("UsesKeyAsIV missed an AES_CBC set up by EncryptWithKeyIV")
+	}
+}
+
+func TestKeyRecoveryfromDESCBCwithIVEqualToKey(t *testing.T) {
+	key := []byte("8BYTEKEY")
+	block, err := des.NewCipher(key)
+	if err != nil {
+		t.Errorf("des.NewCipher threw an error: %s", err)
+		return
+	}
+	encrypt := func(input []byte) (pals.Ciphertext, error) {
+		p := padding.PKCSPadding(append([]byte{}, input...), des.BlockSize)
+		c := make([]byte, len(p))
+		cipher.NewCBCEncrypter(block, key).CryptBlocks(c, p)
+		return c, nil
+	}
+	leak := pals.LeakFn(func(c pals.Ciphertext) (pals.Plaintext, error) {
+		p := make([]byte, len(c))
+		cipher.NewCBCDecrypter(block, key).CryptBlocks(p, c)
+		if !utils.IsAllAscii(p) {
+			return p, nil
+		}
+		return nil, nil
+	})
+	// re-encrypt under the recovered Key, as the IV too, and compare with what the sender sent
+	verify := func(k pals.Key, plain pals.Plaintext, c pals.Ciphertext) bool {
+		b, err := des.NewCipher(k)
+		if err != nil {
+			return false
+		}
+		p := padding.PKCSPadding(append([]byte{}, plain...), des.BlockSize)
+		if len(p) != len(c) {
+			return false
+		}
+		got := make([]byte, len(p))
+		cipher.NewCBCEncrypter(b, k).CryptBlocks(got, p)
+		return bytes.Equal(got, c)
+	}
+	oracle := pals.KeyIVOracle{Encrypt: encrypt, Leaker: leak, Verify: verify}
+	got, err := oracle.RecoverKey()
+	if err != nil {
+		t.Errorf("RecoverKey threw an error: %s", err)
+		return
+	}
+	if string(got) != string(key) {
+		t.Errorf("RecoverKey returned %q, want %q", got, key)
+	}
+	if isKeyIV, err := oracle.DetectKeyAsIV(); err != nil || !isKeyIV {
+		t.Errorf("DetectKeyAsIV returned %t, %v for a DES Key=IV sender", isKeyIV, err)
 	}
 }
 
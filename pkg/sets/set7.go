@@ -0,0 +1,245 @@
+package sets
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
+	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
+)
+
+// transferServer is the money-transfer API, which shares a Key with its client
+type transferServer struct {
+	key      pals.Key
+	balances map[int]int
+}
+
+func newTransferServer(key pals.Key, balances map[int]int) *transferServer {
+	return &transferServer{key: key, balances: balances}
+}
+
+// transferClient signs requests, but only ever from its own account
+type transferClient struct {
+	key  pals.Key
+	from int
+}
+
+type transaction struct {
+	to     int
+	amount int
+}
+
+func (c transferClient) transferRequest(to, amount int) ([]byte, error) {
+	msg := []byte(fmt.Sprintf("from=%d&to=%d&amount=%d", c.from, to, amount))
+	iv, err := utils.GenerateRandomBlock()
+	if err != nil {
+		return nil, err
+	}
+	mac, err := pals.CBCMAC(c.key, iv, msg)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(msg, iv...), mac...), nil
+}
+
+func (c transferClient) multiTransferRequest(txs []transaction) ([]byte, error) {
+	var list []string
+	for _, tx := range txs {
+		list = append(list, fmt.Sprintf("%d:%d", tx.to, tx.amount))
+	}
+	msg := []byte(fmt.Sprintf("from=%d&tx_list=%s", c.from, strings.Join(list, ";")))
+	mac, err := pals.CBCMAC(c.key, nil, msg)
+	if err != nil {
+		return nil, err
+	}
+	return append(msg, mac...), nil
+}
+
+// transfer handles a message || IV || MAC request
+func (s *transferServer) transfer(req []byte) error {
+	if len(req) < 2*aes.BlockSize {
+		return fmt.Errorf("request too short")
+	}
+	msg := req[:len(req)-2*aes.BlockSize]
+	iv := req[len(req)-2*aes.BlockSize : len(req)-aes.BlockSize]
+	mac := req[len(req)-aes.BlockSize:]
+	if ok, err := pals.VerifyCBCMAC(s.key, iv, msg, mac); err != nil || !ok {
+		return fmt.Errorf("invalid MAC")
+	}
+	fields := parseQuery(msg)
+	from, err := strconv.Atoi(fields["from"])
+	if err != nil {
+		return err
+	}
+	to, err := strconv.Atoi(fields["to"])
+	if err != nil {
+		return err
+	}
+	amount, err := strconv.Atoi(fields["amount"])
+	if err != nil {
+		return err
+	}
+	s.move(from, to, amount)
+	return nil
+}
+
+// multiTransfer handles a message || MAC request, signed under a fixed IV.
+// Like many real parsers, it skips transactions it cannot make sense of.
+func (s *transferServer) multiTransfer(req []byte) error {
+	if len(req) < aes.BlockSize {
+		return fmt.Errorf("request too short")
+	}
+	msg := req[:len(req)-aes.BlockSize]
+	mac := req[len(req)-aes.BlockSize:]
+	if ok, err := pals.VerifyCBCMAC(s.key, nil, msg, mac); err != nil || !ok {
+		return fmt.Errorf("invalid MAC")
+	}
+	// the transaction list runs to the end of the message
+	parts := strings.SplitN(string(msg), "&tx_list=", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "from=") {
+		return fmt.Errorf("malformed request")
+	}
+	from, err := strconv.Atoi(strings.TrimPrefix(parts[0], "from="))
+	if err != nil {
+		return err
+	}
+	for _, tx := range strings.Split(parts[1], ";") {
+		parts := strings.Split(tx, ":")
+		if len(parts) != 2 {
+			continue
+		}
+		to, err := strconv.Atoi(parts[0])
+		if err != nil {
+			continue
+		}
+		amount, err := strconv.Atoi(parts[1])
+		if err != nil {
+			continue
+		}
+		s.move(from, to, amount)
+	}
+	return nil
+}
+
+func (s *transferServer) move(from, to, amount int) {
+	s.balances[from] -= amount
+	s.balances[to] += amount
+}
+
+// parseQuery splits a&b=c style messages, keeping the first value of each key
+func parseQuery(msg []byte) map[string]string {
+	fields := map[string]string{}
+	for _, kv := range strings.Split(string(msg), "&") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if _, ok := fields[parts[0]]; !ok {
+			fields[parts[0]] = parts[1]
+		}
+	}
+	return fields
+}
+
+// forgeTransferFrom rewrites the sender of a request the attacker signed for themselves, fixing up the IV
+func forgeTransferFrom(req []byte, victim int) ([]byte, error) {
+	msg := req[:len(req)-2*aes.BlockSize]
+	iv := req[len(req)-2*aes.BlockSize : len(req)-aes.BlockSize]
+	mac := req[len(req)-aes.BlockSize:]
+	fields := parseQuery(msg)
+	forged := bytes.Replace(msg, []byte("from="+fields["from"]), []byte(fmt.Sprintf("from=%d", victim)), 1)
+	forgedIV, err := pals.ForgeCBCMACIV(msg, iv, forged)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(forged, forgedIV...), mac...), nil
+}
+
+// forgeMultiTransfer appends a transfer to the attacker onto a captured request from the victim,
+// using a request the attacker signed for themselves
+func forgeMultiTransfer(captured []byte, attacker transferClient, amount int) ([]byte, error) {
+	msg := captured[:len(captured)-aes.BlockSize]
+	mac := captured[len(captured)-aes.BlockSize:]
+	// the first block of the attacker's own request turns to glue, and the transaction it starts is
+	// skipped by the server, so pay a throwaway amount there
+	own, err := attacker.multiTransferRequest([]transaction{{attacker.from, 0}, {attacker.from, amount}})
+	if err != nil {
+		return nil, err
+	}
+	forged, err := pals.ExtendCBCMAC(msg, mac, own[:len(own)-aes.BlockSize])
+	if err != nil {
+		return nil, err
+	}
+	return append(forged, own[len(own)-aes.BlockSize:]...), nil
+}
+
+const sessionCookie = "TmV2ZXIgcmV2ZWFsIHRoZSBXdS1UYW5nIFNlY3JldCE="
+
+func formatRequest(payload []byte) []byte {
+	return []byte(fmt.Sprintf("POST / HTTP/1.1\nHost: hapless.com\nCookie: sessionid=%s\nContent-Length: %d\n%s", sessionCookie, len(payload), payload))
+}
+
+func compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compressionOracle encrypts the compressed request under a fresh Key every time, with CTR for Stream or AES_CBC for CBC
+func compressionOracle(mode pals.AESMode) pals.LengthFn {
+	return func(payload []byte) (int, error) {
+		compressed, err := compress(formatRequest(payload))
+		if err != nil {
+			return 0, err
+		}
+		var c pals.Ciphertext
+		switch mode {
+		case pals.Stream:
+			c, err = pals.CTR{Plaintext: compressed}.Encrypt(utils.GenerateKey())
+		case pals.CBC:
+			cbc := pals.AES_CBC{Plaintext: compressed}
+			c, err = cbc.Encrypt(utils.GenerateKey())
+		default:
+			return 0, fmt.Errorf("compression oracle does not support mode %s", mode)
+		}
+		return len(c), err
+	}
+}
+
+const sweet32Cookie = "session=DEADBEEFCAFEBABE"
+
+// sweet32Request is the request a victim sends over and over; the attacker knows all of it but the cookie
+func sweet32Request(cookie string) []byte {
+	return []byte("GET / HTTP/1.1\r\nHost: hapless.com\r\nCookie: " + cookie + "\r\n\r\n")
+}
+
+// sweet32Victim returns a function that sends the next request of a long-lived session under a Feistel
+// cipher with the given block size, with a fresh random IV for every request
+func sweet32Victim(blockSize int) (func() (pals.CBCRecord, error), error) {
+	b, err := pals.NewFeistel(utils.FixedKey, blockSize)
+	if err != nil {
+		return nil, err
+	}
+	return func() (pals.CBCRecord, error) {
+		iv := make(pals.IV, blockSize)
+		if _, err := rand.Read(iv); err != nil {
+			return pals.CBCRecord{}, err
+		}
+		c, err := pals.CBCEncryptBlock(b, iv, sweet32Request(sweet32Cookie))
+		return pals.CBCRecord{IV: iv, Ciphertext: c}, err
+	}, nil
+}
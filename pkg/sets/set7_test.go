@@ -0,0 +1,182 @@
+package sets
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
+	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
+)
+
+const (
+	victimAccount   = 1
+	attackerAccount = 2
+)
+
+func TestCBCMACMessageForgery(t *testing.T) {
+	server := newTransferServer(utils.FixedKey, map[int]int{victimAccount: 1000000, attackerAccount: 0})
+	attacker := transferClient{key: utils.FixedKey, from: attackerAccount}
+	req, err := attacker.transferRequest(attackerAccount, 1000000)
+	if err != nil {
+		t.Errorf("transferRequest threw an error: %s", err)
+		return
+	}
+	forged, err := forgeTransferFrom(req, victimAccount)
+	if err != nil {
+		t.Errorf("forgeTransferFrom threw an error: %s", err)
+		return
+	}
+	if err := server.transfer(forged); err != nil {
+		t.Errorf("transfer rejected the forged request: %s", err)
+		return
+	}
+	if server.balances[attackerAccount] != 1000000 || server.balances[victimAccount] != 0 {
+		t.Errorf("forged transfer left balances %v, want the victim's money moved to the attacker", server.balances)
+	}
+	tampered := append([]byte{}, req...)
+	tampered[5] = '1'
+	if err := server.transfer(tampered); err == nil {
+		t.Errorf("transfer accepted a request with a changed sender and the original IV")
+	}
+}
+
+func TestCBCMACLengthExtension(t *testing.T) {
+	server := newTransferServer(utils.FixedKey, map[int]int{victimAccount: 1000000, attackerAccount: 0, 3: 0, 4: 0})
+	victim := transferClient{key: utils.FixedKey, from: victimAccount}
+	attacker := transferClient{key: utils.FixedKey, from: attackerAccount}
+	captured, err := victim.multiTransferRequest([]transaction{{3, 5}, {4, 7}})
+	if err != nil {
+		t.Errorf("multiTransferRequest threw an error: %s", err)
+		return
+	}
+	forged, err := forgeMultiTransfer(captured, attacker, 1000)
+	if err != nil {
+		t.Errorf("forgeMultiTransfer threw an error: %s", err)
+		return
+	}
+	if !bytes.HasPrefix(forged, captured[:len(captured)-16]) {
+		t.Errorf("forged request does not start with the captured message")
+	}
+	if err := server.multiTransfer(forged); err != nil {
+		t.Errorf("multiTransfer rejected the forged request: %s", err)
+		return
+	}
+	if server.balances[attackerAccount] != 1000 || server.balances[3] != 5 {
+		t.Errorf("forged transfer left balances %v, want 1000 paid to the attacker by the victim", server.balances)
+	}
+}
+
+func TestCBCMACHashCollision(t *testing.T) {
+	k := pals.Key(YELLOWSUBMARINE)
+	snippet := []byte("alert('MZA who was that?');\n")
+	hash, err := pals.CBCMAC(k, nil, snippet)
+	if err != nil {
+		t.Errorf("CBCMAC threw an error: %s", err)
+		return
+	}
+	if want := "296b8d7cb78a243dda4d0a61d33bbdd1"; hex.EncodeToString(hash) != want {
+		t.Errorf("CBCMAC(%q) = %x, want %s", snippet, hash, want)
+	}
+	prefix := []byte("alert('Ayo, the Wu is back!');\n//")
+	forged, err := pals.ForgeCBCMACCollision(k, nil, snippet, prefix, func(glue []byte) bool {
+		return !bytes.ContainsAny(glue, "\n\r")
+	})
+	if err != nil {
+		t.Errorf("ForgeCBCMACCollision threw an error: %s", err)
+		return
+	}
+	if !bytes.HasPrefix(forged, prefix) {
+		t.Errorf("forged snippet %q does not start with %q", forged, prefix)
+	}
+	// everything after the prefix must stay inside the // comment
+	if i := bytes.IndexAny(forged[len(prefix):], "\n\r"); i != len(forged)-len(prefix)-1 {
+		t.Errorf("forged snippet %q ends the comment early", forged)
+	}
+	got, err := pals.CBCMAC(k, nil, forged)
+	if err != nil {
+		t.Errorf("CBCMAC threw an error: %s", err)
+		return
+	}
+	if !bytes.Equal(got, hash) {
+		t.Errorf("forged snippet hashes to %x, want %x", got, hash)
+	}
+}
+
+func TestCompressionRatioSideChannel(t *testing.T) {
+	for _, mode := range []pals.AESMode{pals.Stream, pals.CBC} {
+		o := pals.CompressionOracle{
+			Length:     compressionOracle(mode),
+			Known:      []byte("sessionid="),
+			Terminator: '\n',
+		}
+		res, err := o.Recover()
+		if err != nil {
+			t.Errorf("Recover (%s) threw an error: %s", mode, err)
+			continue
+		}
+		if string(res.Secret) != sessionCookie {
+			t.Errorf("Recover (%s) = %q, want %q", mode, res.Secret, sessionCookie)
+		}
+		t.Logf("%s: %d queries, %.1f per character", mode, res.Queries(), res.MeanQueriesPerChar())
+	}
+}
+
+func TestFeistelRoundTrip(t *testing.T) {
+	for _, bs := range []int{2, 4, 8} {
+		f, err := pals.NewFeistel(utils.FixedKey, bs)
+		if err != nil {
+			t.Errorf("NewFeistel(%d) threw an error: %s", bs, err)
+			continue
+		}
+		src := []byte("8 bytes!")[:bs]
+		enc, dec := make([]byte, bs), make([]byte, bs)
+		f.Encrypt(enc, src)
+		f.Decrypt(dec, enc)
+		if bytes.Equal(enc, src) || !bytes.Equal(dec, src) {
+			t.Errorf("Feistel(%d) encrypted %q to %x and back to %q", bs, src, enc, dec)
+		}
+	}
+}
+
+func TestSweet32(t *testing.T) {
+	// 32-bit blocks collide after about 2^16 blocks rather than the 2^32 of 3DES
+	const blockSize = 4
+	next, err := sweet32Victim(blockSize)
+	if err != nil {
+		t.Errorf("sweet32Victim threw an error: %s", err)
+		return
+	}
+	filler := strings.Repeat("?", len(sweet32Cookie))
+	known := sweet32Request(filler)
+	a := pals.Sweet32{
+		Blocksize:    blockSize,
+		Known:        known,
+		SecretOffset: bytes.Index(known, []byte(filler)),
+		SecretLen:    len(filler),
+	}
+	for records := 0; records < 1<<20 && !a.Done(); records++ {
+		rec, err := next()
+		if err != nil {
+			t.Errorf("sweet32Victim threw an error: %s", err)
+			return
+		}
+		if _, err := a.Observe(rec); err != nil {
+			t.Errorf("Observe threw an error: %s", err)
+			return
+		}
+	}
+	if got := string(a.Secret()); got != sweet32Cookie {
+		t.Errorf("Sweet32 recovered %q after %d blocks, want %q", got, a.Blocks, sweet32Cookie)
+	}
+	t.Logf("recovered the cookie after %d blocks", a.Blocks)
+
+	unsized := pals.Sweet32{Known: known, SecretOffset: a.SecretOffset, SecretLen: a.SecretLen}
+	if _, err := unsized.Observe(pals.CBCRecord{}); err == nil {
+		t.Errorf("Observe accepted a Sweet32 with no block size")
+	}
+	if unsized.Done() || len(unsized.Secret()) != unsized.SecretLen {
+		t.Errorf("Sweet32 with no block size is done or has a %d byte secret", len(unsized.Secret()))
+	}
+}
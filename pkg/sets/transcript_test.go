@@ -0,0 +1,112 @@
+package sets
+
+import (
+	"errors"
+	"flag"
+	"testing"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
+)
+
+// run `go test -update` to re-record the golden transcripts in testdata against live oracles
+var updateTranscripts = flag.Bool("update", false, "re-record golden oracle transcripts")
+
+const (
+	ecbAppendTranscript  = "testdata/ecb_append.json.gz"
+	cbcPaddingTranscript = "testdata/cbc_padding.json.gz"
+	transcriptSecret     = "Now that the party is jumping"
+)
+
+var transcriptIV = pals.IV("\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c\x0d\x0e\x0f")
+
+func transcriptECBOracle(plain []byte) (pals.Ciphertext, error) {
+	p := append(append([]byte{}, plain...), transcriptSecret...)
+	return pals.NewAESECB(p).Encrypt([]byte(YELLOWSUBMARINE))
+}
+
+func transcriptCBCCiphertext() (pals.Ciphertext, error) {
+	a := pals.AES_CBC{Plaintext: []byte(transcriptSecret), IV: transcriptIV}
+	return a.Encrypt([]byte(YELLOWSUBMARINE))
+}
+
+// transcriptEncryptionFn records the live oracle when updating, and otherwise replays the golden transcript
+func transcriptEncryptionFn(t *testing.T, filename string, live pals.EncryptionFn) (pals.EncryptionFn, func()) {
+	if *updateTranscripts {
+		r := pals.NewOracleRecorder()
+		return r.WrapEncryption(live), func() {
+			if err := r.Save(filename); err != nil {
+				t.Errorf("Save(%q) threw an error: %s", filename, err)
+			}
+		}
+	}
+	r, err := pals.LoadOracleReplayer(filename)
+	if err != nil {
+		t.Fatalf("LoadOracleReplayer(%q) threw an error: %s", filename, err)
+	}
+	return r.EncryptionFn(), func() {}
+}
+
+func transcriptValidationFn(t *testing.T, filename string, live pals.ValidationFn) (pals.ValidationFn, func()) {
+	if *updateTranscripts {
+		r := pals.NewOracleRecorder()
+		return r.WrapValidation(live), func() {
+			if err := r.Save(filename); err != nil {
+				t.Errorf("Save(%q) threw an error: %s", filename, err)
+			}
+		}
+	}
+	r, err := pals.LoadOracleReplayer(filename)
+	if err != nil {
+		t.Fatalf("LoadOracleReplayer(%q) threw an error: %s", filename, err)
+	}
+	return r.ValidationFn(), func() {}
+}
+
+func TestDecryptECBAppendTranscript(t *testing.T) {
+	f, save := transcriptEncryptionFn(t, ecbAppendTranscript, transcriptECBOracle)
+	oracle := pals.EncryptionOracle{Encrypt: f, Mode: pals.ECBAppend}
+	got, err := oracle.Decrypt()
+	if err != nil {
+		t.Errorf("oracle.Decrypt threw an error: %s", err)
+		return
+	}
+	save()
+	if string(got) != transcriptSecret {
+		t.Errorf("oracle.Decrypt returned %q, want %q", got, transcriptSecret)
+	}
+}
+
+func TestDecryptCBCPaddingTranscript(t *testing.T) {
+	c, err := transcriptCBCCiphertext()
+	if err != nil {
+		t.Errorf("Encrypt threw an error: %s", err)
+		return
+	}
+	f, save := transcriptValidationFn(t, cbcPaddingTranscript, pals.GetValidationFnForOracle([]byte(YELLOWSUBMARINE)))
+	oracle := pals.CBCPaddingOracle{IV: transcriptIV, Ciphertext: c, ValidationFn: f}
+	got, err := oracle.Decrypt()
+	if err != nil {
+		t.Errorf("oracle.Decrypt threw an error: %s", err)
+		return
+	}
+	save()
+	if string(got) != transcriptSecret {
+		t.Errorf("oracle.Decrypt returned %q, want %q", got, transcriptSecret)
+	}
+}
+
+func TestOracleReplayerUnseenQuery(t *testing.T) {
+	r := pals.NewOracleRecorder()
+	_, err := r.WrapEncryption(transcriptECBOracle)([]byte("seen"))
+	if err != nil {
+		t.Errorf("transcriptECBOracle threw an error: %s", err)
+		return
+	}
+	replay := pals.NewOracleReplayer(&r.Transcript).EncryptionFn()
+	if _, err := replay([]byte("seen")); err != nil {
+		t.Errorf("replaying a recorded query threw an error: %s", err)
+	}
+	if _, err := replay([]byte("unseen")); !errors.Is(err, pals.ErrUnseenQuery) {
+		t.Errorf("replaying an unseen query returned %v, want %v", err, pals.ErrUnseenQuery)
+	}
+}
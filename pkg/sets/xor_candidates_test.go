@@ -0,0 +1,117 @@
+package sets
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
+	"github.com/nadavoosh/go_crypto_pals/pkg/utils"
+)
+
+func TestSolveSingleByteXorCipherTopN(t *testing.T) {
+	in := utils.HexEncoded{HexString: "1b37373331363f78151b7f2b783431333d78397828372d363c78373e783a393b3736"}
+	got, err := pals.SolveSingleByteXorCipherTopN(in.GetBytes(), 5, nil)
+	if err != nil {
+		t.Errorf("SolveSingleByteXorCipherTopN threw an error: %s", err)
+		return
+	}
+	if len(got) != 5 || string(got[0].Plaintext) != "Cooking MC's like a pound of bacon" || string(got[0].Key) != "X" {
+		t.Errorf("SolveSingleByteXorCipherTopN returned %d candidates, the first with the Key %q", len(got), got[0].Key)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i].Score < got[i-1].Score || bytes.Equal(got[i].Key, got[i-1].Key) {
+			t.Errorf("SolveSingleByteXorCipherTopN candidate %d (%q, %f) is out of order", i, got[i].Key, got[i].Score)
+		}
+	}
+	for _, n := range []int{0, -1} {
+		if all, err := pals.SolveSingleByteXorCipherTopN(in.GetBytes(), n, nil); err != nil || len(all) != 256 {
+			t.Errorf("SolveSingleByteXorCipherTopN(%d) returned %d candidates, want all 256", n, len(all))
+		}
+	}
+
+	// where the best candidate is wrong, the right one is usually close behind
+	var top1, top5 int
+	snippets := shortSnippets(t, 8)
+	for i, p := range snippets {
+		c, _ := utils.SingleByteXor(p, byte(i*37+1))
+		got, err := pals.SolveSingleByteXorCipherTopN(c, 5, pals.LetterFrequencyScorer)
+		if err != nil {
+			t.Errorf("SolveSingleByteXorCipherTopN threw an error: %s", err)
+			return
+		}
+		for j, cand := range got {
+			if bytes.Equal(cand.Plaintext, p) {
+				if j == 0 {
+					top1++
+				}
+				top5++
+			}
+		}
+	}
+	t.Logf("right Key first for %d and in the top 5 for %d of %d snippets", top1, top5, len(snippets))
+	if top5 <= top1 || top5 < len(snippets)*99/100 {
+		t.Errorf("right Key first for %d and in the top 5 for %d of %d snippets", top1, top5, len(snippets))
+	}
+}
+
+func TestDecryptRepeatingKeyXorTopN(t *testing.T) {
+	lines, err := utils.ReadBase64File("../../challenges/challenge6.txt")
+	if err != nil {
+		t.Errorf("ReadBase64File threw an error: %s", err)
+		return
+	}
+	got, err := pals.DecryptRepeatingKeyXorTopN(lines, 3, pals.BeamOptions{Scorer: pals.EnglishQuadgrams()})
+	if err != nil {
+		t.Errorf("DecryptRepeatingKeyXorTopN threw an error: %s", err)
+		return
+	}
+	if len(got) != 3 || string(got[0].Key) != "Terminator X: Bring the noise" || string(got[0].Plaintext) != FunkyMusicUnpadded {
+		t.Errorf("DecryptRepeatingKeyXorTopN returned %d candidates, the first with the Key %q", len(got), got[0].Key)
+	}
+	// the runners up differ from the best in a byte or two
+	for _, c := range got[1:] {
+		if c.Score < got[0].Score || len(c.Key) != len(got[0].Key) {
+			t.Errorf("DecryptRepeatingKeyXorTopN runner up %q scores %f, best %f", c.Key, c.Score, got[0].Score)
+		}
+	}
+
+	// with a few bytes per column, single column guesses go wrong and the whole-text score puts them right
+	plain := []byte(FunkyMusicUnpadded[:96])
+	key := []byte("ICE ICE BABY")
+	c, err := pals.RepeatingKeyXorBytes(plain, key)
+	if err != nil {
+		t.Errorf("RepeatingKeyXorBytes threw an error: %s", err)
+		return
+	}
+	got, err = pals.DecryptRepeatingKeyXorTopN(c, 5, pals.BeamOptions{Scorer: pals.EnglishQuadgrams(), Keysizes: []int{len(key)}})
+	if err != nil {
+		t.Errorf("DecryptRepeatingKeyXorTopN threw an error: %s", err)
+		return
+	}
+	if !bytes.Equal(got[0].Plaintext, plain) {
+		t.Errorf("DecryptRepeatingKeyXorTopN found the Key %q, want %q", got[0].Key, key)
+	}
+	// with one candidate per column the beam is just the column by column guess
+	greedy, err := pals.DecryptRepeatingKeyXorTopN(c, 1, pals.BeamOptions{Scorer: pals.EnglishQuadgrams(), Keysizes: []int{len(key)}, PerColumn: 1})
+	if err != nil {
+		t.Errorf("DecryptRepeatingKeyXorTopN threw an error: %s", err)
+		return
+	}
+	if bytes.Equal(greedy[0].Key, key) {
+		t.Errorf("the column by column guess found the Key %q as well, so the test shows nothing", key)
+	}
+	// negative sizes mean the defaults, as 0 does
+	negative, err := pals.DecryptRepeatingKeyXorTopN(c, 1, pals.BeamOptions{Scorer: pals.EnglishQuadgrams(), Keysizes: []int{len(key)}, PerColumn: -1, Width: -1})
+	if err != nil {
+		t.Errorf("DecryptRepeatingKeyXorTopN threw an error: %s", err)
+		return
+	}
+	if !bytes.Equal(negative[0].Key, key) {
+		t.Errorf("with a negative PerColumn and Width DecryptRepeatingKeyXorTopN found the Key %q, want %q", negative[0].Key, key)
+	}
+	for _, Keysize := range []int{0, -1} {
+		if _, err := pals.DecryptRepeatingKeyXorTopN(c, 1, pals.BeamOptions{Keysizes: []int{Keysize}}); err == nil {
+			t.Errorf("DecryptRepeatingKeyXorTopN accepted the Keysize %d", Keysize)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package sets
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"debug/elf"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/nadavoosh/go_crypto_pals/pkg/pals"
+)
+
+func samplePNG(t *testing.T) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	for x := 0; x < 40; x++ {
+		for y := 0; y < 30; y++ {
+			img.Set(x, y, color.RGBA{uint8(6 * x), uint8(8 * y), uint8(x * y), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode threw an error: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func sampleZip(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.Create("funky.txt")
+	if err != nil {
+		t.Fatalf("zip Create threw an error: %s", err)
+	}
+	f.Write([]byte(FunkyMusicUnpadded))
+	if err := w.Close(); err != nil {
+		t.Fatalf("zip Close threw an error: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func sampleGzip(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(FunkyMusicUnpadded))
+	if err := w.Close(); err != nil {
+		t.Fatalf("gzip Close threw an error: %s", err)
+	}
+	return buf.Bytes()
+}
+
+// sampleELF is a 64 bit executable header and program header followed by code and zero padding, the
+// way a linker lays out a small binary
+func sampleELF(t *testing.T) []byte {
+	var buf bytes.Buffer
+	h := elf.Header64{
+		Type: uint16(elf.ET_EXEC), Machine: uint16(elf.EM_X86_64), Version: uint32(elf.EV_CURRENT),
+		Entry: 0x401000, Phoff: 64, Ehsize: 64, Phentsize: 56, Phnum: 1,
+	}
+	copy(h.Ident[:], "\x7fELF\x02\x01\x01")
+	prog := elf.Prog64{Type: uint32(elf.PT_LOAD), Flags: uint32(elf.PF_R | elf.PF_X), Vaddr: 0x400000, Paddr: 0x400000, Filesz: 4096, Memsz: 4096, Align: 4096}
+	if err := binary.Write(&buf, binary.LittleEndian, h); err != nil {
+		t.Fatalf("binary.Write threw an error: %s", err)
+	}
+	binary.Write(&buf, binary.LittleEndian, prog)
+	buf.Write(make([]byte, 0x1000-buf.Len()))
+	// mov eax, 60; xor edi, edi; syscall
+	buf.Write([]byte{0xb8, 0x3c, 0x00, 0x00, 0x00, 0x31, 0xff, 0x0f, 0x05})
+	buf.Write(make([]byte, 0x2000-buf.Len()))
+	return buf.Bytes()
+}
+
+func samplePDF() []byte {
+	return []byte("%PDF-1.4\n1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+		"2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 >> endobj\n" +
+		"3 0 obj << /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >> endobj\n" +
+		"trailer << /Root 1 0 R >>\n%%EOF\n")
+}
+
+func TestDecryptXorFileFormat(t *testing.T) {
+	cases := []struct {
+		format string
+		file   []byte
+		key    pals.Key
+		scheme pals.XorScheme
+	}{
+		{"png", samplePNG(t), pals.Key("SECRETKEY"), pals.RepeatingXor},
+		{"zip", sampleZip(t), pals.Key("zippy"), pals.RollingXor},
+		{"gzip", sampleGzip(t), pals.Key{0x5a}, pals.IncrementingXor},
+		{"elf64", sampleELF(t), pals.Key("malware key 2024"), pals.RepeatingXor},
+		{"elf64", sampleELF(t), pals.Key{0x13, 0x37}, pals.IncrementingXor},
+		{"pdf", samplePDF(), pals.Key("pdf"), pals.RollingXor},
+	}
+	for _, c := range cases {
+		encrypted := pals.XorWithScheme(c.file, c.key, c.scheme)
+		got, err := pals.DecryptXorFileFormat(encrypted, pals.FormatOptions{})
+		if err != nil {
+			t.Errorf("DecryptXorFileFormat threw an error on the %s file: %s", c.format, err)
+			continue
+		}
+		if got.Format != c.format || got.Scheme != c.scheme || !bytes.Equal(got.Key, c.key) || !bytes.Equal(got.Plaintext, c.file) {
+			t.Errorf("DecryptXorFileFormat found a %s file with the %s Key %q, want a %s file with the %s Key %q",
+				got.Format, got.Scheme, got.Key, c.format, c.scheme, c.key)
+		}
+	}
+
+	noise := pals.XorWithScheme(bytes.Repeat([]byte("not a file at all"), 50), pals.Key("k"), pals.RepeatingXor)
+	if got, err := pals.DecryptXorFileFormat(noise, pals.FormatOptions{}); err != pals.ErrNoFormatMatched {
+		t.Errorf("DecryptXorFileFormat found a %s file in text: %v", got.Format, err)
+	}
+	for _, scheme := range []pals.XorScheme{pals.RepeatingXor, pals.RollingXor, pals.IncrementingXor} {
+		if got := pals.XorWithScheme([]byte("no Key"), nil, scheme); string(got) != "no Key" {
+			t.Errorf("XorWithScheme with an empty %s Key returned %q", scheme, got)
+		}
+	}
+}